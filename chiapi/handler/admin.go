@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/env"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// BuildInfo describes the running build.
+type BuildInfo struct {
+	Version string    `json:"version"`
+	GitHash string    `json:"git_hash"`
+	Date    time.Time `json:"date"`
+}
+
+// Admin handles the requests to the admin listener, which help operators debug a running instance.
+type Admin struct {
+	api    http.Handler
+	config func() map[string]env.Value
+	build  BuildInfo
+	levels *logging.Levels
+	keys   *auth.APIKeys
+	events audit.Store
+}
+
+// NewAdmin creates a new Admin. The api is the API router, whose routes are listed by Routes. The
+// config returns the effective config shown by Config, with its secrets redacted, such as env.Dump
+// of the config loaded by env.Load. The levels are changed by SetLogLevel. The keys are managed by
+// the API key endpoints; if nil, they return 404. The events are queried by AuditEvents; if nil, it
+// returns 404.
+func NewAdmin(api http.Handler, config func() map[string]env.Value, build BuildInfo, levels *logging.Levels, keys *auth.APIKeys, events audit.Store) *Admin {
+	return &Admin{
+		api:    api,
+		config: config,
+		build:  build,
+		levels: levels,
+		keys:   keys,
+		events: events,
+	}
+}
+
+// Route is a single route of the API, as listed by Routes.
+type Route struct {
+	Method      string   `json:"method"`
+	Pattern     string   `json:"pattern"`
+	Middlewares []string `json:"middlewares"`
+}
+
+// Routes lists every route of the API, with the middleware that runs for it, in order.
+func (a *Admin) Routes(w http.ResponseWriter, r *http.Request) {
+	routes := []Route{}
+
+	if api, ok := a.api.(chi.Routes); ok {
+		walk := func(method, pattern string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			route := Route{
+				Method:      method,
+				Pattern:     strings.Replace(pattern, "/*/", "/", -1),
+				Middlewares: make([]string, 0, len(middlewares)),
+			}
+
+			for _, mw := range middlewares {
+				route.Middlewares = append(route.Middlewares, funcName(mw))
+			}
+
+			routes = append(routes, route)
+
+			return nil
+		}
+
+		if err := chi.Walk(api, walk); err != nil {
+			logging.FromContext(r.Context()).Error("error walking routes", zap.Error(err))
+			a.InternalServerError(w, r)
+			return
+		}
+	}
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, routes)
+}
+
+// Config shows the effective config, keyed by environment variable, with the source of each value
+// and secrets redacted.
+func (a *Admin) Config(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(r.Context(), w, http.StatusOK, a.config())
+}
+
+type buildResponse struct {
+	BuildInfo
+	GoVersion string            `json:"go_version"`
+	Module    string            `json:"module,omitempty"`
+	Deps      map[string]string `json:"deps,omitempty"`
+}
+
+// Build shows the version of the running build, the Go version it was built with and the versions
+// of its dependencies.
+func (a *Admin) Build(w http.ResponseWriter, r *http.Request) {
+	resp := buildResponse{
+		BuildInfo: a.build,
+		GoVersion: runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		resp.Module = info.Main.Path
+		resp.Deps = make(map[string]string, len(info.Deps))
+
+		for _, dep := range info.Deps {
+			resp.Deps[dep.Path] = dep.Version
+		}
+	}
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, resp)
+}
+
+// Goroutines dumps the stack of every goroutine, in the same format as an unrecovered panic.
+func (a *Admin) Goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		logging.FromContext(r.Context()).Error("error writing goroutines", zap.Error(err))
+	}
+}
+
+// LogLevelResponse is the current log level, and its overrides.
+type LogLevelResponse struct {
+	Level     string             `json:"level"`
+	Expires   time.Time          `json:"expires,omitempty"`
+	Overrides []logging.Override `json:"overrides"`
+}
+
+// LogLevelRequest changes the log level. If Scope is set, the level only applies to that scope; see
+// logging.Levels. If TTL is set, such as 15m, the change reverts after it.
+type LogLevelRequest struct {
+	Level string `json:"level"`
+	Scope string `json:"scope"`
+	TTL   string `json:"ttl"`
+}
+
+// LogLevel shows the current log level, and its overrides.
+func (a *Admin) LogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(r.Context(), w, http.StatusOK, &LogLevelResponse{
+		Level:     a.levels.Level().String(),
+		Expires:   a.levels.Expires(),
+		Overrides: a.levels.Overrides(),
+	})
+}
+
+// SetLogLevel changes the log level, or the level of a scope, as described by a LogLevelRequest. The
+// change is logged with who made it, and recorded as an audit event.
+func (a *Admin) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, r, "invalid request body")
+		return
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil || req.Level == "" {
+		a.badRequest(w, r, "invalid level")
+		return
+	}
+
+	var ttl time.Duration
+
+	if req.TTL != "" {
+		var err error
+
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl < 0 {
+			a.badRequest(w, r, "invalid ttl")
+			return
+		}
+	}
+
+	by := identity.FromContext(r.Context())
+
+	if req.Scope == "" {
+		a.levels.SetLevel(level, ttl, by)
+	} else {
+		a.levels.SetOverride(req.Scope, level, ttl, by)
+	}
+
+	recordAction(r, "log_level.set", req.Scope, map[string]string{"level": level.String(), "ttl": ttl.String()})
+
+	a.LogLevel(w, r)
+}
+
+// DeleteLogLevel removes the override for the scope in the scope query param.
+func (a *Admin) DeleteLogLevel(w http.ResponseWriter, r *http.Request) {
+	scope := r.URL.Query().Get("scope")
+
+	if !a.levels.RemoveOverride(scope, identity.FromContext(r.Context())) {
+		a.NotFound(w, r)
+		return
+	}
+
+	recordAction(r, "log_level.delete", scope, nil)
+
+	a.LogLevel(w, r)
+}
+
+// recordAction records a change made from the admin listener as an audit event.
+func recordAction(r *http.Request, action, resource string, details map[string]string) {
+	audit.Record(r.Context(), audit.Event{
+		Type:     audit.TypeAdminAction,
+		Action:   action,
+		Outcome:  audit.OutcomeSuccess,
+		Resource: resource,
+		Details:  details,
+	})
+}
+
+func (a *Admin) badRequest(w http.ResponseWriter, r *http.Request, msg string) {
+	writeJSONResponse(r.Context(), w, http.StatusBadRequest, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: msg,
+	})
+}
+
+// NotFound returns a 404 response.
+func (a *Admin) NotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(r.Context(), w, http.StatusNotFound, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "not found",
+	})
+}
+
+// Unauthorized returns a 401 response.
+func (a *Admin) Unauthorized(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(r.Context(), w, http.StatusUnauthorized, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "unauthorized",
+	})
+}
+
+// InternalServerError returns a 500 response.
+func (a *Admin) InternalServerError(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(r.Context(), w, http.StatusInternalServerError, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "internal server error",
+	})
+}
+
+// funcName returns the short name of a middleware, such as middleware.Logger, for display.
+func funcName(fn interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.TrimSuffix(name, "-fm")
+
+	// Strip the closures returned by middleware constructors, such as middleware.Logger.func1 or
+	// jwtauth.Verifier.func1.1.
+	for {
+		i := strings.LastIndex(name, ".")
+		if i < 0 || !isClosure(name[i+1:]) {
+			break
+		}
+
+		name = name[:i]
+	}
+
+	return name
+}
+
+func isClosure(part string) bool {
+	part = strings.TrimPrefix(part, "func")
+	if part == "" {
+		return false
+	}
+
+	for _, c := range part {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
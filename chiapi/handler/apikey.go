@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// APIKeyResponse is an API key, without the hash of its secret. The Key is only set when the key is
+// created or rotated, and cannot be shown again.
+type APIKeyResponse struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Owner      string    `json:"owner"`
+	Scopes     []string  `json:"scopes"`
+	Tenant     string    `json:"tenant,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty"`
+	RevokedBy  string    `json:"revoked_by,omitempty"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+	Key        string    `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(k auth.APIKey, key string) APIKeyResponse {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Owner:      k.Owner,
+		Scopes:     scopes,
+		Tenant:     k.Tenant,
+		CreatedAt:  k.CreatedAt,
+		CreatedBy:  k.CreatedBy,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		RevokedBy:  k.RevokedBy,
+		ReplacedBy: k.ReplacedBy,
+		Key:        key,
+	}
+}
+
+// APIKeyRequest creates an API key acting as the Owner, with the Scopes, in the Tenant. If TTL is
+// set, such as 720h, the key expires after it.
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Owner  string   `json:"owner"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant"`
+	TTL    string   `json:"ttl"`
+}
+
+// ListAPIKeys lists every API key, newest first, including revoked and expired ones.
+func (a *Admin) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if a.keys == nil {
+		a.NotFound(w, r)
+		return
+	}
+
+	keys, err := a.keys.List(r.Context())
+	if err != nil {
+		a.apiKeyError(w, r, err)
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, newAPIKeyResponse(k, ""))
+	}
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, resp)
+}
+
+// CreateAPIKey issues an API key, as described by an APIKeyRequest. The response is the only time the
+// key is shown.
+func (a *Admin) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if a.keys == nil {
+		a.NotFound(w, r)
+		return
+	}
+
+	var req APIKeyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, r, "invalid request body")
+		return
+	}
+
+	if req.Owner == "" {
+		a.badRequest(w, r, "owner is required")
+		return
+	}
+
+	var ttl time.Duration
+
+	if req.TTL != "" {
+		var err error
+
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl < 0 {
+			a.badRequest(w, r, "invalid ttl")
+			return
+		}
+	}
+
+	k, key, err := a.keys.Issue(r.Context(), auth.APIKeyRequest{
+		Name:   req.Name,
+		Owner:  req.Owner,
+		Scopes: req.Scopes,
+		Tenant: req.Tenant,
+		TTL:    ttl,
+	})
+	if err != nil {
+		a.apiKeyError(w, r, err)
+		return
+	}
+
+	recordAction(r, "api_key.create", k.ID, map[string]string{"owner": k.Owner})
+
+	writeJSONResponse(r.Context(), w, http.StatusCreated, newAPIKeyResponse(k, key))
+}
+
+// RotateAPIKey replaces the API key in the id URL param with a new key, and revokes it. The response
+// is the only time the new key is shown.
+func (a *Admin) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if a.keys == nil {
+		a.NotFound(w, r)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	k, key, err := a.keys.Rotate(r.Context(), id)
+	if err != nil {
+		a.apiKeyError(w, r, err)
+		return
+	}
+
+	recordAction(r, "api_key.rotate", id, map[string]string{"replaced_by": k.ID})
+
+	writeJSONResponse(r.Context(), w, http.StatusCreated, newAPIKeyResponse(k, key))
+}
+
+// RevokeAPIKey revokes the API key in the id URL param. The key is kept, so it is still listed.
+func (a *Admin) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if a.keys == nil {
+		a.NotFound(w, r)
+		return
+	}
+
+	k, err := a.keys.Revoke(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		a.apiKeyError(w, r, err)
+		return
+	}
+
+	recordAction(r, "api_key.revoke", k.ID, nil)
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, newAPIKeyResponse(k, ""))
+}
+
+func (a *Admin) apiKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == auth.ErrAPIKeyNotFound {
+		a.NotFound(w, r)
+		return
+	}
+
+	if err == auth.ErrAPIKeyRevoked {
+		a.badRequest(w, r, err.Error())
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("error managing api keys", zap.Error(err))
+	a.InternalServerError(w, r)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// maxAuditEvents is the most audit events returned by one query.
+const maxAuditEvents = 1000
+
+// AuditEvents lists the recorded audit events, newest first. They are filtered by the principal and
+// type query params, and by the from and to query params, which are RFC 3339 times. The limit query
+// param is the most events to return, 100 by default, and at most 1000.
+func (a *Admin) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	if a.events == nil {
+		a.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+
+	f := audit.Filter{
+		Principal: q.Get("principal"),
+		Type:      q.Get("type"),
+		Limit:     100,
+	}
+
+	for param, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				a.badRequest(w, r, "invalid "+param)
+				return
+			}
+
+			*t = parsed
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAuditEvents {
+			a.badRequest(w, r, "invalid limit")
+			return
+		}
+
+		f.Limit = limit
+	}
+
+	events, err := a.events.Events(r.Context(), f)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error querying audit events", zap.Error(err))
+		a.InternalServerError(w, r)
+		return
+	}
+
+	if events == nil {
+		events = []audit.Event{}
+	}
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, events)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/csp"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// maxCSPViolations is the most violations logged from one report, so a single request can not
+// flood the logs.
+const maxCSPViolations = 10
+
+// CSPReport logs the Content-Security-Policy violations reported by browsers; see
+// middleware.SecurityHeaderOptions. It accepts both report-uri and Reporting API reports, and
+// responds with a 204, or a 400 problem response if the report can not be parsed.
+func (h *Handler) CSPReport(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context())
+
+	violations, err := csp.ParseReports(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		log.Info("invalid csp report", zap.Error(err))
+
+		writeProblem(r, w, &Problem{
+			Status:  http.StatusBadRequest,
+			Detail:  err.Error(),
+			TraceID: tracing.FromContext(r.Context()),
+		})
+
+		return
+	}
+
+	if len(violations) > maxCSPViolations {
+		violations = violations[:maxCSPViolations]
+	}
+
+	for _, v := range violations {
+		log.Warn("csp violation",
+			zap.String("document_uri", v.DocumentURI),
+			zap.String("blocked_uri", v.BlockedURI),
+			zap.String("effective_directive", v.EffectiveDirective),
+			zap.String("disposition", v.Disposition),
+			zap.String("source_file", v.SourceFile),
+			zap.Int("line_number", v.LineNumber),
+			zap.Int("column_number", v.ColumnNumber),
+			zap.String("sample", v.Sample),
+		)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
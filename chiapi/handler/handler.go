@@ -8,10 +8,11 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi"
-	newrelic "github.com/newrelic/go-agent"
 	"go.uber.org/zap"
 
+	"github.com/rickbassham/example-go/pkg/auth"
 	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
 	"github.com/rickbassham/example-go/pkg/logging"
 	"github.com/rickbassham/example-go/pkg/tracing"
 )
@@ -52,8 +53,7 @@ func (h *Handler) Cached(w http.ResponseWriter, r *http.Request) {
 
 	v, err := h.cache.GetValue(ctx)
 	if err != nil {
-		txn := newrelic.FromContext(ctx)
-		txn.NoticeError(err) // nolint
+		instrumentation.FromContext(ctx).NoticeError(err)
 
 		//l := middleware.GetLogger(ctx)
 		l.Error("error getting value from cache", zap.Error(err))
@@ -94,6 +94,20 @@ func (h *Handler) Unauthorized(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Forbidden is called when a policy denies the request; see auth.ForbiddenFromContext.
+func (h *Handler) Forbidden(w http.ResponseWriter, r *http.Request) {
+	p := &Problem{
+		Status:  http.StatusForbidden,
+		TraceID: tracing.FromContext(r.Context()),
+	}
+
+	if err, ok := auth.ForbiddenFromContext(r.Context()); ok {
+		p.Detail = err.Error()
+	}
+
+	writeProblem(r, w, p)
+}
+
 // NotFound is called when the request is for an unknown resource.
 func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
 	writeResponse(r, w, http.StatusNotFound, &SimpleResponse{
@@ -102,6 +116,22 @@ func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// InternalServerError is called when the request failed unexpectedly, such as after a panic.
+func (h *Handler) InternalServerError(w http.ResponseWriter, r *http.Request) {
+	writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "internal server error",
+	})
+}
+
+// ServiceUnavailable is called when the request is shed because the server is overloaded.
+func (h *Handler) ServiceUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeResponse(r, w, http.StatusServiceUnavailable, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "service unavailable",
+	})
+}
+
 func routeParamInt(ctx context.Context, name string) int {
 	// this func should only be called for params that are guaranteed to be ints.
 	val, _ := strconv.Atoi(chi.RouteContext(ctx).URLParam("id")) // nolint
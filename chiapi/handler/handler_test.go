@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi"
@@ -14,6 +15,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/rickbassham/example-go/chiapi/handler"
+	"github.com/rickbassham/example-go/pkg/auth"
 	"github.com/rickbassham/example-go/pkg/identity"
 	"github.com/rickbassham/example-go/pkg/tracing"
 )
@@ -83,3 +85,40 @@ func withChiParam(ctx context.Context, key, value string) context.Context {
 
 	return context.WithValue(ctx, chi.RouteCtxKey, rctx)
 }
+
+func TestForbidden(t *testing.T) {
+	h := &handler.Handler{}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/protected/1", nil)
+	ctx := tracing.WithTraceID(r.Context(), "my-trace-id")
+	ctx = auth.WithForbidden(ctx, &auth.Forbidden{Policy: "roles:admin"})
+	r = r.WithContext(ctx)
+
+	h.Forbidden(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"denied by policy roles:admin","trace_id":"my-trace-id"}`+"\n", w.Body.String())
+}
+
+func TestCSPReport(t *testing.T) {
+	h := &handler.Handler{}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(`{"csp-report":{"document-uri":"https://example.com/","blocked-uri":"inline","violated-directive":"script-src"}}`))
+	r.Header.Set("Content-Type", "application/csp-report")
+
+	h.CSPReport(w, r)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(`hello`))
+	r.Header.Set("Content-Type", "text/plain")
+
+	h.CSPReport(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
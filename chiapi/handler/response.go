@@ -7,9 +7,9 @@ import (
 	"net/http"
 	"strings"
 
-	newrelic "github.com/newrelic/go-agent"
 	"go.uber.org/zap"
 
+	"github.com/rickbassham/example-go/pkg/instrumentation"
 	"github.com/rickbassham/example-go/pkg/logging"
 )
 
@@ -21,6 +21,37 @@ type SimpleResponse struct {
 	Message string   `json:"message" xml:",innerxml"`
 }
 
+// Problem is a problem details response, as described in RFC 7807, with the trace id to debug later.
+type Problem struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Status  int    `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	TraceID string `json:"trace_id"`
+}
+
+func writeProblem(r *http.Request, w http.ResponseWriter, p *Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+
+	err := json.NewEncoder(w).Encode(p)
+	if err != nil {
+		logging.FromContext(ctx).Error("error writing response", zap.Error(err))
+		instrumentation.FromContext(ctx).NoticeError(err)
+	}
+}
+
 func writeResponse(r *http.Request, w http.ResponseWriter, status int, resp interface{}) {
 	accept := r.Header.Get("Accept")
 
@@ -39,7 +70,7 @@ func writeXMLResponse(ctx context.Context, w http.ResponseWriter, status int, re
 	err := xml.NewEncoder(w).Encode(resp)
 	if err != nil {
 		logging.FromContext(ctx).Error("error writing response", zap.Error(err))
-		newrelic.FromContext(ctx).NoticeError(err) // nolint
+		instrumentation.FromContext(ctx).NoticeError(err)
 	}
 }
 
@@ -51,6 +82,6 @@ func writeJSONResponse(ctx context.Context, w http.ResponseWriter, status int, r
 	err := json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		logging.FromContext(ctx).Error("error writing response", zap.Error(err))
-		newrelic.FromContext(ctx).NoticeError(err) // nolint
+		instrumentation.FromContext(ctx).NoticeError(err)
 	}
 }
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// SessionManager defines the funcs needed to manage browser sessions, such as an auth.Sessions.
+type SessionManager interface {
+	Create(ctx context.Context, p identity.Principal, userAgent, ip string) (auth.Session, string, error)
+	List(ctx context.Context, subject string) ([]auth.Session, error)
+	Revoke(ctx context.Context, subject, id string) error
+	AbsoluteTimeout() time.Duration
+}
+
+// Sessions handles the requests to log in with a session cookie, and to list and revoke sessions.
+type Sessions struct {
+	sessions SessionManager
+	users    auth.CredentialStore
+	scopes   []string
+}
+
+// NewSessions creates a new Sessions. The users are checked by Login, and the scopes are granted to
+// every session, like the scopes of an issued token.
+func NewSessions(sessions SessionManager, users auth.CredentialStore, scopes []string) *Sessions {
+	return &Sessions{
+		sessions: sessions,
+		users:    users,
+		scopes:   scopes,
+	}
+}
+
+// SessionResponse describes a session. The CSRFToken is only shown for the current session; it must
+// be sent in the X-CSRF-Token header of unsafe requests made with it.
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+	CSRFToken  string    `json:"csrf_token,omitempty"`
+}
+
+func newSessionResponse(s auth.Session, current bool) SessionResponse {
+	resp := SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    current,
+	}
+
+	if current {
+		resp.CSRFToken = s.CSRFToken
+	}
+
+	return resp
+}
+
+// Login checks the credentials in the LoginRequest, and starts a session in the tenant of the
+// request, if any, setting the session cookie. The response is the current SessionResponse, with
+// its CSRF token.
+func (s *Sessions) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" || req.Password == "" {
+		s.respond(w, r, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	subject, err := auth.CheckCredentials(r.Context(), s.users, req.Username, req.Password)
+	if err == auth.ErrInvalidCredentials {
+		s.respond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		s.internalServerError(w, r, err)
+		return
+	}
+
+	tenant, _ := identity.TenantFromContext(r.Context())
+
+	sess, cookie, err := s.sessions.Create(r.Context(), identity.Principal{
+		Subject: subject,
+		Scopes:  s.scopes,
+		Tenant:  tenant,
+	}, r.UserAgent(), remoteIP(r))
+	if err != nil {
+		s.internalServerError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, auth.SessionCookie(cookie, s.sessions.AbsoluteTimeout()))
+	w.Header().Set("Cache-Control", "no-store")
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, newSessionResponse(sess, true))
+}
+
+// Current shows the session the request was made with, with its CSRF token, so a reloaded page can
+// get it again.
+func (s *Sessions) Current(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r.Context())
+	if !ok {
+		s.respond(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, newSessionResponse(sess, true))
+}
+
+// Logout ends the session the request was made with, and deletes the session cookie.
+func (s *Sessions) Logout(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r.Context())
+	if ok {
+		err := s.sessions.Revoke(r.Context(), sess.Principal.ID(), sess.ID)
+		if err != nil && err != auth.ErrSessionNotFound {
+			s.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	http.SetCookie(w, auth.SessionCookie("", -1))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List lists the sessions of the principal, most recently used first.
+func (s *Sessions) List(w http.ResponseWriter, r *http.Request) {
+	p, _ := identity.PrincipalFromContext(r.Context())
+	current, _ := auth.SessionFromContext(r.Context())
+
+	sessions, err := s.sessions.List(r.Context(), p.ID())
+	if err != nil {
+		s.internalServerError(w, r, err)
+		return
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
+		resp = append(resp, newSessionResponse(sess, sess.ID == current.ID))
+	}
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, resp)
+}
+
+// Revoke ends the session in the id URL param, if it belongs to the principal.
+func (s *Sessions) Revoke(w http.ResponseWriter, r *http.Request) {
+	p, _ := identity.PrincipalFromContext(r.Context())
+
+	err := s.sessions.Revoke(r.Context(), p.ID(), chi.URLParam(r, "id"))
+	if err == auth.ErrSessionNotFound {
+		s.respond(w, r, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		s.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Sessions) respond(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	writeResponse(r, w, status, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: msg,
+	})
+}
+
+func (s *Sessions) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("error managing sessions", zap.Error(err))
+	instrumentation.FromContext(r.Context()).NoticeError(err)
+
+	s.respond(w, r, http.StatusInternalServerError, "internal server error")
+}
+
+// remoteIP returns the ip address of the client, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
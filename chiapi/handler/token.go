@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// TokenIssuer defines the funcs needed to issue and revoke tokens, such as an auth.TokenIssuer.
+type TokenIssuer interface {
+	Login(ctx context.Context, username, password string) (auth.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (auth.Tokens, error)
+	Logout(ctx context.Context, jti string, expires time.Time, refreshToken string) error
+}
+
+// Tokens handles the requests to log in, refresh tokens and log out.
+type Tokens struct {
+	issuer TokenIssuer
+}
+
+// NewTokens creates a new Tokens using the issuer.
+func NewTokens(issuer TokenIssuer) *Tokens {
+	return &Tokens{
+		issuer: issuer,
+	}
+}
+
+// LoginRequest logs in with a username and password.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest exchanges a refresh token for new tokens, or revokes it when logging out.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Login checks the credentials in the LoginRequest, and responds with new auth.Tokens.
+func (t *Tokens) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" || req.Password == "" {
+		t.badRequest(w, r, "username and password are required")
+		return
+	}
+
+	tokens, err := t.issuer.Login(r.Context(), req.Username, req.Password)
+	if err == auth.ErrInvalidCredentials {
+		t.unauthorized(w, r, err.Error())
+		return
+	} else if err != nil {
+		t.internalServerError(w, r, err)
+		return
+	}
+
+	writeTokens(r, w, tokens)
+}
+
+// Refresh exchanges the refresh token in the RefreshRequest for new auth.Tokens. The refresh token
+// cannot be used again.
+func (t *Tokens) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		t.badRequest(w, r, "refresh_token is required")
+		return
+	}
+
+	tokens, err := t.issuer.Refresh(r.Context(), req.RefreshToken)
+	if e, ok := err.(*auth.Error); ok {
+		logging.AddRequestFields(r.Context(), zap.String("auth_error", e.Reason))
+		t.unauthorized(w, r, e.Description)
+		return
+	} else if err != nil {
+		t.internalServerError(w, r, err)
+		return
+	}
+
+	writeTokens(r, w, tokens)
+}
+
+// Logout revokes the access token the request was authenticated with, and the refresh token in the
+// RefreshRequest, if there is one. The body is optional.
+func (t *Tokens) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.badRequest(w, r, "invalid request body")
+			return
+		}
+	}
+
+	p, _ := identity.PrincipalFromContext(r.Context())
+	_, claims, _ := jwtauth.FromContext(r.Context())
+
+	var expires time.Time
+	if exp, ok := claims["exp"].(float64); ok {
+		expires = time.Unix(int64(exp), 0)
+	}
+
+	// Only tokens have a jti to revoke; a session is ended with Sessions.Logout.
+	var jti string
+	if p.AuthMethod == identity.AuthMethodJWT {
+		jti = p.TokenID
+	}
+
+	if err := t.issuer.Logout(r.Context(), jti, expires, req.RefreshToken); err != nil {
+		t.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTokens writes the tokens as an OAuth 2.0 token response, which must not be cached.
+func writeTokens(r *http.Request, w http.ResponseWriter, tokens auth.Tokens) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	writeJSONResponse(r.Context(), w, http.StatusOK, tokens)
+}
+
+func (t *Tokens) badRequest(w http.ResponseWriter, r *http.Request, msg string) {
+	writeResponse(r, w, http.StatusBadRequest, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: msg,
+	})
+}
+
+func (t *Tokens) unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	writeResponse(r, w, http.StatusUnauthorized, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: msg,
+	})
+}
+
+func (t *Tokens) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("error issuing tokens", zap.Error(err))
+	instrumentation.FromContext(r.Context()).NoticeError(err)
+
+	writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "internal server error",
+	})
+}
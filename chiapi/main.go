@@ -3,31 +3,179 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"time"
 
-	"github.com/go-chi/jwtauth"
 	"github.com/go-redis/redis/v7"
+	"github.com/jmoiron/sqlx"
 	newrelic "github.com/newrelic/go-agent"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gogs.rickbassham.com/rick/database"
 
 	"github.com/rickbassham/example-go/chiapi/handler"
+	"github.com/rickbassham/example-go/chiapi/middleware"
 	"github.com/rickbassham/example-go/chiapi/router"
 	"github.com/rickbassham/example-go/chiapi/server"
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
 	"github.com/rickbassham/example-go/pkg/cache"
 	"github.com/rickbassham/example-go/pkg/env"
+	"github.com/rickbassham/example-go/pkg/feature"
+	"github.com/rickbassham/example-go/pkg/httputil"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
 	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/metrics"
+	"github.com/rickbassham/example-go/pkg/redact"
+	"github.com/rickbassham/example-go/pkg/testdb"
+	"github.com/rickbassham/example-go/pkg/tracing"
 )
 
+// config is loaded from the environment, and the other sources of env.Load. The fields tagged
+// reload:"true" are reloaded on SIGHUP, and when the config file changes; see env.Reloader.
 type config struct {
 	env.Config
 	ListenAddress string `env:"LISTEN_ADDRESS,required"`
-	JWTAuthSecret string `env:"JWT_AUTH_SECRET,required"`
-	CORSOrigin    string `env:"CORS_ORIGIN,required"`
+	JWTAuthSecret string `env:"JWT_AUTH_SECRET" secret:"true" reload:"true"`
 	RedisAddress  string `env:"REDIS_ADDRESS,required"`
+
+	// ConfigWatchInterval is how often the config file is checked for changes. If it is zero, the
+	// config is only reloaded on SIGHUP.
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" envDefault:"10s"`
+
+	// Features are the names of the features that are enabled; see feature.Enabled.
+	Features []string `env:"FEATURES" envSeparator:"," reload:"true"`
+
+	// CORSOrigins are the origins allowed to make cross origin requests, such as
+	// https://*.example.com; see middleware.CORSPolicy. CORSRoutes overrides them for route groups,
+	// with entries such as /auth=https://login.example.com; see middleware.ParseCORSRoutes.
+	CORSOrigins          []string      `env:"CORS_ORIGIN,required" envSeparator:"," reload:"true"`
+	CORSRoutes           []string      `env:"CORS_ROUTES" envSeparator:";" reload:"true"`
+	CORSAllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" envSeparator:"," envDefault:"GET,POST,PUT,DELETE,OPTIONS" reload:"true"`
+	CORSAllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" envSeparator:"," envDefault:"*" reload:"true"`
+	CORSExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" envSeparator:"," envDefault:"X-Trace-Id,X-Version" reload:"true"`
+	CORSAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" envDefault:"true" reload:"true"`
+	CORSMaxAge           time.Duration `env:"CORS_MAX_AGE" envDefault:"5m" reload:"true"`
+
+	// DatabaseDSN connects to the database of users with DatabaseDriver, which must be linked into the
+	// binary, such as by importing github.com/go-sql-driver/mysql. If it is set, users log in with
+	// their password for tokens signed with JWT_AUTH_SECRET, which last TokenAccessTTL and can be
+	// refreshed for TokenRefreshTTL; see router.WithTokens. Browsers log in for a session cookie
+	// instead, kept in redis, which ends once it is idle for SessionIdleTimeout, or after
+	// SessionAbsoluteTimeout; see router.WithSessions. The users table is scoped to tenants, so it
+	// requires MULTI_TENANT. Statements are logged at warn or error once they take DatabaseSlowWarn
+	// or DatabaseSlowError, with their EXPLAIN plan if DatabaseExplainSlow is set.
+	DatabaseDriver      string        `env:"DATABASE_DRIVER" envDefault:"mysql"`
+	DatabaseDSN         string        `env:"DATABASE_DSN" secret:"true"`
+	DatabaseSlowWarn    time.Duration `env:"DATABASE_SLOW_WARN" envDefault:"100ms"`
+	DatabaseSlowError   time.Duration `env:"DATABASE_SLOW_ERROR" envDefault:"1s"`
+	DatabaseExplainSlow bool          `env:"DATABASE_EXPLAIN_SLOW"`
+	TokenAccessTTL      time.Duration `env:"TOKEN_ACCESS_TTL" envDefault:"15m"`
+	TokenRefreshTTL     time.Duration `env:"TOKEN_REFRESH_TTL" envDefault:"720h"`
+
+	SessionIdleTimeout     time.Duration `env:"SESSION_IDLE_TIMEOUT" envDefault:"30m"`
+	SessionAbsoluteTimeout time.Duration `env:"SESSION_ABSOLUTE_TIMEOUT" envDefault:"12h"`
+
+	// RedisSlowWarn and RedisSlowError are how long a redis call can take before it is logged at
+	// warn or error; see logging.SlowThresholds.
+	RedisSlowWarn  time.Duration `env:"REDIS_SLOW_WARN" envDefault:"50ms"`
+	RedisSlowError time.Duration `env:"REDIS_SLOW_ERROR" envDefault:"500ms"`
+
+	// JWKSSource is the url or file of a JWKS document. If it is set, tokens signed with RS256,
+	// ES256 or EdDSA by one of its keys are accepted, instead of HS256 tokens signed with
+	// JWTAuthSecret. The keys are reloaded every JWKSRefreshInterval, and when a token has an
+	// unknown kid, at most once per JWKSMinRefetchInterval.
+	JWKSSource             string        `env:"JWKS_SOURCE"`
+	JWKSRefreshInterval    time.Duration `env:"JWKS_REFRESH_INTERVAL" envDefault:"1h"`
+	JWKSMinRefetchInterval time.Duration `env:"JWKS_MIN_REFETCH_INTERVAL" envDefault:"1m"`
+
+	// JWTIssuers, JWTAudiences, JWTLeeway, JWTMaxAge and JWTRequiredClaims decide which tokens are
+	// accepted on protected routes; see auth.ClaimsPolicy.
+	JWTIssuers        []string      `env:"JWT_ISSUERS" envSeparator:","`
+	JWTAudiences      []string      `env:"JWT_AUDIENCES" envSeparator:","`
+	JWTLeeway         time.Duration `env:"JWT_LEEWAY" envDefault:"1m"`
+	JWTMaxAge         time.Duration `env:"JWT_MAX_AGE"`
+	JWTRequiredClaims []string      `env:"JWT_REQUIRED_CLAIMS" envSeparator:","`
+
+	// JWTClaimMapping overrides which claims the principal is read from, with entries such as
+	// roles=realm_access.roles; see identity.ParseClaimMapping.
+	JWTClaimMapping []string `env:"JWT_CLAIM_MAPPING" envSeparator:","`
+
+	// ProtectedScopes are the scopes a token must have to use the protected routes.
+	ProtectedScopes []string `env:"PROTECTED_SCOPES" envSeparator:","`
+
+	// MultiTenant serves several tenants, read from the subdomain of TenantDomain, the TenantHeader or
+	// the token; see router.WithTenants.
+	MultiTenant  bool   `env:"MULTI_TENANT"`
+	TenantDomain string `env:"TENANT_DOMAIN"`
+	TenantHeader string `env:"TENANT_HEADER" envDefault:"X-Tenant-Id"`
+
+	// SecurityHeaders is the preset of security headers set on every response, api or html, or none
+	// to set none; see middleware.APISecurityHeaders. HSTSMaxAge and ContentSecurityPolicy override
+	// the preset. CSPReportOnly reports violations of the policy to CSPReportURI without blocking
+	// them.
+	SecurityHeaders       string        `env:"SECURITY_HEADERS" envDefault:"api"`
+	HSTSMaxAge            time.Duration `env:"HSTS_MAX_AGE"`
+	ContentSecurityPolicy string        `env:"CONTENT_SECURITY_POLICY"`
+	CSPReportOnly         bool          `env:"CSP_REPORT_ONLY"`
+	CSPReportURI          string        `env:"CSP_REPORT_URI" envDefault:"/csp-report"`
+
+	// AuditRecentEvents is how many of the most recent audit events are kept in memory for the
+	// /audit-events endpoint of the admin listener. Every event is also written to LOG_AUDIT_FILE.
+	AuditRecentEvents int `env:"AUDIT_RECENT_EVENTS" envDefault:"1000"`
+
+	// APIKeyTouchInterval is how often the last use of an API key is recorded.
+	APIKeyTouchInterval time.Duration `env:"API_KEY_TOUCH_INTERVAL" envDefault:"1m"`
+
+	// RedactKeys, RedactPatterns and RedactHeaders add to the default redaction policy; see
+	// redact.Options. Patterns are separated by semicolons, since they may contain commas.
+	RedactKeys     []string `env:"REDACT_KEYS" envSeparator:","`
+	RedactPatterns []string `env:"REDACT_PATTERNS" envSeparator:";"`
+	RedactHeaders  []string `env:"REDACT_HEADERS" envSeparator:","`
+
+	// CapturePaths always have their request and response bodies logged, and CaptureToken lets a
+	// caller ask for it on any request with the X-Debug-Capture header; see
+	// middleware.CaptureBodies.
+	CapturePaths        []string `env:"CAPTURE_PATHS" envSeparator:","`
+	CaptureToken        string   `env:"CAPTURE_TOKEN" secret:"true"`
+	CaptureMaxBytes     int      `env:"CAPTURE_MAX_BYTES" envDefault:"4096"`
+	CaptureContentTypes []string `env:"CAPTURE_CONTENT_TYPES" envSeparator:","`
+
+	// LogLevelSignalTTL is how long SIGUSR1 switches the log level to debug for.
+	LogLevelSignalTTL time.Duration `env:"LOG_LEVEL_SIGNAL_TTL" envDefault:"15m"`
+
+	// AdminListenAddress serves operational endpoints, such as /metrics and pprof, away from the
+	// public API. If it is empty, there is no admin listener and /metrics is served by the API
+	// listener instead. Admin requests need the AdminToken, or a client certificate signed by
+	// AdminClientCAFile, which requires the admin listener to use TLS.
+	AdminListenAddress string `env:"ADMIN_LISTEN_ADDRESS"`
+	AdminToken         string `env:"ADMIN_TOKEN" secret:"true"`
+	AdminTLSCertFile   string `env:"ADMIN_TLS_CERT_FILE"`
+	AdminTLSKeyFile    string `env:"ADMIN_TLS_KEY_FILE"`
+	AdminClientCAFile  string `env:"ADMIN_CLIENT_CA_FILE"`
+
+	TracePropagationB3 bool          `env:"TRACE_PROPAGATION_B3"`
+	OTLPEndpoint       string        `env:"OTLP_ENDPOINT"`
+	TraceSampleRatio   float64       `env:"TRACE_SAMPLE_RATIO" envDefault:"1"`
+	TraceQueueSize     int           `env:"TRACE_QUEUE_SIZE" envDefault:"2048"`
+	TraceBatchSize     int           `env:"TRACE_BATCH_SIZE" envDefault:"512"`
+	TraceBatchTimeout  time.Duration `env:"TRACE_BATCH_TIMEOUT" envDefault:"5s"`
+
+	// ConcurrencyMaxLimit and ConcurrencyLatencyThreshold bound the concurrency limit of each route
+	// group of the API; see router.WithConcurrencyLimit and middleware.ConcurrencyLimitOptions. They
+	// are reloaded; see middleware.ConcurrencyLimits.
+	ConcurrencyInitialLimit     int           `env:"CONCURRENCY_INITIAL_LIMIT" envDefault:"20"`
+	ConcurrencyMaxLimit         int           `env:"CONCURRENCY_MAX_LIMIT" envDefault:"1000" reload:"true"`
+	ConcurrencyLatencyThreshold time.Duration `env:"CONCURRENCY_LATENCY_THRESHOLD" envDefault:"500ms" reload:"true"`
 }
 
 func main() {
@@ -41,25 +189,62 @@ func main() {
 	}()
 
 	var c config
-	err = env.Load(&c)
-	log := logging.Initialize(c.Config)
+	sources, err := env.Load(&c)
+	log, levels, logErr := logging.Initialize(c.Config)
+
+	defer log.Sync() // nolint
 
 	if err != nil {
 		log.Error("error initializing environment", zap.Error(err))
 		return
 	}
 
+	if err = logErr; err != nil {
+		log.Error("error initializing log outputs", zap.Error(err))
+		return
+	}
+
 	log.Info("initializing")
 
-	nr, err := startNewRelic(c)
+	defer levels.HandleSignals(c.LogLevelSignalTTL)()
+
+	auditLog := logging.NewAuditLogger(c.Config)
+	defer auditLog.Sync() // nolint
+
+	auditEvents := audit.NewMemory(c.AuditRecentEvents)
+	auditor := audit.New(audit.LogSink{Log: auditLog}, auditEvents)
+
+	policy, err := redact.New(redact.Options{
+		Keys:     c.RedactKeys,
+		Patterns: c.RedactPatterns,
+		Headers:  c.RedactHeaders,
+	})
+	if err != nil {
+		log.Error("error creating redaction policy", zap.Error(err))
+		return
+	}
+
+	app, err := startInstrumentation(c, log)
 	if err != nil {
-		log.Error("error creating newrelic app", zap.Error(err))
+		log.Error("error creating instrumentation app", zap.Error(err))
 		return
 	}
-	// Give new relic 30 seconds to send instrumentation before terminating.
-	defer nr.Shutdown(30 * time.Second)
+	// Give the instrumentation 30 seconds to send data before terminating.
+	defer app.Shutdown(30 * time.Second)
+
+	tracer := startTracer(c, log)
+	if tracer != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := tracer.Shutdown(ctx); err != nil {
+				log.Error("error flushing spans", zap.Error(err))
+			}
+		}()
+	}
 
-	jwtAuth := jwtauth.New("HS256", []byte(c.JWTAuthSecret), nil)
+	hmac := auth.NewSwappableVerifier(auth.NewHMACVerifier([]byte(c.JWTAuthSecret)))
 
 	rc := redis.NewClient(&redis.Options{
 		Addr: c.RedisAddress,
@@ -71,16 +256,342 @@ func main() {
 		return
 	}
 
-	appCache := cache.New(rc)
+	reg := metrics.NewRegistry()
+	reg.RegisterRuntime()
+
+	appCache := cache.New(rc, cache.LoggerHook{
+		Slow: logging.SlowThresholds{Warn: c.RedisSlowWarn, Error: c.RedisSlowError},
+	}, cache.NewMetricsHook(reg))
 
 	h := handler.New(appCache)
 
-	r := router.NewRouter(h, log, nr, jwtAuth, c.BuildGitTag, c.CORSOrigin)
+	apiKeys := auth.NewAPIKeys(cache.NewAPIKeyStore(appCache))
+	apiKeys.TouchInterval = c.APIKeyTouchInterval
+
+	tokenStore := cache.NewTokenStore(appCache)
+
+	var users *testdb.DB
+
+	if c.DatabaseDSN != "" {
+		users, err = openDatabase(c, reg)
+		if err != nil {
+			log.Error("error connecting to database", zap.Error(err))
+			return
+		}
+	}
+
+	claimMapping, err := identity.ParseClaimMapping(c.JWTClaimMapping)
+	if err != nil {
+		log.Error("error parsing claim mapping", zap.Error(err))
+		return
+	}
+
+	corsOptions, err := loadCORSOptions(c)
+	if err != nil {
+		log.Error("error parsing cors policy", zap.Error(err))
+		return
+	}
+
+	cors := middleware.NewCORSHandler(corsOptions)
+	limits := middleware.NewConcurrencyLimits(c.ConcurrencyMaxLimit, c.ConcurrencyLatencyThreshold)
+	features := feature.New(c.Features...)
+
+	opts := []router.Option{
+		router.WithConcurrencyLimit(middleware.ConcurrencyLimitOptions{
+			InitialLimit: c.ConcurrencyInitialLimit,
+			Limits:       limits,
+		}),
+		router.WithFeatures(features),
+		router.WithTracePropagation(tracing.Propagator{B3: c.TracePropagationB3}),
+		router.WithTracer(tracer),
+		router.WithMetrics(reg),
+		router.WithRedaction(policy),
+		router.WithAuditor(auditor),
+		router.WithClaimMapping(claimMapping),
+		router.WithAPIKeys(apiKeys),
+		router.WithRevocationList(tokenStore),
+		router.WithClaimsPolicy(auth.ClaimsPolicy{
+			Issuers:   c.JWTIssuers,
+			Audiences: c.JWTAudiences,
+			Leeway:    c.JWTLeeway,
+			MaxAge:    c.JWTMaxAge,
+			Required:  c.JWTRequiredClaims,
+		}),
+	}
+
+	securityHeaders, err := loadSecurityHeaders(c)
+	if err != nil {
+		log.Error("error loading security headers", zap.Error(err))
+		return
+	}
+
+	if securityHeaders != nil {
+		opts = append(opts, router.WithSecurityHeaders(*securityHeaders))
+	}
+
+	if len(c.ProtectedScopes) > 0 {
+		opts = append(opts, router.WithRequiredScopes(c.ProtectedScopes...))
+	}
+
+	if c.MultiTenant {
+		opts = append(opts, router.WithTenants(middleware.TenantOptions{
+			Domain: c.TenantDomain,
+			Header: c.TenantHeader,
+		}))
+	}
+
+	if c.AdminListenAddress == "" {
+		opts = append(opts, router.WithMetricsEndpoint(reg))
+	}
+
+	if len(c.CapturePaths) > 0 || c.CaptureToken != "" {
+		opts = append(opts, router.WithBodyCapture(middleware.CaptureOptions{
+			BodyCapture: httputil.BodyCapture{
+				MaxBytes:     c.CaptureMaxBytes,
+				ContentTypes: c.CaptureContentTypes,
+			},
+			Paths: c.CapturePaths,
+			Token: c.CaptureToken,
+		}))
+	}
+
+	if c.JWKSSource != "" {
+		var keys *auth.KeySet
+
+		keys, err = auth.NewKeySet(context.Background(), auth.KeySetOptions{
+			Source:             c.JWKSSource,
+			RefreshInterval:    c.JWKSRefreshInterval,
+			MinRefetchInterval: c.JWKSMinRefetchInterval,
+			Client:             &http.Client{Timeout: 10 * time.Second},
+			Log:                log,
+		})
+		if err != nil {
+			log.Error("error loading jwks", zap.Error(err))
+			return
+		}
+
+		defer keys.Start()()
+
+		opts = append(opts, router.WithTokenVerifier(auth.NewKeySetVerifier(keys)))
+	} else {
+		opts = append(opts, router.WithTokenVerifier(hmac))
+	}
+
+	if users != nil {
+		sessions := auth.NewSessions(cache.NewSessionStore(appCache), auth.SessionOptions{
+			IdleTimeout:     c.SessionIdleTimeout,
+			AbsoluteTimeout: c.SessionAbsoluteTimeout,
+		})
+
+		opts = append(opts, router.WithSessions(handler.NewSessions(sessions, users, c.ProtectedScopes), sessions))
+	}
+
+	var issuer *auth.TokenIssuer
+
+	switch {
+	case users == nil:
+	case c.JWKSSource != "":
+		// Only the JWKS keys are trusted, and we can not sign with them.
+		log.Info("token endpoints disabled, since tokens are verified with JWKS_SOURCE")
+	default:
+		issuer = auth.NewTokenIssuer(auth.TokenIssuerOptions{
+			Key:        []byte(c.JWTAuthSecret),
+			Issuer:     firstOrEmpty(c.JWTIssuers),
+			Audience:   c.JWTAudiences,
+			Scopes:     c.ProtectedScopes,
+			AccessTTL:  c.TokenAccessTTL,
+			RefreshTTL: c.TokenRefreshTTL,
+			Users:      users,
+			Refresh:    tokenStore,
+			Revoked:    tokenStore,
+		})
+
+		opts = append(opts, router.WithTokens(handler.NewTokens(issuer)))
+	}
+
+	// Every token is checked by a verifier, so the router needs no jwtauth.JWTAuth.
+	r := router.NewRouter(h, log, app, nil, c.BuildGitTag, cors, opts...)
+
+	reloader := env.NewReloader(&c, sources, log)
+	reloader.Subscribe(func(current interface{}, changes env.Changes) {
+		nc := current.(*config)
+
+		if changes.Has("LOG_LEVEL") {
+			var level zapcore.Level
+			level.UnmarshalText([]byte(nc.LogLevel)) // nolint
+
+			levels.SetLevel(level, 0, "config reload")
+		}
+
+		if changes.Has("CORS_ORIGIN", "CORS_ROUTES", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS",
+			"CORS_EXPOSED_HEADERS", "CORS_ALLOW_CREDENTIALS", "CORS_MAX_AGE") {
+			// The config was validated, so the policies are valid.
+			o, _ := loadCORSOptions(*nc)
+			cors.Update(o)
+		}
+
+		if changes.Has("CONCURRENCY_MAX_LIMIT", "CONCURRENCY_LATENCY_THRESHOLD") {
+			limits.Set(nc.ConcurrencyMaxLimit, nc.ConcurrencyLatencyThreshold)
+		}
+
+		if changes.Has("FEATURES") {
+			features.Set(nc.Features...)
+		}
+
+		if changes.Has("JWT_AUTH_SECRET") {
+			hmac.Swap(auth.NewHMACVerifier([]byte(nc.JWTAuthSecret)))
+
+			if issuer != nil {
+				issuer.SetKey([]byte(nc.JWTAuthSecret))
+			}
+		}
+	})
+
+	defer reloader.HandleSignals()()
+
+	if c.ConfigWatchInterval > 0 {
+		defer reloader.Watch(c.ConfigWatchInterval)()
+	}
+
+	if c.AdminListenAddress != "" {
+		err = startAdminServer(c, reloader, log, levels, r, reg, apiKeys, auditor, auditEvents)
+		if err != nil {
+			log.Error("error starting admin server", zap.Error(err))
+			return
+		}
+	}
+
+	err = startHTTPServer(r, log, c.ListenAddress, nil)
+}
+
+// Validate checks the settings that depend on each other; see env.Validator.
+func (c config) Validate() error {
+	var errs env.Errors
+
+	if c.JWKSSource == "" && c.JWTAuthSecret == "" {
+		errs = append(errs, errors.New("either JWKS_SOURCE or JWT_AUTH_SECRET is required"))
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("invalid LOG_LEVEL: %w", err))
+	}
+
+	if c.DatabaseDSN != "" && !c.MultiTenant {
+		errs = append(errs, errors.New("MULTI_TENANT is required with DATABASE_DSN, since the users table is scoped to tenants"))
+	}
+
+	if c.AdminTLSCertFile != "" && c.AdminTLSKeyFile == "" {
+		errs = append(errs, errors.New("ADMIN_TLS_KEY_FILE is required with ADMIN_TLS_CERT_FILE"))
+	}
+
+	if _, err := loadCORSOptions(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := loadSecurityHeaders(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// openDatabase connects to the database of users, logging and measuring every statement.
+func openDatabase(c config, reg *metrics.Registry) (*testdb.DB, error) {
+	conn, err := sqlx.Open(c.DatabaseDriver, c.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.New(conn)
+	if err != nil {
+		conn.Close() // nolint
+		return nil, err
+	}
+
+	logger := testdb.Logger{
+		Slow: logging.SlowThresholds{Warn: c.DatabaseSlowWarn, Error: c.DatabaseSlowError},
+	}
+
+	if c.DatabaseExplainSlow {
+		logger.Explain = testdb.SQLExplainer{DB: conn.DB}
+	}
+
+	return testdb.New(db, logger, testdb.NewMetrics(reg))
+}
+
+// firstOrEmpty returns the first of the values, or an empty string if there are none.
+func firstOrEmpty(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// loadCORSOptions returns the CORS policies of the config.
+func loadCORSOptions(c config) (middleware.CORSOptions, error) {
+	p := middleware.CORSPolicy{
+		AllowedOrigins:   c.CORSOrigins,
+		AllowedMethods:   c.CORSAllowedMethods,
+		AllowedHeaders:   c.CORSAllowedHeaders,
+		ExposedHeaders:   c.CORSExposedHeaders,
+		AllowCredentials: c.CORSAllowCredentials,
+		MaxAge:           c.CORSMaxAge,
+	}
+
+	routes, err := middleware.ParseCORSRoutes(p, c.CORSRoutes)
+	if err != nil {
+		return middleware.CORSOptions{}, err
+	}
+
+	o := middleware.CORSOptions{Default: p, Routes: routes}
+
+	return o, o.Validate()
+}
+
+// loadSecurityHeaders returns the security headers of the preset of the config, with its
+// overrides, or nil if the preset is none.
+func loadSecurityHeaders(c config) (*middleware.SecurityHeaderOptions, error) {
+	var o middleware.SecurityHeaderOptions
+
+	switch c.SecurityHeaders {
+	case "api":
+		o = middleware.APISecurityHeaders()
+	case "html":
+		o = middleware.HTMLSecurityHeaders()
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown security headers preset %q: expected api, html or none", c.SecurityHeaders)
+	}
+
+	if c.HSTSMaxAge > 0 {
+		o.HSTSMaxAge = c.HSTSMaxAge
+	}
+
+	if c.ContentSecurityPolicy != "" {
+		o.ContentSecurityPolicy = c.ContentSecurityPolicy
+	}
+
+	o.CSPReportOnly = c.CSPReportOnly
+	o.CSPReportURI = c.CSPReportURI
 
-	err = startHTTPServer(r, log, c.ListenAddress)
+	return &o, nil
 }
 
-func startNewRelic(c config) (newrelic.Application, error) {
+// startInstrumentation reports to New Relic if a license is configured. Otherwise, nothing is
+// reported, which is useful for local and offline runs.
+func startInstrumentation(c config, log *zap.Logger) (instrumentation.Application, error) {
+	if c.NewRelicLicense == "" {
+		log.Info("no new relic license, instrumentation disabled")
+		return instrumentation.Noop(), nil
+	}
+
 	nr, err := newrelic.NewApplication(newrelic.Config{
 		AppName: fmt.Sprintf("%s-%s", c.AppName, c.Environment),
 		Labels: map[string]string{
@@ -94,15 +605,100 @@ func startNewRelic(c config) (newrelic.Application, error) {
 		return nil, err
 	}
 
-	err = nr.WaitForConnection(30 * time.Second)
-	if err != nil {
-		return nil, err
+	// Waiting is optional; the agent connects in the background and queues data until then.
+	if c.NewRelicConnectTimeout > 0 {
+		err = nr.WaitForConnection(c.NewRelicConnectTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return instrumentation.NewRelic(nr), nil
+}
+
+// startTracer creates a tracer exporting to an OpenTelemetry collector. Tracing is disabled if no
+// OTLP_ENDPOINT is configured.
+func startTracer(c config, log *zap.Logger) *tracing.Tracer {
+	if c.OTLPEndpoint == "" {
+		return nil
+	}
+
+	exporter := tracing.NewOTLPExporter(c.OTLPEndpoint, map[string]string{
+		"service.name":           c.AppName,
+		"service.version":        c.BuildGitTag,
+		"deployment.environment": c.Environment,
+	}, nil)
+
+	return tracing.NewTracer(tracing.TracerOptions{
+		Exporter:     exporter,
+		SampleRatio:  c.TraceSampleRatio,
+		QueueSize:    c.TraceQueueSize,
+		BatchSize:    c.TraceBatchSize,
+		BatchTimeout: c.TraceBatchTimeout,
+		Log:          log,
+	})
+}
+
+// startAdminServer starts the admin listener in the background. It only returns an error if the
+// TLS config is invalid; errors while serving are logged.
+func startAdminServer(c config, reloader *env.Reloader, log *zap.Logger, levels *logging.Levels, api http.Handler, reg *metrics.Registry, keys *auth.APIKeys, auditor *audit.Auditor, events audit.Store) error {
+	var tlsConfig *tls.Config
+
+	if c.AdminTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.AdminTLSCertFile, c.AdminTLSKeyFile)
+		if err != nil {
+			return err
+		}
+
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+		if c.AdminClientCAFile != "" {
+			pem, err := ioutil.ReadFile(c.AdminClientCAFile)
+			if err != nil {
+				return err
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in %s", c.AdminClientCAFile)
+			}
+
+			// Certificates are optional, so the token can still be used.
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	if c.AdminToken == "" && tlsConfig == nil {
+		log.Warn("admin listener has no token or client certificates configured; all requests will be rejected")
 	}
 
-	return nr, err
+	// The dump shows the current config, including any reloaded values.
+	dump := func() map[string]env.Value {
+		return env.Dump(reloader.Current(), reloader.Sources())
+	}
+
+	h := handler.NewAdmin(api, dump, handler.BuildInfo{
+		Version: c.BuildGitTag,
+		GitHash: c.BuildGitHash,
+		Date:    c.BuildDate,
+	}, levels, keys, events)
+
+	admin := router.NewAdminRouter(h, log, c.AdminToken, reg, auditor)
+
+	go func() {
+		if err := startHTTPServer(admin, log, c.AdminListenAddress, tlsConfig); err != nil {
+			log.Error("error running admin server", zap.Error(err))
+		}
+	}()
+
+	return nil
 }
 
-func startHTTPServer(h http.Handler, log *zap.Logger, serverAddr string) error {
+func startHTTPServer(h http.Handler, log *zap.Logger, serverAddr string, tlsConfig *tls.Config) error {
 	httpServer := &http.Server{
 		Addr:    serverAddr,
 		Handler: h,
@@ -114,6 +710,10 @@ func startHTTPServer(h http.Handler, log *zap.Logger, serverAddr string) error {
 		return err
 	}
 
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
 	log.Info("starting server", zap.String("addr", serverAddr))
 
 	// Start the http server.
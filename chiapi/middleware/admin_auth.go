@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// AdminAuth allows a request through if it presents a client certificate that was verified by the
+// server, or if token is not empty and the request has the header "Authorization: Bearer <token>".
+// Everything else is rejected with a 401, so an admin listener with neither configured is closed to
+// everyone. Each allowed request is logged with who made it, and who made it is added to the request
+// context; see identity.FromContext. Allowed and rejected requests are recorded as audit events. The
+// param unauthorized should be a request handler to render your 401 response. If it is nil, a simple
+// default response will be written.
+func AdminAuth(token string, unauthorized http.Handler) func(next http.Handler) http.Handler {
+	unauthorized = defaultUnauthorized(unauthorized)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := adminPrincipal(r, token)
+			if !ok {
+				audit.Record(r.Context(), audit.Event{
+					Type:    audit.TypeAuthentication,
+					Outcome: audit.OutcomeFailure,
+					Reason:  auth.ReasonInvalidToken,
+					Details: map[string]string{"listener": "admin"},
+				})
+
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				unauthorized.ServeHTTP(w, r)
+				return
+			}
+
+			logging.FromContext(r.Context()).Info("admin access",
+				zap.String("principal", principal.ID()),
+				zap.String("auth_method", principal.AuthMethod),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+			)
+
+			r = r.WithContext(identity.WithPrincipal(r.Context(), principal))
+
+			audit.Record(r.Context(), audit.Event{
+				Type:    audit.TypeAuthentication,
+				Outcome: audit.OutcomeSuccess,
+				Details: map[string]string{"listener": "admin"},
+			})
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// adminPrincipal returns who is making the request, either the subject of their verified client
+// certificate or "token".
+func adminPrincipal(r *http.Request, token string) (identity.Principal, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return identity.Principal{
+			Subject:    "cert:" + r.TLS.VerifiedChains[0][0].Subject.String(),
+			AuthMethod: identity.AuthMethodClientCert,
+		}, true
+	}
+
+	if token == "" {
+		return identity.Principal{}, false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return identity.Principal{}, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+		return identity.Principal{}, false
+	}
+
+	return identity.Principal{Subject: "token", AuthMethod: identity.AuthMethodAdminToken}, true
+}
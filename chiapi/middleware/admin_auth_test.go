@@ -0,0 +1,59 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+)
+
+func TestAdminAuth(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		cert   bool
+		status int
+	}{
+		{name: "valid token", token: "s3cret", header: "Bearer s3cret", status: 200},
+		{name: "wrong token", token: "s3cret", header: "Bearer nope", status: 401},
+		{name: "missing header", token: "s3cret", status: 401},
+		{name: "no token configured", header: "Bearer ", status: 401},
+		{name: "verified client certificate", cert: true, status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://example.com/routes", nil)
+
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			if tt.cert {
+				r.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ops"}}}},
+				}
+			}
+
+			middleware.AdminAuth(tt.token, nil)(h).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+
+			if tt.status == 401 {
+				assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// APIKeyAuthenticator returns the principal for an API key, such as an auth.APIKeys.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (identity.Principal, error)
+}
+
+// APIKey authenticates requests with an API key in the X-Api-Key header, adding its principal to the
+// request context. Requests without the header are passed through, so a JWT can be used instead;
+// Authenticator, ValidateClaims and User skip requests authenticated with an API key. Rejected keys
+// get a 401 with a WWW-Authenticate challenge, like rejected tokens. Keys that can not be checked,
+// such as when their store is down, get a 503. Every use of a key is recorded as an audit event. The
+// param unauthorized should be a request handler to render your 401 response, and unavailable your
+// 503 response. If either is nil, a simple default response will be written.
+func APIKey(keys APIKeyAuthenticator, unauthorized, unavailable http.Handler) func(next http.Handler) http.Handler {
+	unauthorized = defaultUnauthorized(unauthorized)
+	unavailable = defaultUnavailable(unavailable)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(auth.APIKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, err := keys.Authenticate(r.Context(), key)
+			if err != nil {
+				rejectCredentials(w, r, unauthorized, unavailable, identity.AuthMethodAPIKey, err)
+				return
+			}
+
+			logging.AddRequestFields(r.Context(), auth.PrincipalFields(p)...)
+
+			ctx := identity.WithPrincipal(r.Context(), p)
+			audit.Record(ctx, audit.Event{
+				Type:     audit.TypeAPIKeyUse,
+				Outcome:  audit.OutcomeSuccess,
+				Resource: p.TokenID,
+			})
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// preauthenticated returns true if the request was authenticated by APIKey or Session, so the token
+// middleware should skip it.
+func preauthenticated(r *http.Request) bool {
+	p, ok := identity.PrincipalFromContext(r.Context())
+	return ok && (p.AuthMethod == identity.AuthMethodAPIKey || p.AuthMethod == identity.AuthMethodSession)
+}
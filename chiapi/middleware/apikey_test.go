@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestAPIKey(t *testing.T) {
+	keys := auth.NewAPIKeys(auth.NewMemoryAPIKeyStore())
+
+	_, key, err := keys.Issue(context.Background(), auth.APIKeyRequest{Owner: "svc-ci", Scopes: []string{"read"}})
+	require.NoError(t, err)
+
+	var got identity.Principal
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = identity.PrincipalFromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	// The API key is checked first, and the token middleware skips requests it authenticated.
+	mw := middleware.APIKey(keys, nil, nil)(
+		middleware.Authenticator(nil, nil, nil)(
+			middleware.ValidateClaims(auth.ClaimsPolicy{Required: []string{"email"}}, nil)(
+				middleware.User(identity.DefaultClaimMapping)(h))))
+
+	serve := func(key string, tok *jwt.Token) *httptest.ResponseRecorder {
+		got = identity.Principal{}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com", nil)
+		r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
+
+		if key != "" {
+			r.Header.Set("X-Api-Key", key)
+		}
+
+		mw.ServeHTTP(w, r)
+
+		return w
+	}
+
+	t.Run("valid key", func(t *testing.T) {
+		w := serve(key, nil)
+
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "svc-ci", got.ID())
+		assert.Equal(t, identity.AuthMethodAPIKey, got.AuthMethod)
+		assert.True(t, got.HasScope("read"))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		w := serve(key+"0", nil)
+
+		assert.Equal(t, 401, w.Code)
+		assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="api key is invalid"`, w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("no key uses the token", func(t *testing.T) {
+		w := serve("", &jwt.Token{Valid: true, Claims: jwt.MapClaims{"sub": "rick", "email": "rick@example.com"}})
+
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "rick", got.ID())
+		assert.Equal(t, identity.AuthMethodJWT, got.AuthMethod)
+	})
+
+	t.Run("no key or token", func(t *testing.T) {
+		assert.Equal(t, 401, serve("", nil).Code)
+	})
+}
+
+// brokenAPIKeys fails every lookup, like API keys whose store is down.
+type brokenAPIKeys struct{}
+
+func (brokenAPIKeys) Authenticate(ctx context.Context, key string) (identity.Principal, error) {
+	return identity.Principal{}, errors.New("connection refused")
+}
+
+func TestAPIKey_Unavailable(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.Header.Set("X-Api-Key", "my-key")
+
+	middleware.APIKey(brokenAPIKeys{}, nil, nil)(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 503, w.Code)
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+)
+
+// Audit adds the auditor, and the ip address of the client, to the request context, so the
+// authentication and authorization middleware, and the handlers, can record audit events; see
+// audit.Record.
+func Audit(a *audit.Auditor) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := audit.NewContext(r.Context(), a)
+			ctx = audit.WithClientIP(ctx, clientIP(r))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// clientIP returns the ip address of the client, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
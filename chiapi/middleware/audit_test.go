@@ -0,0 +1,40 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func TestAudit(t *testing.T) {
+	events := audit.NewMemory(10)
+
+	h := middleware.Audit(audit.New(events))(middleware.Authenticator(nil, nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, 401, w.Code)
+
+	recorded, err := events.Events(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+
+	require.Len(t, recorded, 1)
+	assert.Equal(t, audit.TypeAuthentication, recorded[0].Type)
+	assert.Equal(t, audit.OutcomeFailure, recorded[0].Outcome)
+	assert.Equal(t, auth.ReasonInvalidToken, recorded[0].Reason)
+	assert.Equal(t, "192.0.2.1", recorded[0].ClientIP)
+}
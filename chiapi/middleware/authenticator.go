@@ -1,38 +1,90 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/jwtauth"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
 )
 
-// Authenticator is used to verify a valid token is on the request. The param unauthorized should be
-// a request handler to render your 401 response. If it is nil, a simple default response will be
-// written.
-func Authenticator(unauthorized http.Handler) func(next http.Handler) http.Handler {
-	if unauthorized == nil {
-		unauthorized = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.Header().Set("X-Content-Type-Options", "nosniff")
-			w.WriteHeader(http.StatusUnauthorized)
-			fmt.Fprintln(w, "unauthorized")
-		})
+// Realm is the realm of the WWW-Authenticate challenge sent with API 401 responses.
+const Realm = "api"
+
+func defaultUnauthorized(unauthorized http.Handler) http.Handler {
+	if unauthorized != nil {
+		return unauthorized
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "unauthorized")
+	})
+}
+
+func defaultUnavailable(unavailable http.Handler) http.Handler {
+	if unavailable != nil {
+		return unavailable
 	}
 
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "service unavailable")
+	})
+}
+
+// Authenticator is used to verify a valid token is on the request. The param unauthorized should be
+// a request handler to render your 401 response, and unavailable your 503 response, sent when the
+// token can not be checked, such as when revoked can not be read. If either is nil, a simple default
+// response will be written. Rejected requests get a WWW-Authenticate challenge with the reason,
+// which is also added to the request log; see logging.AddRequestFields. Requests authenticated by
+// APIKey or Session are passed through. If revoked is not nil, tokens whose jti claim is in it are
+// rejected.
+func Authenticator(unauthorized, unavailable http.Handler, revoked auth.RevocationList) func(next http.Handler) http.Handler {
+	unauthorized = defaultUnauthorized(unauthorized)
+	unavailable = defaultUnavailable(unavailable)
+
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			if preauthenticated(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			token, _, err := jwtauth.FromContext(r.Context())
 			if err != nil {
-				unauthorized.ServeHTTP(w, r)
+				rejectToken(w, r, unauthorized, identity.AuthMethodJWT, tokenError(err), err)
 				return
 			}
 
 			if token == nil || !token.Valid {
-				unauthorized.ServeHTTP(w, r)
+				rejectToken(w, r, unauthorized, identity.AuthMethodJWT, &auth.Error{
+					Reason:      auth.ReasonInvalidToken,
+					Description: "token is invalid",
+				}, nil)
 				return
 			}
 
+			if revoked != nil {
+				if err := checkRevoked(r, revoked, token); err != nil {
+					rejectCredentials(w, r, unauthorized, unavailable, identity.AuthMethodJWT, err)
+					return
+				}
+			}
+
 			// Token is authenticated, pass it through
 			next.ServeHTTP(w, r)
 		}
@@ -40,3 +92,144 @@ func Authenticator(unauthorized http.Handler) func(next http.Handler) http.Handl
 		return http.HandlerFunc(fn)
 	}
 }
+
+// ValidateClaims rejects requests whose token claims are not accepted by the policy, with a 401 and
+// a WWW-Authenticate challenge with the reason, which is also added to the request log. Use it after
+// Authenticator, on the routes the policy applies to; requests authenticated by APIKey or Session
+// have no claims, and are passed through. The param unauthorized should be a request handler to
+// render your 401 response. If it is nil, a simple default response will be written.
+func ValidateClaims(p auth.ClaimsPolicy, unauthorized http.Handler) func(next http.Handler) http.Handler {
+	unauthorized = defaultUnauthorized(unauthorized)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if preauthenticated(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, claims, _ := jwtauth.FromContext(r.Context())
+
+			if err := p.Validate(claims, time.Now()); err != nil {
+				rejectToken(w, r, unauthorized, identity.AuthMethodJWT, tokenError(err), nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// checkRevoked returns an *auth.Error if the jti claim of the token has been revoked. If the list
+// cannot be checked, its error is returned, so the request fails closed; see rejectCredentials.
+func checkRevoked(r *http.Request, revoked auth.RevocationList, token *jwt.Token) error {
+	claims, _ := token.Claims.(jwt.MapClaims)
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil
+	}
+
+	isRevoked, err := revoked.IsRevoked(r.Context(), jti)
+	if err != nil {
+		return err
+	}
+
+	if isRevoked {
+		return &auth.Error{Reason: auth.ReasonRevoked, Description: "token is revoked"}
+	}
+
+	return nil
+}
+
+// tokenError turns an error from verifying or validating a token into the reason it was rejected.
+// The details of signature and parsing errors are not shown to the caller.
+func tokenError(err error) *auth.Error {
+	switch e := err.(type) {
+	case *auth.Error:
+		return e
+	}
+
+	switch err {
+	case jwtauth.ErrNoTokenFound:
+		return &auth.Error{Reason: auth.ReasonMissingToken}
+	case jwtauth.ErrExpired:
+		return &auth.Error{Reason: auth.ReasonExpired, Description: "token is expired"}
+	}
+
+	return &auth.Error{Reason: auth.ReasonInvalidToken, Description: "token is invalid"}
+}
+
+// rejectCredentials sends the 401 challenge if err is an *auth.Error, since the credentials were
+// rejected. Any other error means they could not be checked, such as when their store is down, so
+// the request fails closed with the unavailable response instead, and the client can keep its
+// credentials and try again. The error is logged, and recorded as an audit event with
+// audit.OutcomeError, rather than as a failed authentication.
+func rejectCredentials(w http.ResponseWriter, r *http.Request, unauthorized, unavailable http.Handler, method string, err error) {
+	var e *auth.Error
+	if errors.As(err, &e) {
+		rejectToken(w, r, unauthorized, method, e, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("error checking credentials", zap.String("auth_method", method), zap.Error(err))
+
+	audit.Record(r.Context(), audit.Event{
+		Type:       audit.TypeAuthentication,
+		Outcome:    audit.OutcomeError,
+		AuthMethod: method,
+	})
+
+	unavailable.ServeHTTP(w, r)
+}
+
+// rejectToken sends the 401 challenge for the rejected token, and adds the reason, and the
+// underlying error if there is one, to the request log. The failure is recorded as an audit event,
+// with the auth method that was tried.
+func rejectToken(w http.ResponseWriter, r *http.Request, unauthorized http.Handler, method string, e *auth.Error, cause error) {
+	fields := []zap.Field{zap.String("auth_error", e.Reason)}
+	if e.Description != "" {
+		fields = append(fields, zap.String("auth_error_description", e.Description))
+	}
+
+	if cause != nil && cause.Error() != e.Description {
+		fields = append(fields, zap.NamedError("auth_error_cause", cause))
+	}
+
+	logging.AddRequestFields(r.Context(), fields...)
+
+	event := audit.Event{
+		Type:       audit.TypeAuthentication,
+		Outcome:    audit.OutcomeFailure,
+		Reason:     e.Reason,
+		AuthMethod: method,
+	}
+
+	if e.Description != "" {
+		event.Details = map[string]string{"description": e.Description}
+	}
+
+	audit.Record(r.Context(), event)
+
+	w.Header().Set("WWW-Authenticate", challenge(e))
+	unauthorized.ServeHTTP(w, r)
+}
+
+// challenge formats the WWW-Authenticate header for the rejected token, as described in RFC 6750. A
+// request without a token only gets the realm.
+func challenge(e *auth.Error) string {
+	c := fmt.Sprintf("Bearer realm=%q", Realm)
+
+	if e.Reason == auth.ReasonMissingToken {
+		return c
+	}
+
+	return fmt.Sprintf(`%s, error="invalid_token", error_description="%s"`, c, quoteSafe(e.Description))
+}
+
+// quoteSafe removes the characters that cannot appear in a quoted header parameter.
+func quoteSafe(s string) string {
+	return strings.NewReplacer(`"`, "'", `\`, "", "\r", "", "\n", " ").Replace(s)
+}
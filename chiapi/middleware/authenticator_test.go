@@ -1,17 +1,28 @@
 package middleware_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
 )
 
 func TestAuthenticator_MissingToken(t *testing.T) {
@@ -22,7 +33,7 @@ func TestAuthenticator_MissingToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "http://example.com", nil)
 
-	middleware.Authenticator(nil)(h).ServeHTTP(w, r)
+	middleware.Authenticator(nil, nil, nil)(h).ServeHTTP(w, r)
 
 	assert.Equal(t, 401, w.Code)
 }
@@ -41,7 +52,7 @@ func TestAuthenticator_InvalidToken(t *testing.T) {
 	r := httptest.NewRequest("GET", "http://example.com", nil)
 	r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
 
-	middleware.Authenticator(nil)(h).ServeHTTP(w, r)
+	middleware.Authenticator(nil, nil, nil)(h).ServeHTTP(w, r)
 
 	assert.Equal(t, 401, w.Code)
 }
@@ -60,7 +71,139 @@ func TestAuthenticator_ValidToken(t *testing.T) {
 	r := httptest.NewRequest("GET", "http://example.com", nil)
 	r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
 
-	middleware.Authenticator(nil)(h).ServeHTTP(w, r)
+	middleware.Authenticator(nil, nil, nil)(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestAuthenticator_Challenge(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), nil, jwtauth.ErrNoTokenFound))
+
+	middleware.Authenticator(nil, nil, nil)(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Bearer realm="api"`, w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "http://example.com", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), nil, jwtauth.ErrExpired))
+
+	middleware.Authenticator(nil, nil, nil)(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="token is expired"`, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestAuthenticator_Revoked(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	revoked := auth.NewMemoryRevocationList()
+	require.NoError(t, revoked.Revoke(context.Background(), "revoked-jti", time.Now().Add(time.Minute)))
+
+	for jti, code := range map[string]int{"revoked-jti": 401, "other-jti": 200, "": 200} {
+		tok := &jwt.Token{
+			Valid:  true,
+			Claims: jwt.MapClaims{"jti": jti},
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com", nil)
+		r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
+
+		middleware.Authenticator(nil, nil, revoked)(h).ServeHTTP(w, r)
+
+		assert.Equal(t, code, w.Code, jti)
+
+		if code == 401 {
+			assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="token is revoked"`, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+// brokenRevocationList fails every check, like a revocation list whose store is down.
+type brokenRevocationList struct{}
+
+func (brokenRevocationList) Revoke(ctx context.Context, jti string, until time.Time) error {
+	return errors.New("connection refused")
+}
+
+func (brokenRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestAuthenticator_RevocationListUnavailable(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	events := audit.NewMemory(10)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), &jwt.Token{Valid: true, Claims: jwt.MapClaims{"jti": "my-jti"}}, nil))
+
+	middleware.Audit(audit.New(events))(middleware.Authenticator(nil, nil, brokenRevocationList{})(h)).ServeHTTP(w, r)
+
+	// The token is not accepted, but the client is not told to throw it away.
+	assert.Equal(t, 503, w.Code)
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+
+	recorded, err := events.Events(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+
+	require.Len(t, recorded, 1)
+	assert.Equal(t, audit.OutcomeError, recorded[0].Outcome)
+	assert.Equal(t, identity.AuthMethodJWT, recorded[0].AuthMethod)
+}
+
+func TestValidateClaims(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	p := auth.ClaimsPolicy{Issuers: []string{"good"}}
+	mw := chi.NewRouter()
+	mw.Use(middleware.Logger(log))
+	mw.With(middleware.ValidateClaims(p, nil)).Handle("/", h)
+
+	tok := &jwt.Token{
+		Valid:  true,
+		Claims: jwt.MapClaims{"iss": "evil"},
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
+
+	mw.ServeHTTP(w, r)
+
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="issuer 'evil' is not accepted"`, w.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, buf.String(), `"auth_error":"issuer","auth_error_description":"issuer \"evil\" is not accepted"`)
+
+	tok.Claims = jwt.MapClaims{"iss": "good"}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "http://example.com/", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
+
+	mw.ServeHTTP(w, r)
 
 	assert.Equal(t, 200, w.Code)
 }
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+func defaultForbidden(forbidden http.Handler) http.Handler {
+	if forbidden != nil {
+		return forbidden
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		detail := "forbidden"
+		if err, ok := auth.ForbiddenFromContext(r.Context()); ok {
+			detail = err.Error()
+		}
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusForbidden)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint
+			"type":   "about:blank",
+			"title":  http.StatusText(http.StatusForbidden),
+			"status": http.StatusForbidden,
+			"detail": detail,
+		})
+	})
+}
+
+// Authorize rejects requests that the policy denies for the principal on the request context, with
+// no resource; see auth.Authorize. Use it after User. The param forbidden should be a request
+// handler to render your 403 response; the denial is on the request context, see
+// auth.ForbiddenFromContext. If it is nil, a simple problem response will be written.
+func Authorize(p auth.Policy, forbidden http.Handler) func(next http.Handler) http.Handler {
+	forbidden = defaultForbidden(forbidden)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if err := auth.Authorize(r.Context(), p, nil); err != nil {
+				forbidden.ServeHTTP(w, r.WithContext(auth.WithForbidden(r.Context(), err.(*auth.Forbidden))))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireScopes rejects requests whose token does not have every one of the scopes; see Authorize.
+func RequireScopes(forbidden http.Handler, scopes ...string) func(next http.Handler) http.Handler {
+	return Authorize(auth.RequireScopes(scopes...), forbidden)
+}
+
+// RequireRoles rejects requests whose principal has none of the roles; see Authorize.
+func RequireRoles(forbidden http.Handler, roles ...string) func(next http.Handler) http.Handler {
+	return Authorize(auth.RequireRoles(roles...), forbidden)
+}
+
+// LoadRoles adds the roles granted to the principal by the source, such as a database table, to the
+// roles from their token. Use it after User, and before RequireRoles. If the roles cannot be loaded,
+// the error is logged and the request goes on with only the roles from the token.
+func LoadRoles(src auth.RoleSource) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := auth.WithRoles(r.Context(), src)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("error loading roles", zap.Error(err))
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+type roleSource []string
+
+func (s roleSource) Roles(ctx context.Context, p identity.Principal) ([]string, error) {
+	return s, nil
+}
+
+func TestRequireScopes(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	mw := middleware.RequireScopes(nil, "read")(h)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r = r.WithContext(identity.WithPrincipal(r.Context(), identity.Principal{Subject: "user-1", Scopes: []string{"write"}}))
+
+	mw.ServeHTTP(w, r)
+
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"denied by policy scopes:read"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "http://example.com", nil)
+	r = r.WithContext(identity.WithPrincipal(r.Context(), identity.Principal{Subject: "user-1", Scopes: []string{"read"}}))
+
+	mw.ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestRequireRoles_LoadRoles(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r = r.WithContext(identity.WithPrincipal(r.Context(), identity.Principal{Subject: "user-1"}))
+
+	w := httptest.NewRecorder()
+	middleware.RequireRoles(nil, "admin")(h).ServeHTTP(w, r)
+	assert.Equal(t, 403, w.Code)
+
+	w = httptest.NewRecorder()
+	middleware.LoadRoles(roleSource{"admin"})(middleware.RequireRoles(nil, "admin")(h)).ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/httputil"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// DefaultCaptureHeader is the header used to ask for body capture, if CaptureOptions.Header is not
+// set.
+const DefaultCaptureHeader = "X-Debug-Capture"
+
+// CaptureOptions configures the CaptureBodies middleware.
+type CaptureOptions struct {
+	httputil.BodyCapture
+
+	// Paths always have their bodies captured. A path ending with * matches any suffix, so
+	// /protected/* captures every protected route.
+	Paths []string
+	// Token lets a caller ask for capture on any request, by sending it in the Header. If it is
+	// empty, the header is ignored.
+	Token string
+	// Header is the header that carries the Token. It defaults to DefaultCaptureHeader.
+	Header string
+}
+
+// CaptureBodies records the request and response bodies of requests that match one of the Paths, or
+// that carry the debug Token, for debugging. Only the content types allowed by the options are
+// captured, up to the size cap, and the bodies are masked with the redaction policy on the request
+// context. They are added to the "request complete" entry of the Logger middleware, which must be
+// used before this one. Outgoing requests made with the request context, through
+// httputil.LogTransport, are captured too.
+func CaptureBodies(opts CaptureOptions) func(next http.Handler) http.Handler {
+	if opts.Header == "" {
+		opts.Header = DefaultCaptureHeader
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			enabled := opts.enabled(r)
+
+			// Don't pass the token on, or log it.
+			r.Header.Del(opts.Header)
+
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := httputil.WithBodyCapture(r.Context(), opts.BodyCapture)
+			r = r.WithContext(ctx)
+
+			if contentType := r.Header.Get("Content-Type"); opts.Allowed(contentType) {
+				body, truncated, replacement, err := opts.Peek(r.Body)
+				if err != nil {
+					logging.FromContext(ctx).Warn("error capturing request body", zap.Error(err))
+				}
+
+				r.Body = replacement
+
+				logging.AddRequestFields(ctx, httputil.BodyFields(ctx, "request", contentType, body, truncated)...)
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			buf := opts.NewBuffer()
+			ww.Tee(buf)
+
+			next.ServeHTTP(ww, r)
+
+			if contentType := ww.Header().Get("Content-Type"); opts.Allowed(contentType) {
+				logging.AddRequestFields(ctx, httputil.BodyFields(ctx, "response", contentType, buf.Bytes(), buf.Truncated())...)
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (o CaptureOptions) enabled(r *http.Request) bool {
+	for _, p := range o.Paths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(r.URL.Path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if r.URL.Path == p {
+			return true
+		}
+	}
+
+	if o.Token == "" {
+		return false
+	}
+
+	token := r.Header.Get(o.Header)
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(o.Token)) == 1
+}
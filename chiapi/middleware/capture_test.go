@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/httputil"
+)
+
+func TestCaptureBodies(t *testing.T) {
+	var logs bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&logs),
+		zapcore.DebugLevel,
+	))
+
+	r := chi.NewRouter()
+	r.Use(middleware.Logger(log))
+	r.Use(middleware.CaptureBodies(middleware.CaptureOptions{
+		BodyCapture: httputil.BodyCapture{MaxBytes: 64},
+		Paths:       []string{"/always/*"},
+		Token:       "debug-me",
+	}))
+	r.Post("/*", func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		assert.Empty(t, r.Header.Get(middleware.DefaultCaptureHeader))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append([]byte(`{"echo":`), append(body, '}')...)) // nolint
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		token   string
+		capture bool
+	}{
+		{name: "path", path: "/always/1", capture: true},
+		{name: "token", path: "/other", token: "debug-me", capture: true},
+		{name: "wrong token", path: "/other", token: "nope"},
+		{name: "neither", path: "/other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+
+			req := httptest.NewRequest("POST", "http://example.com"+tt.path, strings.NewReader(`{"user":"jane","password":"hunter2"}`))
+			req.Header.Set("Content-Type", "application/json")
+
+			if tt.token != "" {
+				req.Header.Set(middleware.DefaultCaptureHeader, tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			// The handler still gets the whole body.
+			assert.Equal(t, `{"echo":{"user":"jane","password":"hunter2"}}`, w.Body.String())
+
+			out := logs.String()
+
+			if !tt.capture {
+				assert.NotContains(t, out, "request_body")
+				return
+			}
+
+			assert.Contains(t, out, `"request_body":"{\"password\":\"[REDACTED]\",\"user\":\"jane\"}"`)
+			assert.Contains(t, out, `"request_body_truncated":false`)
+			assert.Contains(t, out, `"response_body":"{\"echo\":{\"password\":\"[REDACTED]\",\"user\":\"jane\"}}"`)
+			assert.Contains(t, out, `"response_body_truncated":false`)
+			assert.NotContains(t, out, "hunter2")
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// Priority is used to classify requests when deciding which ones to shed.
+type Priority int
+
+const (
+	// PriorityNormal requests are shed once the concurrency limit has been reached.
+	PriorityNormal Priority = iota
+	// PriorityLow requests are shed first, once the in flight requests reach LowPriorityRatio of the
+	// concurrency limit.
+	PriorityLow
+	// PriorityCritical requests are never shed. Use this for health checks and admin routes.
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	case PriorityCritical:
+		return "critical"
+	}
+
+	return strconv.Itoa(int(p))
+}
+
+// ConcurrencyLimitOptions configures the ConcurrencyLimit middleware. Any zero values will be replaced
+// with sensible defaults.
+type ConcurrencyLimitOptions struct {
+	// InitialLimit is the number of in flight requests allowed before any latency has been observed.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the adaptive limit.
+	MinLimit int
+	MaxLimit int
+	// LatencyThreshold is the request duration above which the limit is considered too high.
+	LatencyThreshold time.Duration
+	// Backoff is the multiplier applied to the limit when a request exceeds the LatencyThreshold.
+	Backoff float64
+	// LowPriorityRatio is the fraction of the limit that low priority requests may use.
+	LowPriorityRatio float64
+	// RetryAfter is sent in the Retry-After header of shed requests.
+	RetryAfter time.Duration
+	// Priority classifies each request. If nil, all requests are PriorityNormal.
+	Priority func(r *http.Request) Priority
+	// Rejected renders the response for shed requests. If nil, a simple default response will be
+	// written.
+	Rejected http.Handler
+	// Limits, if set, overrides MaxLimit and LatencyThreshold, so they can be changed while the
+	// server is running, such as when the config is reloaded.
+	Limits *ConcurrencyLimits
+}
+
+// ConcurrencyLimits are the bounds of ConcurrencyLimit that can be changed at runtime. It is safe for
+// concurrent use.
+type ConcurrencyLimits struct {
+	maxLimit         int64
+	latencyThreshold int64
+}
+
+// NewConcurrencyLimits creates the limits with the max limit and latency threshold; see
+// ConcurrencyLimitOptions. Zero values use the defaults.
+func NewConcurrencyLimits(maxLimit int, latencyThreshold time.Duration) *ConcurrencyLimits {
+	l := &ConcurrencyLimits{}
+	l.Set(maxLimit, latencyThreshold)
+
+	return l
+}
+
+// Set changes the max limit and latency threshold. If the current limit is over the new max limit,
+// it is lowered on the next request.
+func (l *ConcurrencyLimits) Set(maxLimit int, latencyThreshold time.Duration) {
+	atomic.StoreInt64(&l.maxLimit, int64(maxLimit))
+	atomic.StoreInt64(&l.latencyThreshold, int64(latencyThreshold))
+}
+
+// get returns the limits, replacing zero values with those of the options.
+func (l *ConcurrencyLimits) get(o ConcurrencyLimitOptions) (int, time.Duration) {
+	maxLimit, latencyThreshold := o.MaxLimit, o.LatencyThreshold
+
+	if l == nil {
+		return maxLimit, latencyThreshold
+	}
+
+	if v := int(atomic.LoadInt64(&l.maxLimit)); v > 0 {
+		maxLimit = v
+	}
+
+	if v := time.Duration(atomic.LoadInt64(&l.latencyThreshold)); v > 0 {
+		latencyThreshold = v
+	}
+
+	return maxLimit, latencyThreshold
+}
+
+func (o *ConcurrencyLimitOptions) setDefaults() {
+	if o.MinLimit <= 0 {
+		o.MinLimit = 1
+	}
+
+	if o.MaxLimit <= 0 {
+		o.MaxLimit = 1000
+	}
+
+	if o.InitialLimit <= 0 {
+		o.InitialLimit = 20
+	}
+
+	if o.InitialLimit < o.MinLimit {
+		o.InitialLimit = o.MinLimit
+	}
+
+	if maxLimit, _ := o.Limits.get(*o); o.InitialLimit > maxLimit {
+		o.InitialLimit = maxLimit
+	}
+
+	if o.LatencyThreshold <= 0 {
+		o.LatencyThreshold = 500 * time.Millisecond
+	}
+
+	if o.Backoff <= 0 || o.Backoff >= 1 {
+		o.Backoff = 0.9
+	}
+
+	if o.LowPriorityRatio <= 0 || o.LowPriorityRatio > 1 {
+		o.LowPriorityRatio = 0.8
+	}
+
+	if o.RetryAfter <= 0 {
+		o.RetryAfter = time.Second
+	}
+
+	if o.Priority == nil {
+		o.Priority = func(r *http.Request) Priority { return PriorityNormal }
+	}
+
+	if o.Rejected == nil {
+		o.Rejected = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "service unavailable")
+		})
+	}
+}
+
+// PathPriority returns a Priority func for ConcurrencyLimitOptions that matches the request path
+// exactly against the given paths. Unmatched paths are PriorityNormal.
+func PathPriority(paths map[string]Priority) func(r *http.Request) Priority {
+	return func(r *http.Request) Priority {
+		if p, ok := paths[r.URL.Path]; ok {
+			return p
+		}
+
+		return PriorityNormal
+	}
+}
+
+// ConcurrencyLimit caps the number of in flight requests. The cap is adjusted using AIMD (additive
+// increase, multiplicative decrease): each request slower than the LatencyThreshold shrinks the
+// limit by Backoff, at most once per stall, and each fast request made while the limit is being
+// used grows it by one. Requests over the limit are shed with a 503 response and a Retry-After
+// header. Each middleware instance has its own limit, so use one per route group. The max limit and
+// latency threshold can be changed while it is running with ConcurrencyLimitOptions.Limits. This
+// middleware should be used after the Logger and Instrument middleware so shed requests are logged
+// and instrumented.
+func ConcurrencyLimit(opts ConcurrencyLimitOptions) func(next http.Handler) http.Handler {
+	opts.setDefaults()
+
+	l := &limiter{
+		opts:  opts,
+		limit: float64(opts.InitialLimit),
+	}
+
+	retryAfter := strconv.Itoa(int(math.Ceil(opts.RetryAfter.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			p := opts.Priority(r)
+
+			ok, inFlight, limit := l.acquire(p)
+			if !ok {
+				logging.FromContext(ctx).Warn("request shed",
+					zap.String("priority", p.String()),
+					zap.Int("in_flight", inFlight),
+					zap.Int("concurrency_limit", limit),
+				)
+
+				txn := instrumentation.FromContext(ctx)
+				txn.AddAttribute("load_shed", true)
+				txn.AddAttribute("in_flight", inFlight)
+				txn.AddAttribute("concurrency_limit", limit)
+				txn.AddAttribute("priority", p.String())
+
+				w.Header().Set("Retry-After", retryAfter)
+				opts.Rejected.ServeHTTP(w, r)
+
+				return
+			}
+
+			start := time.Now()
+
+			defer func() {
+				before, after := l.release(start)
+				if after < before {
+					logging.FromContext(ctx).Info("concurrency limit decreased",
+						zap.Int("previous_limit", before),
+						zap.Int("concurrency_limit", after),
+					)
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+type limiter struct {
+	opts ConcurrencyLimitOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	// decreased is when the limit was last decreased.
+	decreased time.Time
+}
+
+// acquire reserves a slot for a request with the given priority. It returns false if the request
+// should be shed, along with the in flight count and limit used to make the decision.
+func (l *limiter) acquire(p Priority) (bool, int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if maxLimit, _ := l.opts.Limits.get(l.opts); l.limit > float64(maxLimit) {
+		l.limit = math.Max(float64(l.opts.MinLimit), float64(maxLimit))
+	}
+
+	limit := l.limit
+
+	switch p {
+	case PriorityCritical:
+		limit = math.Inf(1)
+	case PriorityLow:
+		limit *= l.opts.LowPriorityRatio
+	}
+
+	if float64(l.inFlight) >= limit {
+		return false, l.inFlight, int(l.limit)
+	}
+
+	l.inFlight++
+
+	return true, l.inFlight, int(l.limit)
+}
+
+// release frees the slot held by a request that started at start, and adjusts the limit based on
+// its latency. It returns the limit before and after the adjustment.
+func (l *limiter) release(start time.Time) (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	before := l.limit
+	maxLimit, latencyThreshold := l.opts.Limits.get(l.opts)
+
+	if now.Sub(start) > latencyThreshold {
+		// Requests slowed down by the same stall finish together. Only the first of them lowers the
+		// limit; the rest started before it was lowered, so they say nothing about the new limit.
+		if !start.Before(l.decreased) {
+			l.limit = math.Max(float64(l.opts.MinLimit), l.limit*l.opts.Backoff)
+			l.decreased = now
+		}
+	} else if float64(l.inFlight*2) >= l.limit {
+		// Only grow the limit when we are actually using it; otherwise an idle server would grow
+		// its limit without bound.
+		l.limit = math.Min(float64(maxLimit), l.limit+1)
+	}
+
+	l.inFlight--
+
+	return int(before), int(l.limit)
+}
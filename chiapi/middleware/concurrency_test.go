@@ -0,0 +1,256 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+)
+
+// blockingHandler holds requests open until release is closed, so we can fill the limiter.
+func blockingHandler(started *sync.WaitGroup, release chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			started.Done()
+			<-release
+		}
+
+		w.WriteHeader(200)
+	})
+}
+
+func TestConcurrencyLimit_UnderLimit(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+
+	middleware.ConcurrencyLimit(middleware.ConcurrencyLimitOptions{InitialLimit: 1})(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestConcurrencyLimit_Shed(t *testing.T) {
+	var started sync.WaitGroup
+	release := make(chan struct{})
+
+	mw := middleware.ConcurrencyLimit(middleware.ConcurrencyLimitOptions{
+		InitialLimit: 2,
+		MaxLimit:     2,
+		RetryAfter:   1500 * time.Millisecond,
+		Priority: middleware.PathPriority(map[string]middleware.Priority{
+			"/health": middleware.PriorityCritical,
+		}),
+	})(blockingHandler(&started, release))
+
+	var done sync.WaitGroup
+
+	for i := 0; i < 2; i++ {
+		started.Add(1)
+		done.Add(1)
+
+		go func() {
+			defer done.Done()
+			mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/block", nil))
+		}()
+	}
+
+	started.Wait()
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/other", nil))
+
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/health", nil))
+
+	assert.Equal(t, 200, w.Code)
+
+	close(release)
+	done.Wait()
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/other", nil))
+
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestConcurrencyLimit_LowPriority(t *testing.T) {
+	var started sync.WaitGroup
+	release := make(chan struct{})
+
+	mw := middleware.ConcurrencyLimit(middleware.ConcurrencyLimitOptions{
+		InitialLimit:     2,
+		MaxLimit:         2,
+		LowPriorityRatio: 0.5,
+		Priority: middleware.PathPriority(map[string]middleware.Priority{
+			"/low": middleware.PriorityLow,
+		}),
+	})(blockingHandler(&started, release))
+
+	started.Add(1)
+
+	go mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/block", nil))
+
+	started.Wait()
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/low", nil))
+
+	assert.Equal(t, 503, w.Code)
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/other", nil))
+
+	assert.Equal(t, 200, w.Code)
+
+	close(release)
+}
+
+func TestConcurrencyLimit_DecreasesOnLatency(t *testing.T) {
+	var started sync.WaitGroup
+	release := make(chan struct{})
+
+	h := blockingHandler(&started, release)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		h.ServeHTTP(w, r)
+	})
+
+	mw := middleware.ConcurrencyLimit(middleware.ConcurrencyLimitOptions{
+		InitialLimit:     2,
+		MinLimit:         1,
+		LatencyThreshold: time.Millisecond,
+		Backoff:          0.5,
+	})(slow)
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/slow", nil))
+
+	assert.Equal(t, 200, w.Code)
+
+	// The limit is now 1, so a second request should be shed while the first is in flight.
+	started.Add(1)
+
+	go mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/block", nil))
+
+	started.Wait()
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/other", nil))
+
+	assert.Equal(t, 503, w.Code)
+
+	close(release)
+}
+
+func TestConcurrencyLimit_DecreasesOncePerStall(t *testing.T) {
+	var stalled sync.WaitGroup
+	stall := make(chan struct{})
+	admitted := make(chan struct{})
+	release := make(chan struct{})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			stalled.Done()
+			<-stall
+			time.Sleep(5 * time.Millisecond)
+		case "/block":
+			admitted <- struct{}{}
+			<-release
+		}
+
+		w.WriteHeader(200)
+	})
+
+	mw := middleware.ConcurrencyLimit(middleware.ConcurrencyLimitOptions{
+		InitialLimit:     8,
+		MinLimit:         1,
+		LatencyThreshold: time.Millisecond,
+		Backoff:          0.5,
+	})(h)
+
+	defer close(release)
+
+	// Four requests caught in the same stall finish slowly, together.
+	var done sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		stalled.Add(1)
+		done.Add(1)
+
+		go func() {
+			defer done.Done()
+			mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/slow", nil))
+		}()
+	}
+
+	stalled.Wait()
+	close(stall)
+	done.Wait()
+
+	// The limit was halved once, to 4, not down to the min limit, so four requests fit, and a
+	// fifth is shed.
+	for i := 0; i < 4; i++ {
+		shed := make(chan int, 1)
+
+		go func() {
+			w := httptest.NewRecorder()
+			mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/block", nil))
+			shed <- w.Code
+		}()
+
+		select {
+		case <-admitted:
+		case code := <-shed:
+			t.Fatalf("request %d was not admitted: %d", i+1, code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/other", nil))
+
+	assert.Equal(t, 503, w.Code)
+}
+
+func TestConcurrencyLimit_Limits(t *testing.T) {
+	var started sync.WaitGroup
+	release := make(chan struct{})
+
+	limits := middleware.NewConcurrencyLimits(2, 0)
+
+	mw := middleware.ConcurrencyLimit(middleware.ConcurrencyLimitOptions{
+		InitialLimit: 2,
+		Limits:       limits,
+	})(blockingHandler(&started, release))
+
+	// Lowering the max limit lowers the current limit to 1, so a second request should be shed while
+	// the first is in flight.
+	limits.Set(1, 0)
+
+	started.Add(1)
+
+	go mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/block", nil))
+
+	started.Wait()
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/other", nil))
+
+	assert.Equal(t, 503, w.Code)
+
+	close(release)
+}
@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/cors"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// validSubdomain matches the part of an origin matched by the * of a pattern such as
+// https://*.example.com: one or more DNS labels.
+var validSubdomain = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// CORSPolicy is the CORS policy of a group of routes.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins, such as https://app.example.com, allowed to make cross origin
+	// requests. An origin may be a pattern such as https://*.example.com, which matches every
+	// subdomain of example.com, but not example.com itself. The origin * allows every origin, and can
+	// not be used with AllowCredentials.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in cross origin requests. The header * allows
+	// every header.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that browsers let cross origin callers read.
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the response to a preflight request.
+	MaxAge time.Duration
+}
+
+// DefaultCORSPolicy returns the policy used for the origins unless it is overridden: the usual
+// methods and any header are allowed, with credentials, and the trace id and version headers are
+// exposed.
+func DefaultCORSPolicy(origins ...string) CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{tracing.TraceIDHeader, "X-Version"},
+		AllowCredentials: true,
+		MaxAge:           5 * time.Minute,
+	}
+}
+
+// Validate returns an error if an origin is not a valid pattern, or if every origin is allowed with
+// credentials, which browsers refuse.
+func (p CORSPolicy) Validate() error {
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			if p.AllowCredentials {
+				return errors.New("the origin * can not be allowed with credentials")
+			}
+
+			continue
+		}
+
+		switch strings.Count(o, "*") {
+		case 0:
+		case 1:
+			if !strings.Contains(o, "://*.") {
+				return fmt.Errorf("invalid origin %q: * must be the first label of the host, such as https://*.example.com", o)
+			}
+		default:
+			return fmt.Errorf("invalid origin %q: only one * is allowed", o)
+		}
+	}
+
+	return nil
+}
+
+// CORSOptions configures the CORS policies of the routes.
+type CORSOptions struct {
+	// Default is the policy of every route without its own.
+	Default CORSPolicy
+	// Routes are the policies of the route groups with the path prefixes, such as /auth. The longest
+	// matching prefix is used.
+	Routes map[string]CORSPolicy
+}
+
+// Validate returns an error if any of the policies is invalid; see CORSPolicy.Validate.
+func (o CORSOptions) Validate() error {
+	if err := o.Default.Validate(); err != nil {
+		return err
+	}
+
+	for prefix, p := range o.Routes {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("cors policy of %s: %w", prefix, err)
+		}
+	}
+
+	return nil
+}
+
+// ParseCORSRoutes returns the policies of route groups from entries such as
+// /auth=https://login.example.com https://*.example.com, which allow the origins, separated by
+// spaces, on the routes under the path prefix. The rest of each policy is the same as base.
+func ParseCORSRoutes(base CORSPolicy, entries []string) (map[string]CORSPolicy, error) {
+	routes := map[string]CORSPolicy{}
+
+	for _, e := range entries {
+		kv := strings.SplitN(strings.TrimSpace(e), "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "/") {
+			return nil, fmt.Errorf("invalid cors route %q: expected /prefix=origin ...", e)
+		}
+
+		p := base
+		p.AllowedOrigins = strings.Fields(kv[1])
+
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid cors route %q: %w", e, err)
+		}
+
+		routes[strings.TrimSpace(kv[0])] = p
+	}
+
+	return routes, nil
+}
+
+// CORSHandler answers preflight requests, and adds the CORS headers to cross origin requests, using
+// the policy of the route group each request is for. Rejected preflight requests are logged with why
+// they were rejected, so use it after Logger. Its policies can be changed while it is running with
+// Update. It is safe for concurrent use.
+type CORSHandler struct {
+	policies atomic.Value
+}
+
+// NewCORSHandler creates a CORSHandler with the policies of the options.
+func NewCORSHandler(o CORSOptions) *CORSHandler {
+	c := &CORSHandler{}
+	c.Update(o)
+
+	return c
+}
+
+// Update replaces the policies, such as when the config is reloaded. Requests already being handled
+// keep the old policies.
+func (c *CORSHandler) Update(o CORSOptions) {
+	p := &corsPolicies{
+		def:    newCORSRoute(o.Default),
+		routes: make(map[string]*corsRoute, len(o.Routes)),
+	}
+
+	for prefix, policy := range o.Routes {
+		p.prefixes = append(p.prefixes, prefix)
+		p.routes[prefix] = newCORSRoute(policy)
+	}
+
+	// Check the longest prefixes first, so the most specific policy is used.
+	sort.Slice(p.prefixes, func(i, j int) bool { return len(p.prefixes[i]) > len(p.prefixes[j]) })
+
+	c.policies.Store(p)
+}
+
+// Handler is the middleware; see CORS.
+func (c *CORSHandler) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		h := c.policies.Load().(*corsPolicies).route(r.URL.Path)
+
+		if isPreflight(r) {
+			if reason := h.rejectPreflight(r); reason != "" {
+				logging.FromContext(r.Context()).Warn("cors preflight rejected",
+					zap.String("reason", reason),
+					zap.String("origin", r.Header.Get("Origin")),
+					zap.String("request_method", r.Header.Get("Access-Control-Request-Method")),
+					zap.String("request_headers", r.Header.Get("Access-Control-Request-Headers")),
+				)
+			}
+		}
+
+		h.cors.Handler(next).ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// CORS returns the middleware of a CORSHandler with the policies of the options, which can not be
+// changed; see NewCORSHandler.
+func CORS(o CORSOptions) func(next http.Handler) http.Handler {
+	return NewCORSHandler(o).Handler
+}
+
+type corsPolicies struct {
+	def      *corsRoute
+	prefixes []string
+	routes   map[string]*corsRoute
+}
+
+// route returns the route of the policy of the path.
+func (p *corsPolicies) route(path string) *corsRoute {
+	for _, prefix := range p.prefixes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return p.routes[prefix]
+		}
+	}
+
+	return p.def
+}
+
+type corsRoute struct {
+	policy  CORSPolicy
+	cors    *cors.Cors
+	allowed func(origin string) bool
+}
+
+func newCORSRoute(p CORSPolicy) *corsRoute {
+	c := &corsRoute{
+		policy:  p,
+		allowed: originMatcher(p.AllowedOrigins),
+	}
+
+	c.cors = cors.New(cors.Options{
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return c.allowed(origin)
+		},
+		AllowedMethods:   p.AllowedMethods,
+		AllowedHeaders:   p.AllowedHeaders,
+		ExposedHeaders:   p.ExposedHeaders,
+		AllowCredentials: p.AllowCredentials,
+		MaxAge:           int(p.MaxAge.Seconds()),
+	})
+
+	return c
+}
+
+// rejectPreflight returns why the preflight request is rejected by the policy, or an empty string if
+// it is allowed.
+func (c *corsRoute) rejectPreflight(r *http.Request) string {
+	if !c.allowed(r.Header.Get("Origin")) {
+		return "origin not allowed"
+	}
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if method != http.MethodOptions && !containsFold(c.policy.AllowedMethods, method) {
+		return "method not allowed"
+	}
+
+	if containsFold(c.policy.AllowedHeaders, "*") {
+		return ""
+	}
+
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !strings.EqualFold(h, "Origin") && !containsFold(c.policy.AllowedHeaders, h) {
+			return "header not allowed"
+		}
+	}
+
+	return ""
+}
+
+// originMatcher returns a func that reports whether an origin is one of the origins, or matches one
+// of their patterns; see CORSPolicy.AllowedOrigins.
+func originMatcher(origins []string) func(origin string) bool {
+	exact := map[string]bool{}
+
+	var patterns [][2]string
+
+	for _, o := range origins {
+		o = strings.ToLower(o)
+
+		switch {
+		case o == "*":
+			return func(string) bool { return true }
+		case strings.Count(o, "*") == 1 && strings.Contains(o, "://*."):
+			i := strings.Index(o, "*")
+			patterns = append(patterns, [2]string{o[:i], o[i+1:]})
+		case !strings.Contains(o, "*"):
+			exact[o] = true
+		}
+	}
+
+	return func(origin string) bool {
+		origin = strings.ToLower(origin)
+		if exact[origin] {
+			return true
+		}
+
+		for _, p := range patterns {
+			prefix, suffix := p[0], p[1]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+				validSubdomain.MatchString(origin[len(prefix):len(origin)-len(suffix)]) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+)
+
+func TestCORS(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	p := middleware.DefaultCORSPolicy("https://example.com", "https://*.example.com")
+	p.AllowedHeaders = []string{"Authorization"}
+
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	mw := chi.NewRouter()
+	mw.Use(middleware.Logger(log))
+	mw.Use(middleware.CORS(middleware.CORSOptions{Default: p}))
+	mw.Handle("/", h)
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+		reason  string
+	}{
+		{name: "exact", origin: "https://example.com", method: "PUT", allowed: true},
+		{name: "subdomain", origin: "https://app.example.com", method: "PUT", allowed: true},
+		{name: "nested subdomain", origin: "https://a.b.example.com", method: "PUT", allowed: true},
+		{name: "case", origin: "HTTPS://App.Example.com", method: "PUT", allowed: true},
+		{name: "allowed header", origin: "https://example.com", method: "PUT", headers: "authorization", allowed: true},
+		{name: "scheme", origin: "http://app.example.com", method: "PUT", reason: "origin not allowed"},
+		{name: "suffix", origin: "https://evilexample.com", method: "PUT", reason: "origin not allowed"},
+		{name: "path", origin: "https://evil.com/.example.com", method: "PUT", reason: "origin not allowed"},
+		{name: "method", origin: "https://example.com", method: "PATCH", reason: "method not allowed"},
+		{name: "header", origin: "https://example.com", method: "PUT", headers: "X-Custom", reason: "header not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("OPTIONS", "http://api.example.com/", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+
+			if tt.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+
+			mw.ServeHTTP(w, r)
+
+			if tt.allowed {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal(t, "300", w.Header().Get("Access-Control-Max-Age"))
+				assert.NotContains(t, buf.String(), "cors preflight rejected")
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Contains(t, buf.String(), "cors preflight rejected")
+				assert.Contains(t, buf.String(), `"reason":"`+tt.reason+`"`)
+			}
+		})
+	}
+}
+
+func TestCORSHandler_Update(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	c := middleware.NewCORSHandler(middleware.CORSOptions{Default: middleware.DefaultCORSPolicy("https://example.com")})
+
+	mw := chi.NewRouter()
+	mw.Use(middleware.Logger(zap.NewNop()))
+	mw.Use(c.Handler)
+	mw.Handle("/", h)
+
+	allowed := func(origin string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://api.example.com/", nil)
+		r.Header.Set("Origin", origin)
+
+		mw.ServeHTTP(w, r)
+
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	assert.Equal(t, "https://example.com", allowed("https://example.com"))
+	assert.Empty(t, allowed("https://other.com"))
+
+	c.Update(middleware.CORSOptions{Default: middleware.DefaultCORSPolicy("https://other.com")})
+
+	assert.Empty(t, allowed("https://example.com"))
+	assert.Equal(t, "https://other.com", allowed("https://other.com"))
+}
+
+func TestCORSPolicy_Validate(t *testing.T) {
+	assert.NoError(t, middleware.DefaultCORSPolicy("https://example.com", "https://*.example.com:8443").Validate())
+	assert.Error(t, middleware.DefaultCORSPolicy("*").Validate())
+	assert.Error(t, middleware.DefaultCORSPolicy("https://app.*.com").Validate())
+	assert.Error(t, middleware.DefaultCORSPolicy("https://*.*.example.com").Validate())
+
+	p := middleware.DefaultCORSPolicy("*")
+	p.AllowCredentials = false
+	assert.NoError(t, p.Validate())
+}
+
+func TestParseCORSRoutes(t *testing.T) {
+	base := middleware.DefaultCORSPolicy("https://example.com")
+
+	routes, err := middleware.ParseCORSRoutes(base, []string{"/auth=https://login.example.com https://*.example.org"})
+	require.NoError(t, err)
+
+	require.Contains(t, routes, "/auth")
+	assert.Equal(t, []string{"https://login.example.com", "https://*.example.org"}, routes["/auth"].AllowedOrigins)
+	assert.Equal(t, base.ExposedHeaders, routes["/auth"].ExposedHeaders)
+
+	_, err = middleware.ParseCORSRoutes(base, []string{"auth=https://login.example.com"})
+	assert.Error(t, err)
+
+	_, err = middleware.ParseCORSRoutes(base, []string{"/auth=*"})
+	assert.Error(t, err)
+}
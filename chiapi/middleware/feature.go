@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/rickbassham/example-go/pkg/feature"
+)
+
+// Features adds the feature flags to the request context, so handlers can check them with
+// feature.Enabled.
+func Features(f *feature.Flags) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(feature.NewContext(r.Context(), f)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
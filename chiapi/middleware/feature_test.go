@@ -0,0 +1,31 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/feature"
+)
+
+func TestFeatures(t *testing.T) {
+	var enabled bool
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled = feature.Enabled(r.Context(), "beta")
+	})
+
+	f := feature.New("beta")
+	mw := middleware.Features(f)(h)
+
+	mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+	assert.True(t, enabled)
+
+	f.Set()
+
+	mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+	assert.False(t, enabled)
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/redact"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// Instrument will start a transaction for the request. It will name the transaction to match the chi
+// route. It will also add custom attributes to the transaction, such as the trace id, any url
+// parameters, and query string parameters. These attributes make it easy to tie your traces to logs.
+// Parameter values are masked with the redaction policy on the request context; see redact.FromContext.
+// The transaction is added to the request context, and can be retrieved with
+// instrumentation.FromContext.
+func Instrument(app instrumentation.Application) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			txn, w := app.StartTransaction(r.URL.Path, w, r)
+
+			r = r.WithContext(instrumentation.NewContext(r.Context(), txn))
+
+			// Deferred, so the transaction is still ended when a panic aborts the request; see Recoverer.
+			defer func() {
+				rctx := chi.RouteContext(r.Context())
+				policy := redact.FromContext(r.Context())
+
+				txn.AddAttribute("X-Trace-Id", tracing.FromContext(r.Context()))
+
+				for i := range rctx.URLParams.Keys {
+					if rctx.URLParams.Keys[i] == "*" {
+						continue
+					}
+
+					txn.AddAttribute(rctx.URLParams.Keys[i], policy.Value(rctx.URLParams.Keys[i], rctx.URLParams.Values[i]))
+				}
+
+				for k, v := range r.URL.Query() {
+					txn.AddAttribute(k, policy.Value(k, v[0]))
+				}
+
+				if route := routePattern(r); route != "" {
+					txn.SetName(route)
+				}
+
+				txn.End()
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
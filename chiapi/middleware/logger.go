@@ -10,60 +10,90 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/redact"
 	"github.com/rickbassham/example-go/pkg/tracing"
 )
 
 // Logger middleware logs each request and adds the logger to the request
-// context for use in request handlers.
+// context for use in request handlers. The request logger uses any log level
+// override for the request path; see logging.Levels. The query, referer and
+// redirect location are masked with the redaction policy on the request
+// context; see redact.FromContext. Fields added with logging.AddRequestFields
+// are included in the "request complete" entry, which is logged by the logging.AccessLogger so it
+// can be sent to the access log.
 func Logger(log *zap.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			path := r.URL.Path
 			traceID := tracing.FromContext(r.Context())
+			policy := redact.FromContext(r.Context())
 
-			l := log.With(
+			l := logging.ForRequest(log, path).With(
 				zap.String("direction", "incoming"),
 				zap.String("trace_id", traceID),
 				zap.String("method", r.Method),
 				zap.String("path", path),
-				zap.String("query", r.URL.RawQuery),
-				zap.String("referer", r.Referer()),
+				zap.String("query", policy.Query(r.URL.RawQuery)),
+				zap.String("referer", policy.URL(r.Referer())),
 				zap.String("user_agent", r.UserAgent()))
 
+			if sc, ok := tracing.SpanContextFromContext(r.Context()); ok {
+				l = l.With(zap.String("span_id", sc.SpanID.String()))
+
+				if sc.ParentSpanID.IsValid() {
+					l = l.With(zap.String("parent_span_id", sc.ParentSpanID.String()))
+				}
+			}
+
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
-			r = r.WithContext(logging.WithLogger(r.Context(), l))
-			next.ServeHTTP(ww, r)
+			ctx := logging.WithRequestFields(logging.WithLogger(r.Context(), l))
+			r = r.WithContext(ctx)
+			// Deferred, so the request is still logged when a panic aborts it; see Recoverer.
+			defer func() {
+				l = l.With(zap.String("route_pattern", routePattern(r)))
+				l = l.With(logging.RequestFields(ctx)...)
 
-			rctx := chi.RouteContext(r.Context())
+				status := ww.Status()
+				if status >= 300 && status < 400 {
+					// if we are doing a redirect, log where we are going
+					l = l.With(zap.String("location", policy.URL(ww.Header().Get("Location"))))
+				}
 
-			routePattern := strings.Join(rctx.RoutePatterns, "")
-			routePattern = strings.Replace(routePattern, "/*", "", -1)
+				l = l.With(
+					zap.Int("status", ww.Status()),
+					zap.Int("bytes", ww.BytesWritten()),
+					zap.Duration("duration", time.Since(start)),
+				)
 
-			l = l.With(zap.String("route_pattern", routePattern))
+				l = l.Named(logging.AccessLogger)
 
-			status := ww.Status()
-			if status >= 300 && status < 400 {
-				// if we are doing a redirect, log where we are going
-				l = l.With(zap.String("location", ww.Header().Get("Location")))
-			}
+				if status < 400 {
+					l.Info("request complete")
+				} else if status < 500 {
+					l.Warn("request complete")
+				} else {
+					l.Error("request complete")
+				}
+			}()
 
-			l = l.With(
-				zap.Int("status", ww.Status()),
-				zap.Int("bytes", ww.BytesWritten()),
-				zap.Duration("duration", time.Since(start)),
-			)
-
-			if status < 400 {
-				l.Info("request complete")
-			} else if status < 500 {
-				l.Warn("request complete")
-			} else {
-				l.Error("request complete")
-			}
+			next.ServeHTTP(ww, r)
 		}
 
 		return http.HandlerFunc(fn)
 	}
 }
+
+// routePattern returns the chi route pattern that matched the request, such as
+// /protected/{id:[0-9]+}. It is only available after the request has been routed.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+
+	pattern := strings.Join(rctx.RoutePatterns, "")
+
+	return strings.Replace(pattern, "/*", "", -1)
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/rickbassham/example-go/pkg/metrics"
+)
+
+// Metrics counts requests and records their latency in the given registry, labeled by chi route
+// pattern, method and status class. Requests that do not match a route are labeled "unmatched", so
+// unknown paths cannot grow the number of series. This middleware should be used before the
+// Recoverer middleware, so panics are counted as 5xx responses.
+func Metrics(reg *metrics.Registry) func(next http.Handler) http.Handler {
+	requests := reg.NewCounterVec("http_server_requests_total",
+		"Number of http requests handled.", "route", "method", "status")
+	duration := reg.NewHistogramVec("http_server_request_duration_seconds",
+		"Latency of http requests handled.", nil, "route", "method", "status")
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			start := time.Now()
+
+			// Deferred, so the request is still counted when a panic aborts it; see Recoverer.
+			defer func() {
+				route := routePattern(r)
+				if route == "" {
+					route = "unmatched"
+				}
+
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				class := metrics.StatusClass(status)
+
+				requests.WithLabelValues(route, r.Method, class).Inc()
+				duration.WithLabelValues(route, r.Method, class).Observe(time.Since(start).Seconds())
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
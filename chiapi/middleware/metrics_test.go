@@ -0,0 +1,38 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	r := chi.NewRouter()
+	r.Use(middleware.Metrics(reg))
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for _, path := range []string{"/items/1", "/items/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com"+path, nil))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.Write(&buf))
+
+	out := buf.String()
+
+	assert.Contains(t, out, `http_server_requests_total{route="/items/{id}",method="GET",status="5xx"} 2`)
+	assert.Contains(t, out, `http_server_requests_total{route="unmatched",method="GET",status="4xx"} 1`)
+	assert.Contains(t, out, `http_server_request_duration_seconds_count{route="/items/{id}",method="GET",status="5xx"} 2`)
+}
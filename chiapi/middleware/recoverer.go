@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/middleware"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// Recoverer recovers from panics in later handlers, logging the panic value and stack trace with the
+// request logger and noticing the error on the transaction. The param internalError should be a
+// request handler to render your 500 response. If it is nil, a simple default response will be
+// written. If the response has already been started when the panic occurs, the status code can no
+// longer be changed, so it panics with http.ErrAbortHandler instead, which aborts the connection.
+// This middleware should be used after the Logger and Instrument middleware.
+func Recoverer(internalError http.Handler) func(next http.Handler) http.Handler {
+	if internalError == nil {
+		internalError = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, "internal server error")
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				rvr := recover()
+				if rvr == nil {
+					return
+				}
+
+				if rvr == http.ErrAbortHandler {
+					// The handler wants the connection aborted, which net/http does quietly.
+					panic(rvr)
+				}
+
+				ctx := r.Context()
+
+				err, ok := rvr.(error)
+				if !ok {
+					err = fmt.Errorf("%v", rvr)
+				}
+
+				headersWritten := ww.Status() != 0
+
+				logging.FromContext(ctx).Error("panic recovered",
+					zap.Error(err),
+					zap.String("panic", fmt.Sprintf("%+v", rvr)),
+					zap.ByteString("stack", debug.Stack()),
+					zap.Bool("headers_written", headersWritten),
+				)
+
+				instrumentation.FromContext(ctx).NoticeError(instrumentation.Error{
+					Message: err.Error(),
+					Class:   "panic",
+				})
+
+				if headersWritten {
+					// The client has a status code, and maybe part of the body, so abort the
+					// connection, so it can tell the response is incomplete.
+					panic(http.ErrAbortHandler)
+				}
+
+				internalError.ServeHTTP(ww, r)
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+)
+
+func TestRecoverer_NoPanic(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+
+	middleware.Recoverer(nil)(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestRecoverer_Panic(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+
+	middleware.Recoverer(nil)(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, "internal server error\n", w.Body.String())
+}
+
+func TestRecoverer_PanicAfterHeaders(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte("partial")) // nolint
+		panic("oh no")
+	})
+
+	app := instrumentation.NewMemory()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+
+	txn, _ := app.StartTransaction("/", w, r)
+	r = r.WithContext(instrumentation.NewContext(r.Context(), txn))
+
+	// The response can not be fixed, so the connection is aborted, once the error is noticed.
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		middleware.Recoverer(nil)(h).ServeHTTP(w, r)
+	})
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+
+	errs := app.Transactions()[0].Errors()
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "oh no")
+}
+
+func TestRecoverer_AbortHandler(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		middleware.Recoverer(nil)(h).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/rickbassham/example-go/pkg/redact"
+)
+
+// Redact adds the redaction policy to the request context, so everything that logs or reports the
+// request masks the same data. This middleware should be used before the Logger and Instrument
+// middleware. Without it, redact.Default is used.
+func Redact(p *redact.Policy) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(redact.WithPolicy(r.Context(), p)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/redact"
+)
+
+func TestRedact(t *testing.T) {
+	app := instrumentation.NewMemory()
+
+	p, err := redact.New(redact.Options{Keys: []string{"account"}})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Redact(p))
+	r.Use(middleware.Instrument(app))
+	r.Get("/accounts/{account}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, p, redact.FromContext(r.Context()))
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/accounts/42?token=abc&page=2&q=jane@example.com", nil)
+
+	r.ServeHTTP(w, req)
+
+	txns := app.Transactions()
+	require.Len(t, txns, 1)
+
+	attrs := txns[0].Attributes()
+
+	assert.Equal(t, redact.Redacted, attrs["account"])
+	assert.Equal(t, redact.Redacted, attrs["token"])
+	assert.Equal(t, redact.Redacted, attrs["q"])
+	assert.Equal(t, "2", attrs["page"])
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/csp"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// SecurityHeaderOptions are the security headers set on every response by SecurityHeaders. Empty
+// fields are not set.
+type SecurityHeaderOptions struct {
+	// HSTSMaxAge is how long browsers must only use https for the host. If it is zero,
+	// Strict-Transport-Security is not set.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ContentSecurityPolicy is the policy, such as default-src 'none'. Any csp.NoncePlaceholder in it
+	// is replaced by a new nonce for each response, which handlers get with csp.NonceFromContext.
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only, so violations are
+	// reported to CSPReportURI, but not blocked. Use it to try a new policy.
+	CSPReportOnly bool
+	// CSPReportURI is where browsers send violation reports, such as the /csp-report endpoint of the
+	// router; see handler.CSPReport.
+	CSPReportURI              string
+	FrameOptions              string
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+}
+
+// APISecurityHeaders returns the headers for routes that only serve data, such as JSON, and never
+// pages: nothing may be loaded, framed or run from a response.
+func APISecurityHeaders() SecurityHeaderOptions {
+	return SecurityHeaderOptions{
+		HSTSMaxAge:                365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:     true,
+		ContentSecurityPolicy:     "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+		FrameOptions:              "DENY",
+		ReferrerPolicy:            "no-referrer",
+		PermissionsPolicy:         "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginResourcePolicy: "same-origin",
+	}
+}
+
+// HTMLSecurityHeaders returns the headers for routes that serve pages: everything is loaded from
+// the same origin, inline scripts and styles need the nonce of the response, and the page is
+// isolated from other origins.
+func HTMLSecurityHeaders() SecurityHeaderOptions {
+	return SecurityHeaderOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'self'; script-src 'self' " + csp.NoncePlaceholder + "; style-src 'self' " +
+			csp.NoncePlaceholder + "; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; " +
+			"frame-ancestors 'self'",
+		FrameOptions:              "SAMEORIGIN",
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		PermissionsPolicy:         "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+		CrossOriginResourcePolicy: "same-origin",
+	}
+}
+
+// SecurityHeaders sets the security headers of the options on every response, before the handler
+// runs, so a handler can still change them. If the policy has a nonce, it is added to the request
+// context; see csp.NonceFromContext.
+func SecurityHeaders(o SecurityHeaderOptions) func(next http.Handler) http.Handler {
+	headers := http.Header{}
+
+	set := func(name, value string) {
+		if value != "" {
+			headers.Set(name, value)
+		}
+	}
+
+	if o.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.Itoa(int(o.HSTSMaxAge.Seconds()))
+		if o.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+
+		if o.HSTSPreload {
+			hsts += "; preload"
+		}
+
+		set("Strict-Transport-Security", hsts)
+	}
+
+	set("X-Content-Type-Options", "nosniff")
+	set("X-Frame-Options", o.FrameOptions)
+	set("Referrer-Policy", o.ReferrerPolicy)
+	set("Permissions-Policy", o.PermissionsPolicy)
+	set("Cross-Origin-Opener-Policy", o.CrossOriginOpenerPolicy)
+	set("Cross-Origin-Embedder-Policy", o.CrossOriginEmbedderPolicy)
+	set("Cross-Origin-Resource-Policy", o.CrossOriginResourcePolicy)
+
+	policy := o.ContentSecurityPolicy
+	if policy != "" && o.CSPReportURI != "" {
+		policy += "; report-uri " + o.CSPReportURI + "; report-to csp"
+		set("Reporting-Endpoints", `csp="`+o.CSPReportURI+`"`)
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if o.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	hasNonce := strings.Contains(policy, csp.NoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for name, values := range headers {
+				w.Header()[name] = values
+			}
+
+			if policy != "" && !hasNonce {
+				w.Header().Set(cspHeader, policy)
+			}
+
+			if hasNonce {
+				nonce, err := csp.NewNonce()
+				if err != nil {
+					// Without a nonce, every inline script and style is blocked, which is safe.
+					logging.FromContext(r.Context()).Error("error generating csp nonce", zap.Error(err))
+				}
+
+				w.Header().Set(cspHeader, csp.Policy(policy, nonce))
+				r = r.WithContext(csp.WithNonce(r.Context(), nonce))
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
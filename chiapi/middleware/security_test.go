@@ -0,0 +1,65 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/csp"
+)
+
+func TestSecurityHeaders_API(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, csp.NonceFromContext(r.Context()))
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+
+	middleware.SecurityHeaders(middleware.APISecurityHeaders())(h).ServeHTTP(w, r)
+
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Empty(t, w.Header().Get("Cross-Origin-Embedder-Policy"))
+}
+
+func TestSecurityHeaders_Nonce(t *testing.T) {
+	var nonces []string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, csp.NonceFromContext(r.Context()))
+		w.WriteHeader(200)
+	})
+
+	o := middleware.HTMLSecurityHeaders()
+	o.CSPReportOnly = true
+	o.CSPReportURI = "/csp-report"
+
+	mw := middleware.SecurityHeaders(o)(h)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com", nil))
+
+		policy := w.Header().Get("Content-Security-Policy-Report-Only")
+		nonce := nonces[len(nonces)-1]
+
+		assert.NotEmpty(t, nonce)
+		assert.Contains(t, policy, "script-src 'self' 'nonce-"+nonce+"'")
+		assert.True(t, strings.HasSuffix(policy, "; report-uri /csp-report; report-to csp"))
+		assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, `csp="/csp-report"`, w.Header().Get("Reporting-Endpoints"))
+		assert.Equal(t, "require-corp", w.Header().Get("Cross-Origin-Embedder-Policy"))
+	}
+
+	assert.NotEqual(t, nonces[0], nonces[1])
+}
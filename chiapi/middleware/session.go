@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// SessionAuthenticator returns the session for a session cookie, such as an auth.Sessions.
+type SessionAuthenticator interface {
+	Lookup(ctx context.Context, cookie string) (auth.Session, error)
+}
+
+// Session authenticates requests with a session cookie, adding the principal of the session, and the
+// session itself, to the request context; see auth.SessionFromContext. Requests without the cookie
+// are passed through, so a token can be used instead; Authenticator, ValidateClaims and User skip
+// requests authenticated with a session. Sessions that are unknown or have ended get a 401, and
+// the cookie is deleted. Sessions that can not be looked up, such as when their store is down, get
+// a 503, and the cookie is kept, so the browser is still logged in once it is back. Use CSRF after
+// it. The param unauthorized should be a request handler to render your 401 response, and
+// unavailable your 503 response. If either is nil, a simple default response will be written.
+func Session(sessions SessionAuthenticator, unauthorized, unavailable http.Handler) func(next http.Handler) http.Handler {
+	unauthorized = defaultUnauthorized(unauthorized)
+	unavailable = defaultUnavailable(unavailable)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			c, err := r.Cookie(auth.SessionCookieName)
+			if err != nil || c.Value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sess, err := sessions.Lookup(r.Context(), c.Value)
+			if err != nil {
+				var e *auth.Error
+				if errors.As(err, &e) {
+					http.SetCookie(w, auth.SessionCookie("", -1))
+				}
+
+				rejectCredentials(w, r, unauthorized, unavailable, identity.AuthMethodSession, err)
+				return
+			}
+
+			logging.AddRequestFields(r.Context(), auth.PrincipalFields(sess.Principal)...)
+
+			ctx := identity.WithPrincipal(r.Context(), sess.Principal)
+			ctx = auth.WithSession(ctx, sess)
+
+			audit.Record(ctx, audit.Event{Type: audit.TypeAuthentication, Outcome: audit.OutcomeSuccess})
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// CSRF guards requests authenticated by Session against cross-site request forgery. Unsafe
+// requests, such as POST and DELETE, must send the CSRF token of the session in the X-CSRF-Token
+// header; a page on another site can make the browser send the cookie, but cannot read the token.
+// Requests authenticated any other way are passed through, since browsers do not send their
+// credentials on their own. The param forbidden should be a request handler to render your 403
+// response. If it is nil, a simple default response will be written.
+func CSRF(forbidden http.Handler) func(next http.Handler) http.Handler {
+	forbidden = defaultForbidden(forbidden)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			sess, ok := auth.SessionFromContext(r.Context())
+			if !ok || safeMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := auth.Authorize(r.Context(), auth.RequireCSRFToken(sess), r.Header.Get(auth.CSRFHeader)); err != nil {
+				forbidden.ServeHTTP(w, r.WithContext(auth.WithForbidden(r.Context(), err.(*auth.Forbidden))))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// safeMethod returns true for the methods that should not change anything, as described in RFC 7231.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
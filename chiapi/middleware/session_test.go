@@ -0,0 +1,99 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+// sessionLookup returns err for every cookie.
+type sessionLookup struct {
+	err error
+}
+
+func (s sessionLookup) Lookup(ctx context.Context, cookie string) (auth.Session, error) {
+	return auth.Session{}, s.err
+}
+
+func TestSession_Rejected(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	for _, tc := range []struct {
+		name    string
+		err     error
+		code    int
+		deleted bool
+	}{
+		{"unknown session", &auth.Error{Reason: auth.ReasonInvalidToken, Description: "session is invalid"}, 401, true},
+		{"store down", errors.New("connection refused"), 503, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://example.com", nil)
+			r.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: "my-cookie"})
+
+			middleware.Session(sessionLookup{err: tc.err}, nil, nil)(h).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.code, w.Code)
+			assert.Equal(t, tc.deleted, w.Header().Get("Set-Cookie") != "")
+		})
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	sess := auth.Session{
+		ID:        "my-session",
+		Principal: identity.Principal{Subject: "rick", AuthMethod: identity.AuthMethodSession},
+		CSRFToken: "my-csrf-token",
+	}
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		session bool
+		token   string
+		code    int
+	}{
+		{"safe method", "GET", true, "", 200},
+		{"no session", "POST", false, "", 200},
+		{"missing token", "POST", true, "", 403},
+		{"wrong token", "DELETE", true, "other-token", 403},
+		{"valid token", "POST", true, "my-csrf-token", 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tc.method, "http://example.com", nil)
+
+			if tc.session {
+				ctx := identity.WithPrincipal(r.Context(), sess.Principal)
+				r = r.WithContext(auth.WithSession(ctx, sess))
+			}
+
+			if tc.token != "" {
+				r.Header.Set("X-CSRF-Token", tc.token)
+			}
+
+			middleware.CSRF(nil)(h).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.code, w.Code)
+
+			if tc.code == 403 {
+				assert.Contains(t, w.Body.String(), "denied by policy csrf")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// TenantHeader is the default request header a tenant is requested with.
+const TenantHeader = "X-Tenant-Id"
+
+// validTenant matches the tenant names that can be requested: a single DNS label, so any tenant can
+// be a subdomain, and is safe in redis keys and logs.
+var validTenant = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// TenantOptions configures where ResolveTenant reads the requested tenant from.
+type TenantOptions struct {
+	// Domain is the domain tenants are subdomains of, such as example.com for acme.example.com. If it
+	// is empty, the tenant is not read from the host.
+	Domain string
+	// Header is the request header the tenant is read from. By default, it is TenantHeader.
+	Header string
+}
+
+// ResolveTenant reads the tenant a request is for from the subdomain of its host, or from the tenant
+// header, and adds it to the request context; see identity.TenantFromContext. It is not trusted until
+// Tenant checks it against the principal. Requests naming an invalid tenant, or two different ones,
+// are rejected. Requests naming no tenant are passed through, so it can be taken from the token. The
+// param forbidden should be a request handler to render your 403 response. If it is nil, a simple
+// problem response will be written.
+func ResolveTenant(o TenantOptions, forbidden http.Handler) func(next http.Handler) http.Handler {
+	forbidden = defaultForbidden(forbidden)
+
+	if o.Header == "" {
+		o.Header = TenantHeader
+	}
+
+	domain := "." + strings.ToLower(strings.Trim(o.Domain, "."))
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			var fromHost string
+			if domain != "." {
+				fromHost = subdomain(r.Host, domain)
+			}
+
+			tenant := strings.ToLower(r.Header.Get(o.Header))
+
+			switch {
+			case fromHost != "" && tenant != "" && fromHost != tenant:
+				rejectTenant(w, r, forbidden, "tenant of the host and header do not match")
+				return
+			case fromHost != "":
+				tenant = fromHost
+			case tenant == "":
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !validTenant.MatchString(tenant) {
+				rejectTenant(w, r, forbidden, "invalid tenant")
+				return
+			}
+
+			next.ServeHTTP(w, withTenant(r, tenant))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Tenant checks that the principal belongs to the tenant the request is for, such as the tenant
+// claim of their token; see auth.RequireTenant. If ResolveTenant found no tenant, the tenant of the
+// principal is used. Use it after User. The tenant is added to every log entry for the request and
+// to the transaction. The param forbidden should be a request handler to render your 403 response;
+// the denial is on the request context, see auth.ForbiddenFromContext. If it is nil, a simple
+// problem response will be written.
+func Tenant(forbidden http.Handler) func(next http.Handler) http.Handler {
+	forbidden = defaultForbidden(forbidden)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			tenant, resolved := identity.TenantFromContext(r.Context())
+			if !resolved {
+				p, _ := identity.PrincipalFromContext(r.Context())
+				tenant = p.Tenant
+			}
+
+			if err := auth.Authorize(r.Context(), auth.RequireTenant(), tenant); err != nil {
+				forbidden.ServeHTTP(w, r.WithContext(auth.WithForbidden(r.Context(), err.(*auth.Forbidden))))
+				return
+			}
+
+			if !resolved {
+				r = withTenant(r, tenant)
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// withTenant adds the tenant to the request context, the request logger, the request log entry and
+// the transaction.
+func withTenant(r *http.Request, tenant string) *http.Request {
+	ctx := identity.WithTenant(r.Context(), tenant)
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With(zap.String("tenant", tenant)))
+
+	logging.AddRequestFields(ctx, zap.String("tenant", tenant))
+	instrumentation.FromContext(ctx).AddAttribute("tenant", tenant)
+
+	return r.WithContext(ctx)
+}
+
+func rejectTenant(w http.ResponseWriter, r *http.Request, forbidden http.Handler, reason string) {
+	logging.FromContext(r.Context()).Warn("tenant rejected", zap.String("reason", reason))
+	logging.AddRequestFields(r.Context(), zap.String("denied_by", "tenant"))
+
+	audit.Record(r.Context(), audit.Event{
+		Type:    audit.TypeAuthorization,
+		Outcome: audit.OutcomeDenied,
+		Reason:  "tenant",
+		Details: map[string]string{"description": reason},
+	})
+
+	forbidden.ServeHTTP(w, r.WithContext(auth.WithForbidden(r.Context(), &auth.Forbidden{Policy: "tenant"})))
+}
+
+// subdomain returns the single label of the host before the domain, which starts with a dot, or an
+// empty string if the host is not a direct subdomain of it.
+func subdomain(host, domain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(host)
+	if !strings.HasSuffix(host, domain) {
+		return ""
+	}
+
+	label := strings.TrimSuffix(host, domain)
+	if strings.Contains(label, ".") {
+		return ""
+	}
+
+	return label
+}
@@ -0,0 +1,99 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestResolveTenant(t *testing.T) {
+	var tenant string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ = identity.TenantFromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	mw := middleware.ResolveTenant(middleware.TenantOptions{Domain: "example.com"}, nil)(h)
+
+	tests := []struct {
+		name   string
+		host   string
+		header string
+		code   int
+		tenant string
+	}{
+		{name: "subdomain", host: "acme.example.com:8080", code: 200, tenant: "acme"},
+		{name: "header", host: "api.example.org", header: "Acme", code: 200, tenant: "acme"},
+		{name: "matching", host: "acme.example.com", header: "acme", code: 200, tenant: "acme"},
+		{name: "none", host: "example.com", code: 200},
+		{name: "nested subdomain", host: "a.acme.example.com", code: 200},
+		{name: "mismatch", host: "acme.example.com", header: "globex", code: 403},
+		{name: "invalid", host: "example.com", header: "acme:admin", code: 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant = ""
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://"+tt.host+"/", nil)
+			if tt.header != "" {
+				r.Header.Set(middleware.TenantHeader, tt.header)
+			}
+
+			mw.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
+
+func TestTenant(t *testing.T) {
+	var tenant string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ = identity.TenantFromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	mw := middleware.ResolveTenant(middleware.TenantOptions{}, nil)(middleware.Tenant(nil)(h))
+
+	tests := []struct {
+		name      string
+		principal identity.Principal
+		header    string
+		code      int
+		tenant    string
+	}{
+		{name: "from principal", principal: identity.Principal{Subject: "user-1", Tenant: "acme"}, code: 200, tenant: "acme"},
+		{name: "matching", principal: identity.Principal{Subject: "user-1", Tenant: "acme"}, header: "acme", code: 200, tenant: "acme"},
+		{name: "other tenant", principal: identity.Principal{Subject: "user-1", Tenant: "acme"}, header: "globex", code: 403},
+		{name: "no principal tenant", principal: identity.Principal{Subject: "user-1"}, header: "acme", code: 403},
+		{name: "no tenant", principal: identity.Principal{Subject: "user-1"}, code: 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant = ""
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			r = r.WithContext(identity.WithPrincipal(r.Context(), tt.principal))
+			if tt.header != "" {
+				r.Header.Set(middleware.TenantHeader, tt.header)
+			}
+
+			mw.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
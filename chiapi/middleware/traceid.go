@@ -3,29 +3,36 @@ package middleware
 import (
 	"net/http"
 
-	"github.com/google/uuid"
-
 	"github.com/rickbassham/example-go/pkg/tracing"
 )
 
-// TraceID tries to read the X-Trace-Id request header, and if empty, creates
-// a new traceID to use. This traceID will be added to the response X-Trace-Id
-// header and to the request context.
+// TraceID is TraceContext using the default propagator, which understands W3C Trace Context and the
+// legacy X-Trace-Id header.
 func TraceID(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var traceID string
-
-		if r.Header != nil {
-			traceID = r.Header.Get("X-Trace-Id")
+	return TraceContext(tracing.Propagator{})(next)
+}
 
-			if traceID == "" {
-				traceID = uuid.New().String()
+// TraceContext reads the caller's span context from the request headers and starts a new span for
+// this request as its child. If the headers are missing or malformed, a new trace is started
+// instead. The span context is added to the request context, and the trace id is added to the
+// response X-Trace-Id header, exactly as the caller sent it if it came from their X-Trace-Id.
+func TraceContext(p tracing.Propagator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			var sc tracing.SpanContext
+
+			if parent, ok := p.Extract(r.Header); ok {
+				sc = parent.Child()
+			} else {
+				sc = tracing.NewSpanContext(true)
 			}
-		}
 
-		w.Header().Set("X-Trace-Id", traceID)
+			w.Header().Set(tracing.TraceIDHeader, sc.TraceIDHeaderValue())
+
+			r = r.WithContext(tracing.WithSpanContext(r.Context(), sc))
+			next.ServeHTTP(w, r)
+		}
 
-		r = r.WithContext(tracing.WithTraceID(r.Context(), traceID))
-		next.ServeHTTP(w, r)
-	})
+		return http.HandlerFunc(fn)
+	}
 }
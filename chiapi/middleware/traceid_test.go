@@ -6,8 +6,10 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/tracing"
 )
 
 func TestTraceID(t *testing.T) {
@@ -21,7 +23,7 @@ func TestTraceID(t *testing.T) {
 	middleware.TraceID(h).ServeHTTP(w, r)
 
 	assert.Equal(t, 200, w.Code)
-	assert.Len(t, w.Header().Get("X-Trace-Id"), 36)
+	assert.Len(t, w.Header().Get("X-Trace-Id"), 32)
 }
 
 func TestTraceID_Existing(t *testing.T) {
@@ -29,6 +31,51 @@ func TestTraceID_Existing(t *testing.T) {
 		w.WriteHeader(200)
 	})
 
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.Header.Set("X-Trace-Id", "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	middleware.TraceID(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get("X-Trace-Id"))
+}
+
+func TestTraceID_ExistingUUID(t *testing.T) {
+	var sc tracing.SpanContext
+	var traceID string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc, _ = tracing.SpanContextFromContext(r.Context())
+		traceID = tracing.FromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.Header.Set("X-Trace-Id", "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736")
+
+	middleware.TraceID(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736", w.Header().Get("X-Trace-Id"))
+	assert.Equal(t, "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736", traceID)
+
+	// The normalized form is only used in the W3C headers.
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+
+	out := http.Header{}
+	tracing.Propagator{}.Inject(sc, out)
+
+	assert.Equal(t, "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736", out.Get("X-Trace-Id"))
+	assert.Contains(t, out.Get("traceparent"), "-4bf92f3577b34da6a3ce929d0e0e4736-")
+}
+
+func TestTraceID_Malformed(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "http://example.com", nil)
 	r.Header.Set("X-Trace-Id", "my-cool-trace-id")
@@ -36,5 +83,53 @@ func TestTraceID_Existing(t *testing.T) {
 	middleware.TraceID(h).ServeHTTP(w, r)
 
 	assert.Equal(t, 200, w.Code)
-	assert.Equal(t, "my-cool-trace-id", w.Header().Get("X-Trace-Id"))
+	assert.Len(t, w.Header().Get("X-Trace-Id"), 32)
+	assert.NotEqual(t, "my-cool-trace-id", w.Header().Get("X-Trace-Id"))
+}
+
+func TestTraceID_TraceParent(t *testing.T) {
+	var sc tracing.SpanContext
+	var ok bool
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc, ok = tracing.SpanContextFromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("tracestate", "congo=t61rcWkgMzE")
+
+	middleware.TraceID(h).ServeHTTP(w, r)
+
+	require.True(t, ok)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get("X-Trace-Id"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.ParentSpanID.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "congo=t61rcWkgMzE", sc.TraceState)
+}
+
+func TestTraceContext_B3(t *testing.T) {
+	var sc tracing.SpanContext
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc, _ = tracing.SpanContextFromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.Header.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0")
+
+	middleware.TraceContext(tracing.Propagator{B3: true})(h).ServeHTTP(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "80f198ee56343ba864fe8b2a57d3eff7", sc.TraceID.String())
+	assert.Equal(t, "e457b5a2e4d86bd1", sc.ParentSpanID.String())
+	assert.False(t, sc.Sampled)
 }
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// Tracing records a server span for each request with the given tracer, and adds the tracer to the
+// request context so spans are also recorded for redis commands, sql statements and outgoing
+// requests. The span is named after the chi route once the request has been routed. This middleware
+// should be used after the TraceContext middleware, so the span continues the caller's trace.
+func Tracing(t *tracing.Tracer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			sc, ok := tracing.SpanContextFromContext(ctx)
+			if !ok {
+				sc = tracing.NewSpanContext(true)
+			}
+
+			// Without a parent span the trace starts here, so it is our sampling decision to make.
+			if !sc.ParentSpanID.IsValid() {
+				sc.Sampled = t.Sample(sc.TraceID)
+			}
+
+			ctx = tracing.WithTracer(ctx, t)
+			ctx, span := t.Start(ctx, sc, r.Method+" "+r.URL.Path, tracing.SpanKindServer)
+			defer span.End()
+
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.Path)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			r = r.WithContext(ctx)
+			next.ServeHTTP(ww, r)
+
+			if route := routePattern(r); route != "" {
+				span.SetName(r.Method + " " + route)
+				span.SetAttribute("http.route", route)
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			span.SetAttribute("http.status_code", status)
+
+			if status >= 500 {
+				span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
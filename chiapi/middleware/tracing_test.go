@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+type memoryExporter struct {
+	spans []tracing.SpanData
+}
+
+func (e *memoryExporter) Export(ctx context.Context, spans []tracing.SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	exp := &memoryExporter{}
+	tr := tracing.NewTracer(tracing.TracerOptions{Exporter: exp, SampleRatio: 1})
+
+	r := chi.NewRouter()
+	r.Use(middleware.TraceID)
+	r.Use(middleware.Tracing(tr))
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotNil(t, tracing.TracerFromContext(r.Context()))
+		w.WriteHeader(500)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/items/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	r.ServeHTTP(w, req)
+
+	require.NoError(t, tr.Shutdown(context.Background()))
+	require.Len(t, exp.spans, 1)
+
+	s := exp.spans[0]
+
+	assert.Equal(t, "GET /items/{id}", s.Name)
+	assert.Equal(t, tracing.SpanKindServer, s.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", s.SpanContext.ParentSpanID.String())
+	assert.Equal(t, 500, s.Attributes["http.status_code"])
+	assert.Error(t, s.Err)
+}
@@ -5,19 +5,33 @@ import (
 
 	"github.com/go-chi/jwtauth"
 
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
 	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
 )
 
-// User get's user email from JWT token and adds it to the request context.
-func User(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, claims, _ := jwtauth.FromContext(r.Context())
-		user, ok := claims["email"].(string)
+// User creates the principal from the claims of the JWT token, read with the mapping, and adds it
+// to the request context; see identity.PrincipalFromContext. Who made the request is added to the
+// request log; see auth.PrincipalFields, and recorded as an audit event. The principal of a request
+// authenticated by APIKey or Session is kept.
+func User(m identity.ClaimMapping) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token, claims, _ := jwtauth.FromContext(r.Context())
 
-		if ok && user != "" {
-			r = r.WithContext(identity.WithUser(r.Context(), user))
+			if token != nil && !preauthenticated(r) {
+				p := m.Principal(claims)
+
+				logging.AddRequestFields(r.Context(), auth.PrincipalFields(p)...)
+				r = r.WithContext(identity.WithPrincipal(r.Context(), p))
+
+				audit.Record(r.Context(), audit.Event{Type: audit.TypeAuthentication, Outcome: audit.OutcomeSuccess})
+			}
+
+			next.ServeHTTP(w, r)
 		}
 
-		next.ServeHTTP(w, r)
-	})
+		return http.HandlerFunc(fn)
+	}
 }
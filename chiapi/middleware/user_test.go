@@ -1,13 +1,18 @@
 package middleware_test
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi"
 	"github.com/go-chi/jwtauth"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/rickbassham/example-go/chiapi/middleware"
 	"github.com/rickbassham/example-go/pkg/identity"
@@ -24,7 +29,7 @@ func TestUser_NoToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "http://example.com", nil)
 
-	middleware.User(h).ServeHTTP(w, r)
+	middleware.User(identity.DefaultClaimMapping)(h).ServeHTTP(w, r)
 
 	assert.Equal(t, 200, w.Code)
 	assert.Equal(t, "", user)
@@ -49,8 +54,63 @@ func TestUser_WithToken(t *testing.T) {
 	r := httptest.NewRequest("GET", "http://example.com", nil)
 	r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
 
-	middleware.User(h).ServeHTTP(w, r)
+	middleware.User(identity.DefaultClaimMapping)(h).ServeHTTP(w, r)
 
 	assert.Equal(t, 200, w.Code)
 	assert.Equal(t, "my-user", user)
 }
+
+func TestUser_Principal(t *testing.T) {
+	var p identity.Principal
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ = identity.PrincipalFromContext(r.Context())
+		w.WriteHeader(200)
+	})
+
+	tok := &jwt.Token{
+		Valid: true,
+		Claims: jwt.MapClaims{
+			"sub":          "user-1",
+			"email":        "my-user@example.com",
+			"scope":        "read write",
+			"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+			"org":          "acme",
+			"jti":          "token-1",
+		},
+	}
+
+	m, err := identity.ParseClaimMapping([]string{"roles=realm_access.roles", "tenant=org"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	rtr := chi.NewRouter()
+	rtr.Use(middleware.Logger(log))
+	rtr.With(middleware.User(m)).Handle("/", h)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), tok, nil))
+
+	rtr.ServeHTTP(w, r)
+
+	assert.Equal(t, identity.Principal{
+		Subject:    "user-1",
+		Email:      "my-user@example.com",
+		Roles:      []string{"admin"},
+		Scopes:     []string{"read", "write"},
+		Tenant:     "acme",
+		AuthMethod: identity.AuthMethodJWT,
+		TokenID:    "token-1",
+	}, p)
+
+	assert.Contains(t, buf.String(), `"principal":"user-1","auth_method":"jwt","roles":["admin"],"scopes":["read","write"],"token_id":"token-1"`)
+	assert.NotContains(t, buf.String(), "my-user@example.com")
+}
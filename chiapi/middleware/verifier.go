@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+)
+
+// TokenVerifier verifies a JWT, such as auth.Verifier.
+type TokenVerifier interface {
+	Verify(ctx context.Context, tokenString string) (*jwt.Token, error)
+}
+
+// Verifier finds the JWT on the request, in the same places as jwtauth.Verifier, and verifies it
+// with v. The token and any error are added to the request context, the same way as
+// jwtauth.Verifier, for Authenticator and User to use; see jwtauth.FromContext.
+func Verifier(v TokenVerifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			var token *jwt.Token
+
+			err := jwtauth.ErrNoTokenFound
+
+			for _, find := range []func(r *http.Request) string{
+				jwtauth.TokenFromQuery, jwtauth.TokenFromHeader, jwtauth.TokenFromCookie,
+			} {
+				if s := find(r); s != "" {
+					token, err = v.Verify(r.Context(), s)
+					break
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
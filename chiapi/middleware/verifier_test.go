@@ -0,0 +1,69 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func TestVerifier(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "jwks")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // nolint
+
+	fmt.Fprintf(f, `{"keys":[{"kty":"OKP","kid":"ed","crv":"Ed25519","x":%q}]}`, base64.RawURLEncoding.EncodeToString(pub))
+	require.NoError(t, f.Close())
+
+	keys, err := auth.NewKeySet(context.Background(), auth.KeySetOptions{Source: f.Name()})
+	require.NoError(t, err)
+
+	tok := jwt.NewWithClaims(auth.SigningMethodEdDSA, jwt.MapClaims{"email": "my-user"})
+	tok.Header["kid"] = "ed"
+
+	tokenString, err := tok.SignedString(key)
+	require.NoError(t, err)
+
+	var (
+		claims  jwtauth.Claims
+		authErr error
+	)
+
+	h := middleware.Verifier(auth.NewKeySetVerifier(keys))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, authErr = jwtauth.FromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	r.Header.Set("Authorization", "BEARER "+tokenString)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.NoError(t, authErr)
+	assert.Equal(t, "my-user", claims["email"])
+
+	r = httptest.NewRequest("GET", "http://example.com", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, jwtauth.ErrNoTokenFound, authErr)
+
+	r = httptest.NewRequest("GET", "http://example.com?jwt=not-a-token", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Error(t, authErr)
+}
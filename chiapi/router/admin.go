@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/metrics"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// AdminHandler exposes the functions for handling admin requests.
+type AdminHandler interface {
+	Routes(w http.ResponseWriter, r *http.Request)
+	Config(w http.ResponseWriter, r *http.Request)
+	Build(w http.ResponseWriter, r *http.Request)
+	Goroutines(w http.ResponseWriter, r *http.Request)
+	LogLevel(w http.ResponseWriter, r *http.Request)
+	SetLogLevel(w http.ResponseWriter, r *http.Request)
+	DeleteLogLevel(w http.ResponseWriter, r *http.Request)
+	ListAPIKeys(w http.ResponseWriter, r *http.Request)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	RotateAPIKey(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKey(w http.ResponseWriter, r *http.Request)
+	AuditEvents(w http.ResponseWriter, r *http.Request)
+	NotFound(w http.ResponseWriter, r *http.Request)
+	Unauthorized(w http.ResponseWriter, r *http.Request)
+	InternalServerError(w http.ResponseWriter, r *http.Request)
+}
+
+// NewAdminRouter creates the router for the admin listener, which should not be reachable from the
+// internet. Every request must be authenticated with a verified client certificate or the token; see
+// middleware.AdminAuth. If reg is not nil, it is served at /metrics. If auditor is not nil, logins
+// and admin actions are recorded with it.
+func NewAdminRouter(h AdminHandler, log *zap.Logger, token string, reg *metrics.Registry, auditor *audit.Auditor) http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middleware.TraceContext(tracing.Propagator{}))
+	r.Use(middleware.Logger(log))
+	r.Use(middleware.Recoverer(http.HandlerFunc(h.InternalServerError)))
+
+	if auditor != nil {
+		r.Use(middleware.Audit(auditor))
+	}
+
+	r.Use(middleware.AdminAuth(token, http.HandlerFunc(h.Unauthorized)))
+
+	r.NotFound(h.NotFound)
+
+	r.Get("/routes", h.Routes)
+	r.Get("/config", h.Config)
+	r.Get("/build", h.Build)
+	r.Get("/goroutines", h.Goroutines)
+	r.Get("/log-level", h.LogLevel)
+	r.Put("/log-level", h.SetLogLevel)
+	r.Delete("/log-level", h.DeleteLogLevel)
+	r.Get("/api-keys", h.ListAPIKeys)
+	r.Post("/api-keys", h.CreateAPIKey)
+	r.Post("/api-keys/{id}/rotate", h.RotateAPIKey)
+	r.Delete("/api-keys/{id}", h.RevokeAPIKey)
+	r.Get("/audit-events", h.AuditEvents)
+
+	if reg != nil {
+		r.Method(http.MethodGet, "/metrics", metrics.Handler(reg))
+	}
+
+	r.Route("/debug/pprof", func(r chi.Router) {
+		r.Get("/*", pprof.Index)
+		r.Get("/cmdline", pprof.Cmdline)
+		r.Get("/profile", pprof.Profile)
+		r.Get("/symbol", pprof.Symbol)
+		r.Post("/symbol", pprof.Symbol)
+		r.Get("/trace", pprof.Trace)
+	})
+
+	return r
+}
@@ -0,0 +1,286 @@
+package router_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/chiapi/handler"
+	"github.com/rickbassham/example-go/chiapi/router"
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/env"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+type adminTestConfig struct {
+	ListenAddress string `env:"LISTEN_ADDRESS"`
+	JWTAuthSecret string `env:"JWT_AUTH_SECRET" secret:"true"`
+	RedisPassword string `env:"REDIS_PASSWORD"`
+}
+
+func newAdminServer(t *testing.T) *httptest.Server {
+	events := audit.NewMemory(100)
+
+	api := router.NewRouter(&mockHandler{}, zap.NewNop(), instrumentation.NewMemory(), nil, "my-version", testCORS)
+
+	config := &adminTestConfig{
+		ListenAddress: ":8080",
+		JWTAuthSecret: "my-key",
+		RedisPassword: "hunter2",
+	}
+	sources := env.Sources{"LISTEN_ADDRESS": env.SourceEnv, "JWT_AUTH_SECRET": "secret_file:/run/secrets/jwt"}
+
+	h := handler.NewAdmin(api, func() map[string]env.Value {
+		return env.Dump(config, sources)
+	}, handler.BuildInfo{Version: "my-version"}, logging.NewLevels(zapcore.InfoLevel), auth.NewAPIKeys(auth.NewMemoryAPIKeyStore()), events)
+
+	return httptest.NewServer(router.NewAdminRouter(h, zap.NewNop(), "admin-token", nil, audit.New(events)))
+}
+
+func adminGet(t *testing.T, s *httptest.Server, path, token string) (int, []byte) {
+	req, err := http.NewRequest("GET", s.URL+path, nil)
+	require.NoError(t, err)
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, body
+}
+
+func adminDo(t *testing.T, s *httptest.Server, method, path, body string) (int, []byte) {
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+
+	req.Header.Set("Authorization", "Bearer admin-token")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, respBody
+}
+
+func adminStatus(t *testing.T, s *httptest.Server, path, token string) int {
+	status, _ := adminGet(t, s, path, token)
+	return status
+}
+
+func TestAdminRouter_Unauthorized(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	for _, path := range []string{"/routes", "/config", "/debug/pprof/", "/nope"} {
+		assert.Equal(t, 401, adminStatus(t, s, path, ""), path)
+		assert.Equal(t, 401, adminStatus(t, s, path, "wrong"), path)
+	}
+}
+
+func TestAdminRouter_Routes(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	status, body := adminGet(t, s, "/routes", "admin-token")
+	require.Equal(t, 200, status)
+
+	var routes []handler.Route
+	require.NoError(t, json.Unmarshal(body, &routes))
+
+	var protected *handler.Route
+
+	for i := range routes {
+		if routes[i].Pattern == "/protected/{id:[0-9]+}" {
+			protected = &routes[i]
+		}
+	}
+
+	require.NotNil(t, protected)
+	assert.Equal(t, "GET", protected.Method)
+	assert.Contains(t, protected.Middlewares, "middleware.Logger")
+	assert.Contains(t, protected.Middlewares, "jwtauth.Verifier")
+	assert.Contains(t, protected.Middlewares, "middleware.User")
+}
+
+func TestAdminRouter_Config(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	status, body := adminGet(t, s, "/config", "admin-token")
+	require.Equal(t, 200, status)
+
+	var config map[string]env.Value
+	require.NoError(t, json.Unmarshal(body, &config))
+
+	assert.Equal(t, map[string]env.Value{
+		"LISTEN_ADDRESS":  {Value: ":8080", Source: "env"},
+		"JWT_AUTH_SECRET": {Value: "[REDACTED]", Source: "secret_file:/run/secrets/jwt"},
+		"REDIS_PASSWORD":  {Value: "[REDACTED]"},
+	}, config)
+}
+
+func TestAdminRouter_Debug(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	assert.Equal(t, 200, adminStatus(t, s, "/build", "admin-token"))
+	assert.Equal(t, 200, adminStatus(t, s, "/goroutines", "admin-token"))
+	assert.Equal(t, 200, adminStatus(t, s, "/debug/pprof/", "admin-token"))
+	assert.Equal(t, 200, adminStatus(t, s, "/debug/pprof/heap", "admin-token"))
+	assert.Equal(t, 404, adminStatus(t, s, "/nope", "admin-token"))
+}
+
+func TestAdminRouter_LogLevel(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	status, _ := adminDo(t, s, "PUT", "/log-level", `{"level":"nope"}`)
+	assert.Equal(t, 400, status)
+
+	status, _ = adminDo(t, s, "PUT", "/log-level", `{"level":"debug","scope":"/protected/*","ttl":"10m"}`)
+	assert.Equal(t, 200, status)
+
+	status, body := adminDo(t, s, "PUT", "/log-level", `{"level":"warn"}`)
+	require.Equal(t, 200, status)
+
+	var resp handler.LogLevelResponse
+	require.NoError(t, json.Unmarshal(body, &resp))
+
+	assert.Equal(t, "warn", resp.Level)
+	require.Len(t, resp.Overrides, 1)
+	assert.Equal(t, "/protected/*", resp.Overrides[0].Scope)
+	assert.Equal(t, "debug", resp.Overrides[0].Level)
+	assert.Equal(t, "token", resp.Overrides[0].SetBy)
+	assert.False(t, resp.Overrides[0].Expires.IsZero())
+
+	status, _ = adminDo(t, s, "DELETE", "/log-level?scope=/protected/*", "")
+	assert.Equal(t, 200, status)
+
+	status, _ = adminDo(t, s, "DELETE", "/log-level?scope=/protected/*", "")
+	assert.Equal(t, 404, status)
+}
+
+func TestAdminRouter_APIKeys(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	status, _ := adminDo(t, s, "POST", "/api-keys", `{"name":"ci"}`)
+	assert.Equal(t, 400, status)
+
+	status, body := adminDo(t, s, "POST", "/api-keys", `{"name":"ci","owner":"svc-ci","scopes":["read"],"ttl":"24h"}`)
+	require.Equal(t, 201, status)
+
+	var created handler.APIKeyResponse
+	require.NoError(t, json.Unmarshal(body, &created))
+
+	assert.True(t, strings.HasPrefix(created.Key, "ak_"+created.ID+"_"))
+	assert.Equal(t, "svc-ci", created.Owner)
+	assert.Equal(t, []string{"read"}, created.Scopes)
+	assert.Equal(t, "token", created.CreatedBy)
+	assert.False(t, created.ExpiresAt.IsZero())
+	assert.NotContains(t, string(body), "hash")
+
+	status, body = adminDo(t, s, "POST", "/api-keys/"+created.ID+"/rotate", "")
+	require.Equal(t, 201, status)
+
+	var rotated handler.APIKeyResponse
+	require.NoError(t, json.Unmarshal(body, &rotated))
+
+	assert.NotEqual(t, created.ID, rotated.ID)
+	assert.NotEqual(t, created.Key, rotated.Key)
+	assert.Equal(t, []string{"read"}, rotated.Scopes)
+
+	status, body = adminGet(t, s, "/api-keys", "admin-token")
+	require.Equal(t, 200, status)
+
+	var keys []handler.APIKeyResponse
+	require.NoError(t, json.Unmarshal(body, &keys))
+	require.Len(t, keys, 2)
+
+	for _, k := range keys {
+		assert.Empty(t, k.Key)
+
+		if k.ID == created.ID {
+			assert.False(t, k.RevokedAt.IsZero())
+			assert.Equal(t, rotated.ID, k.ReplacedBy)
+		}
+	}
+
+	status, _ = adminDo(t, s, "POST", "/api-keys/"+created.ID+"/rotate", "")
+	assert.Equal(t, 400, status)
+
+	status, body = adminDo(t, s, "DELETE", "/api-keys/"+rotated.ID, "")
+	require.Equal(t, 200, status)
+
+	var revoked handler.APIKeyResponse
+	require.NoError(t, json.Unmarshal(body, &revoked))
+	assert.Equal(t, "token", revoked.RevokedBy)
+
+	status, _ = adminDo(t, s, "DELETE", "/api-keys/nope", "")
+	assert.Equal(t, 404, status)
+}
+
+func TestAdminRouter_AuditEvents(t *testing.T) {
+	s := newAdminServer(t)
+	defer s.Close()
+
+	assert.Equal(t, 401, adminStatus(t, s, "/build", "wrong-token"))
+
+	status, _ := adminDo(t, s, "PUT", "/log-level", `{"level":"warn"}`)
+	require.Equal(t, 200, status)
+
+	status, body := adminDo(t, s, "GET", "/audit-events?type=admin_action", "")
+	require.Equal(t, 200, status)
+
+	var events []audit.Event
+	require.NoError(t, json.Unmarshal(body, &events))
+
+	require.Len(t, events, 1)
+	assert.Equal(t, "log_level.set", events[0].Action)
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, "token", events[0].Principal)
+	assert.Equal(t, "warn", events[0].Details["level"])
+	assert.NotEmpty(t, events[0].ClientIP)
+
+	status, body = adminDo(t, s, "GET", "/audit-events?type=authentication&limit=1000", "")
+	require.Equal(t, 200, status)
+
+	events = nil
+	require.NoError(t, json.Unmarshal(body, &events))
+
+	require.NotEmpty(t, events)
+	failed := events[len(events)-1]
+	assert.Equal(t, audit.OutcomeFailure, failed.Outcome)
+	assert.Empty(t, failed.Principal)
+
+	status, body = adminDo(t, s, "GET", "/audit-events?principal=nobody", "")
+	require.Equal(t, 200, status)
+	assert.JSONEq(t, "[]", string(body))
+
+	status, _ = adminDo(t, s, "GET", "/audit-events?limit=1001", "")
+	assert.Equal(t, 400, status)
+
+	status, _ = adminDo(t, s, "GET", "/audit-events?from=yesterday", "")
+	assert.Equal(t, 400, status)
+}
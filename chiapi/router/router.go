@@ -5,12 +5,18 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi"
-	"github.com/go-chi/cors"
 	"github.com/go-chi/jwtauth"
-	newrelic "github.com/newrelic/go-agent"
 	"go.uber.org/zap"
 
 	"github.com/rickbassham/example-go/chiapi/middleware"
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/feature"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/metrics"
+	"github.com/rickbassham/example-go/pkg/redact"
+	"github.com/rickbassham/example-go/pkg/tracing"
 )
 
 // Handler exposes the functions for handling web requests.
@@ -20,35 +26,417 @@ type Handler interface {
 	Protected(w http.ResponseWriter, r *http.Request)
 	NotFound(w http.ResponseWriter, r *http.Request)
 	Unauthorized(w http.ResponseWriter, r *http.Request)
+	Forbidden(w http.ResponseWriter, r *http.Request)
+	InternalServerError(w http.ResponseWriter, r *http.Request)
+	ServiceUnavailable(w http.ResponseWriter, r *http.Request)
+	CSPReport(w http.ResponseWriter, r *http.Request)
 }
 
-// NewRouter creates a new CORS enabled router for our API. All requests will be logged and
-// instrumented with New Relic.
-func NewRouter(h Handler, log *zap.Logger, nr newrelic.Application, tokenAuth *jwtauth.JWTAuth, version, corsOrigin string) http.Handler {
+// Option is used to enable optional router features.
+type Option func(*options)
+
+type options struct {
+	concurrencyLimits map[string]middleware.ConcurrencyLimitOptions
+	propagator        tracing.Propagator
+	tracer            *tracing.Tracer
+	metrics           *metrics.Registry
+	metricsEndpoint   *metrics.Registry
+	redaction         *redact.Policy
+	capture           *middleware.CaptureOptions
+	verifier          middleware.TokenVerifier
+	claimsPolicy      *auth.ClaimsPolicy
+	claimMapping      *identity.ClaimMapping
+	roleSource        auth.RoleSource
+	requiredScopes    []string
+	apiKeys           middleware.APIKeyAuthenticator
+	tokens            TokenHandler
+	revoked           auth.RevocationList
+	sessionHandler    SessionHandler
+	sessions          middleware.SessionAuthenticator
+	tenants           *middleware.TenantOptions
+	auditor           *audit.Auditor
+	securityHeaders   *middleware.SecurityHeaderOptions
+	features          *feature.Flags
+}
+
+// CSPReportPath is where the router collects Content-Security-Policy violation reports, when the
+// security headers are enabled; see WithSecurityHeaders.
+const CSPReportPath = "/csp-report"
+
+// WithSecurityHeaders sets the security headers of the options, such as
+// middleware.APISecurityHeaders, on every response, and collects the violation reports of the
+// Content-Security-Policy at POST /csp-report; see middleware.SecurityHeaders.
+func WithSecurityHeaders(o middleware.SecurityHeaderOptions) Option {
+	return func(opts *options) {
+		opts.securityHeaders = &o
+	}
+}
+
+// WithFeatures adds the feature flags to the context of every request; see feature.Enabled.
+func WithFeatures(f *feature.Flags) Option {
+	return func(opts *options) {
+		opts.features = f
+	}
+}
+
+// WithAuditor records security relevant events, such as rejected tokens and denied requests, with
+// the auditor; see middleware.Audit.
+func WithAuditor(a *audit.Auditor) Option {
+	return func(opts *options) {
+		opts.auditor = a
+	}
+}
+
+// WithTenants serves several tenants. The tenant of each request is read from its subdomain or
+// header, as set by the options, or from the token, and must be the tenant of the principal on
+// protected routes; see middleware.ResolveTenant and middleware.Tenant.
+func WithTenants(o middleware.TenantOptions) Option {
+	return func(opts *options) {
+		opts.tenants = &o
+	}
+}
+
+// SessionHandler exposes the functions for logging in with a session cookie, and managing sessions.
+type SessionHandler interface {
+	Login(w http.ResponseWriter, r *http.Request)
+	Current(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Revoke(w http.ResponseWriter, r *http.Request)
+}
+
+// WithSessions accepts session cookies, looked up in sessions, on protected routes in addition to
+// tokens, guarding them with a CSRF token; see middleware.Session and middleware.CSRF. It serves the
+// session endpoints: POST /auth/session to log in, and GET and DELETE /auth/session, GET
+// /auth/sessions and DELETE /auth/sessions/{id}, which require a session or a token.
+func WithSessions(h SessionHandler, sessions middleware.SessionAuthenticator) Option {
+	return func(opts *options) {
+		opts.sessionHandler = h
+		opts.sessions = sessions
+	}
+}
+
+// TokenHandler exposes the functions for issuing and revoking tokens.
+type TokenHandler interface {
+	Login(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+}
+
+// WithTokens serves the token endpoints: POST /auth/token to log in, POST /auth/refresh to refresh
+// tokens, and POST /auth/logout, which requires a token, to revoke them.
+func WithTokens(h TokenHandler) Option {
+	return func(opts *options) {
+		opts.tokens = h
+	}
+}
+
+// WithRevocationList rejects tokens whose jti claim has been revoked, such as by logging out; see
+// middleware.Authenticator.
+func WithRevocationList(l auth.RevocationList) Option {
+	return func(opts *options) {
+		opts.revoked = l
+	}
+}
+
+// WithAPIKeys accepts API keys, such as those issued by an auth.APIKeys, on protected routes, in
+// addition to tokens; see middleware.APIKey.
+func WithAPIKeys(keys middleware.APIKeyAuthenticator) Option {
+	return func(opts *options) {
+		opts.apiKeys = keys
+	}
+}
+
+// WithRoleSource adds the roles granted by the source, such as a database table, to the roles from
+// the token of protected requests; see middleware.LoadRoles.
+func WithRoleSource(src auth.RoleSource) Option {
+	return func(opts *options) {
+		opts.roleSource = src
+	}
+}
+
+// WithRequiredScopes rejects protected requests whose token does not have every one of the scopes,
+// with a 403; see middleware.RequireScopes.
+func WithRequiredScopes(scopes ...string) Option {
+	return func(opts *options) {
+		opts.requiredScopes = scopes
+	}
+}
+
+// WithClaimMapping reads the principal of protected requests from the token claims named by the
+// mapping. By default, identity.DefaultClaimMapping is used.
+func WithClaimMapping(m identity.ClaimMapping) Option {
+	return func(opts *options) {
+		opts.claimMapping = &m
+	}
+}
+
+// WithClaimsPolicy rejects tokens on protected routes whose claims the policy does not accept; see
+// middleware.ValidateClaims.
+func WithClaimsPolicy(p auth.ClaimsPolicy) Option {
+	return func(opts *options) {
+		opts.claimsPolicy = &p
+	}
+}
+
+// WithTokenVerifier verifies the tokens on protected routes with v, such as an auth.Verifier for
+// tokens signed by keys from a JWKS document, instead of the tokenAuth given to NewRouter.
+func WithTokenVerifier(v middleware.TokenVerifier) Option {
+	return func(opts *options) {
+		opts.verifier = v
+	}
+}
+
+// WithBodyCapture logs the request and response bodies of the requests selected by the options; see
+// middleware.CaptureBodies.
+func WithBodyCapture(o middleware.CaptureOptions) Option {
+	return func(opts *options) {
+		opts.capture = &o
+	}
+}
+
+// WithRedaction masks data in request logs, redis and sql logs, outgoing request logs and
+// transaction attributes with the policy. By default, redact.Default is used.
+func WithRedaction(p *redact.Policy) Option {
+	return func(opts *options) {
+		opts.redaction = p
+	}
+}
+
+// WithMetrics records request counts and latencies in the registry.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(opts *options) {
+		opts.metrics = reg
+	}
+}
+
+// WithMetricsEndpoint serves the registry at GET /metrics. Use it when there is no admin listener to
+// serve the metrics from instead. The endpoint is never shed by the concurrency limit.
+func WithMetricsEndpoint(reg *metrics.Registry) Option {
+	return func(opts *options) {
+		opts.metricsEndpoint = reg
+	}
+}
+
+// WithTracer records a span for every request, and for the redis, sql and http calls made while
+// handling it.
+func WithTracer(t *tracing.Tracer) Option {
+	return func(opts *options) {
+		opts.tracer = t
+	}
+}
+
+// WithTracePropagation sets which trace header formats are understood. By default, only W3C Trace
+// Context and X-Trace-Id are.
+func WithTracePropagation(p tracing.Propagator) Option {
+	return func(opts *options) {
+		opts.propagator = p
+	}
+}
+
+// The route groups of the API, each of which has its own concurrency limit; see
+// WithConcurrencyLimit. GroupDefault is every route outside of the other groups.
+const (
+	GroupDefault   = "/"
+	GroupAuth      = "/auth"
+	GroupProtected = "/protected"
+)
+
+// WithConcurrencyLimit caps the number of in flight requests of the route groups, shedding the
+// excess. Each group has its own limit, so a slow group does not shed the requests of the others. If
+// no groups are given, it is used for every group; a later option replaces it for the groups it
+// names. The requests are classified by the Priority of the options, but the health check and
+// metrics endpoint are never shed.
+func WithConcurrencyLimit(o middleware.ConcurrencyLimitOptions, groups ...string) Option {
+	return func(opts *options) {
+		if len(groups) == 0 {
+			groups = []string{GroupDefault, GroupAuth, GroupProtected}
+		}
+
+		if opts.concurrencyLimits == nil {
+			opts.concurrencyLimits = map[string]middleware.ConcurrencyLimitOptions{}
+		}
+
+		for _, group := range groups {
+			opts.concurrencyLimits[group] = o
+		}
+	}
+}
+
+// NewRouter creates a new CORS enabled router for our API, with the CORS policies of cors, which can
+// be updated while it is running; see middleware.CORSHandler. All requests will be logged and
+// instrumented.
+func NewRouter(h Handler, log *zap.Logger, app instrumentation.Application, tokenAuth *jwtauth.JWTAuth, version string, cors *middleware.CORSHandler, opt ...Option) http.Handler {
+	var o options
+	for _, fn := range opt {
+		fn(&o)
+	}
+
+	claimMapping := identity.DefaultClaimMapping
+	if o.claimMapping != nil {
+		claimMapping = *o.claimMapping
+	}
+
 	r := chi.NewRouter()
 
-	cors := cors.New(cors.Options{
-		AllowedOrigins:   []string{corsOrigin},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	})
+	if o.redaction != nil {
+		r.Use(middleware.Redact(o.redaction))
+	}
 
 	r.Use(middleware.Version(version))
-	r.Use(middleware.TraceID)
+
+	if o.securityHeaders != nil {
+		r.Use(middleware.SecurityHeaders(*o.securityHeaders))
+	}
+
+	r.Use(middleware.TraceContext(o.propagator))
+
+	if o.tracer != nil {
+		r.Use(middleware.Tracing(o.tracer))
+	}
+
 	r.Use(middleware.Logger(log))
-	r.Use(middleware.NewRelicChiRouter(nr))
+	r.Use(middleware.Instrument(app))
+
+	if o.metrics != nil {
+		r.Use(middleware.Metrics(o.metrics))
+	}
+
+	if o.capture != nil {
+		r.Use(middleware.CaptureBodies(*o.capture))
+	}
+
+	r.Use(middleware.Recoverer(http.HandlerFunc(h.InternalServerError)))
 	r.Use(cors.Handler)
+
+	if o.auditor != nil {
+		r.Use(middleware.Audit(o.auditor))
+	}
+
+	if o.features != nil {
+		r.Use(middleware.Features(o.features))
+	}
+
+	if o.tenants != nil {
+		r.Use(middleware.ResolveTenant(*o.tenants, http.HandlerFunc(h.Forbidden)))
+	}
+
+	// limit sheds the requests of the route group over its concurrency limit, with a limiter of its
+	// own.
+	limit := func(r chi.Router, group string) {
+		cl, ok := o.concurrencyLimits[group]
+		if !ok {
+			return
+		}
+
+		priority := cl.Priority
+		critical := map[string]bool{"/health": true, "/metrics": true}
+
+		cl.Priority = func(r *http.Request) middleware.Priority {
+			if critical[r.URL.Path] {
+				return middleware.PriorityCritical
+			}
+
+			if priority != nil {
+				return priority(r)
+			}
+
+			return middleware.PriorityNormal
+		}
+		cl.Rejected = http.HandlerFunc(h.ServiceUnavailable)
+
+		r.Use(middleware.ConcurrencyLimit(cl))
+	}
+
 	r.NotFound(h.NotFound)
 
-	r.Get("/health", h.Health)
-	r.Get("/cached", h.Cached)
+	r.Group(func(r chi.Router) {
+		limit(r, GroupDefault)
+
+		r.Get("/health", h.Health)
+		r.Get("/cached", h.Cached)
+
+		if o.metricsEndpoint != nil {
+			r.Method(http.MethodGet, "/metrics", metrics.Handler(o.metricsEndpoint))
+		}
+
+		if o.securityHeaders != nil {
+			r.Post(CSPReportPath, h.CSPReport)
+		}
+	})
+
+	// authenticate adds the middleware that verifies the session or token, and adds its principal
+	// to the request context, checking its tenant.
+	authenticate := func(r chi.Router) {
+		if o.sessions != nil {
+			r.Use(middleware.Session(o.sessions, http.HandlerFunc(h.Unauthorized), http.HandlerFunc(h.ServiceUnavailable)))
+			r.Use(middleware.CSRF(http.HandlerFunc(h.Forbidden)))
+		}
+
+		if o.verifier != nil {
+			r.Use(middleware.Verifier(o.verifier))
+		} else {
+			r.Use(jwtauth.Verifier(tokenAuth))
+		}
+		r.Use(middleware.Authenticator(http.HandlerFunc(h.Unauthorized), http.HandlerFunc(h.ServiceUnavailable), o.revoked))
+
+		if o.claimsPolicy != nil {
+			r.Use(middleware.ValidateClaims(*o.claimsPolicy, http.HandlerFunc(h.Unauthorized)))
+		}
+
+		r.Use(middleware.User(claimMapping))
+
+		if o.tenants != nil {
+			r.Use(middleware.Tenant(http.HandlerFunc(h.Forbidden)))
+		}
+	}
+
+	if o.tokens != nil || o.sessionHandler != nil {
+		r.Route(GroupAuth, func(r chi.Router) {
+			limit(r, GroupAuth)
+
+			if o.tokens != nil {
+				r.Post("/token", o.tokens.Login)
+				r.Post("/refresh", o.tokens.Refresh)
+			}
+
+			if o.sessionHandler != nil {
+				r.Post("/session", o.sessionHandler.Login)
+			}
+
+			r.Group(func(r chi.Router) {
+				authenticate(r)
+
+				if o.tokens != nil {
+					r.Post("/logout", o.tokens.Logout)
+				}
+
+				if o.sessionHandler != nil {
+					r.Get("/session", o.sessionHandler.Current)
+					r.Delete("/session", o.sessionHandler.Logout)
+					r.Get("/sessions", o.sessionHandler.List)
+					r.Delete("/sessions/{id}", o.sessionHandler.Revoke)
+				}
+			})
+		})
+	}
+
+	r.Route(GroupProtected, func(r chi.Router) {
+		limit(r, GroupProtected)
+
+		if o.apiKeys != nil {
+			r.Use(middleware.APIKey(o.apiKeys, http.HandlerFunc(h.Unauthorized), http.HandlerFunc(h.ServiceUnavailable)))
+		}
+
+		authenticate(r)
+
+		if o.roleSource != nil {
+			r.Use(middleware.LoadRoles(o.roleSource))
+		}
 
-	r.Route("/protected", func(r chi.Router) {
-		r.Use(jwtauth.Verifier(tokenAuth))
-		r.Use(middleware.Authenticator(http.HandlerFunc(h.Unauthorized)))
-		r.Use(middleware.User)
+		if len(o.requiredScopes) > 0 {
+			r.Use(middleware.RequireScopes(http.HandlerFunc(h.Forbidden), o.requiredScopes...))
+		}
 
 		r.Get("/{id:[0-9]+}", h.Protected)
 	})
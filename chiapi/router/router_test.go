@@ -1,24 +1,29 @@
 package router_test
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/jwtauth"
-	newrelic "github.com/newrelic/go-agent"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/rickbassham/example-go/chiapi/handler"
+	"github.com/rickbassham/example-go/chiapi/middleware"
 	"github.com/rickbassham/example-go/chiapi/router"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/metrics"
 )
 
+var testCORS = middleware.NewCORSHandler(middleware.CORSOptions{Default: middleware.DefaultCORSPolicy("http://example.com")})
+
 type mockHandler struct {
 	mock.Mock
 }
@@ -43,159 +48,105 @@ func (m *mockHandler) Unauthorized(w http.ResponseWriter, r *http.Request) {
 	m.Called(w, r)
 }
 
-type mockNewRelicApp struct {
-	mock.Mock
-}
-
-func (m *mockNewRelicApp) StartTransaction(name string, w http.ResponseWriter, r *http.Request) newrelic.Transaction {
-	return m.Called(name, w, r).Get(0).(newrelic.Transaction)
-}
-
-func (m *mockNewRelicApp) RecordCustomEvent(eventType string, params map[string]interface{}) error {
-	return m.Called(eventType, params).Error(0)
-}
-
-func (m *mockNewRelicApp) RecordCustomMetric(name string, value float64) error {
-	return m.Called(name, value).Error(0)
-}
-
-func (m *mockNewRelicApp) WaitForConnection(timeout time.Duration) error {
-	return m.Called(timeout).Error(0)
-}
-
-func (m *mockNewRelicApp) Shutdown(timeout time.Duration) {
-	m.Called(timeout)
-}
-
-type mockNewRelicTxn struct {
-	mock.Mock
-
-	w http.ResponseWriter
+func (m *mockHandler) Forbidden(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
 }
 
-func (m *mockNewRelicTxn) Header() http.Header {
-	m.Called()
-	return m.w.Header()
+func (m *mockHandler) InternalServerError(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
 }
 
-func (m *mockNewRelicTxn) Write(d []byte) (int, error) {
-	m.Called(d)
-	return m.w.Write(d)
+func (m *mockHandler) ServiceUnavailable(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
 }
 
-func (m *mockNewRelicTxn) WriteHeader(statusCode int) {
-	m.Called(statusCode)
-	m.w.WriteHeader(statusCode)
+func (m *mockHandler) CSPReport(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (m *mockNewRelicTxn) End() error {
-	return m.Called().Error(0)
-}
+// requireTransaction asserts exactly one transaction was recorded and that it was ended.
+func requireTransaction(t *testing.T, app *instrumentation.Memory) *instrumentation.MemoryTransaction {
+	txns := app.Transactions()
+	require.Len(t, txns, 1)
+	require.True(t, txns[0].Ended())
 
-func (m *mockNewRelicTxn) Ignore() error {
-	return m.Called().Error(0)
-}
+	assert.Contains(t, txns[0].Attributes(), "X-Trace-Id")
 
-func (m *mockNewRelicTxn) SetName(name string) error {
-	return m.Called(name).Error(0)
+	return txns[0]
 }
 
-func (m *mockNewRelicTxn) NoticeError(err error) error {
-	return m.Called(err).Error(0)
-}
+func TestRouter_Health(t *testing.T) {
+	log := zap.NewExample()
 
-func (m *mockNewRelicTxn) AddAttribute(key string, value interface{}) error {
-	return m.Called(key, value).Error(0)
-}
+	h := &mockHandler{}
+	app := instrumentation.NewMemory()
 
-func (m *mockNewRelicTxn) SetWebRequest(r newrelic.WebRequest) error {
-	return m.Called(r).Error(0)
-}
+	h.On("Health", mock.Anything, mock.Anything).Return()
 
-func (m *mockNewRelicTxn) SetWebResponse(w http.ResponseWriter) newrelic.Transaction {
-	return m.Called(w).Get(0).(newrelic.Transaction)
-}
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS)
 
-func (m *mockNewRelicTxn) StartSegmentNow() newrelic.SegmentStartTime {
-	return m.Called().Get(0).(newrelic.SegmentStartTime)
-}
+	s := httptest.NewServer(rtr)
+	defer s.Close()
 
-func (m *mockNewRelicTxn) CreateDistributedTracePayload() newrelic.DistributedTracePayload {
-	return m.Called().Get(0).(newrelic.DistributedTracePayload)
-}
+	req, err := http.NewRequest("GET", s.URL+"/health", nil)
+	require.NoError(t, err)
 
-func (m *mockNewRelicTxn) AcceptDistributedTracePayload(t newrelic.TransportType, payload interface{}) error {
-	return m.Called(t, payload).Error(0)
-}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
 
-func (m *mockNewRelicTxn) Application() newrelic.Application {
-	return m.Called().Get(0).(newrelic.Application)
-}
+	assert.Equal(t, 200, resp.StatusCode)
 
-func (m *mockNewRelicTxn) BrowserTimingHeader() (*newrelic.BrowserTimingHeader, error) {
-	args := m.Called()
-	return args.Get(0).(*newrelic.BrowserTimingHeader), args.Error(1)
-}
+	h.AssertExpectations(t)
 
-func (m *mockNewRelicTxn) NewGoroutine() newrelic.Transaction {
-	return m.Called().Get(0).(newrelic.Transaction)
+	txn := requireTransaction(t, app)
+	assert.Equal(t, "/health", txn.Name())
 }
 
-func TestRouter_Health(t *testing.T) {
+func TestRouter_Metrics(t *testing.T) {
 	log := zap.NewExample()
 
 	h := &mockHandler{}
-	nr := &mockNewRelicApp{}
-	txn := &mockNewRelicTxn{}
-
-	nr.On("StartTransaction", "/health", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-		txn.w = args.Get(1).(http.ResponseWriter)
-	}).Return(txn)
-	txn.On("Header")
-	txn.On("AddAttribute", "X-Trace-Id", mock.Anything).Return(nil)
-	txn.On("SetName", "/health").Return(nil)
-	txn.On("End").Return(nil)
+	app := instrumentation.NewMemory()
+	reg := metrics.NewRegistry()
+
 	h.On("Health", mock.Anything, mock.Anything).Return()
 
-	rtr := router.NewRouter(h, log, nr, nil, "my-version", "http://example.com")
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS,
+		router.WithMetrics(reg),
+		router.WithMetricsEndpoint(reg),
+	)
 
 	s := httptest.NewServer(rtr)
 	defer s.Close()
 
-	req, err := http.NewRequest("GET", s.URL+"/health", nil)
+	resp, err := http.Get(s.URL + "/health")
 	require.NoError(t, err)
+	resp.Body.Close()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err = http.Get(s.URL + "/metrics")
 	require.NoError(t, err)
+	defer resp.Body.Close()
 
-	assert.Equal(t, 200, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
 
-	h.AssertExpectations(t)
-	nr.AssertExpectations(t)
-	txn.AssertExpectations(t)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, string(body), `http_server_requests_total{route="/health",method="GET",status="2xx"} 1`)
 }
 
 func TestRouter_NotFound(t *testing.T) {
 	log := zap.NewExample()
 
 	h := &mockHandler{}
-	nr := &mockNewRelicApp{}
-	txn := &mockNewRelicTxn{}
+	app := instrumentation.NewMemory()
 
-	nr.On("StartTransaction", "/abcd", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-		txn.w = args.Get(1).(http.ResponseWriter)
-	}).Return(txn)
-
-	txn.On("Header")
-	txn.On("WriteHeader", 404)
-	txn.On("AddAttribute", "X-Trace-Id", mock.Anything).Return(nil)
-	txn.On("End").Return(nil)
 	h.On("NotFound", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
 		w := args.Get(0).(http.ResponseWriter)
 		w.WriteHeader(404)
 	}).Return()
 
-	rtr := router.NewRouter(h, log, nr, nil, "my-version", "http://example.com")
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS)
 
 	s := httptest.NewServer(rtr)
 	defer s.Close()
@@ -209,26 +160,16 @@ func TestRouter_NotFound(t *testing.T) {
 	assert.Equal(t, 404, resp.StatusCode)
 
 	h.AssertExpectations(t)
-	nr.AssertExpectations(t)
-	txn.AssertExpectations(t)
+
+	txn := requireTransaction(t, app)
+	assert.Equal(t, "/abcd", txn.Name())
 }
 
 func TestRouter_NoToken(t *testing.T) {
 	log := zap.NewExample()
 
 	h := &mockHandler{}
-	nr := &mockNewRelicApp{}
-	txn := &mockNewRelicTxn{}
-
-	nr.On("StartTransaction", "/protected/1", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-		txn.w = args.Get(1).(http.ResponseWriter)
-	}).Return(txn)
-
-	txn.On("Header")
-	txn.On("WriteHeader", 401)
-	txn.On("AddAttribute", "X-Trace-Id", mock.Anything).Return(nil)
-	txn.On("SetName", "/protected").Return(nil)
-	txn.On("End").Return(nil)
+	app := instrumentation.NewMemory()
 
 	// make sure we call the Unauthorized func on this request.
 	h.On("Unauthorized", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
@@ -236,7 +177,7 @@ func TestRouter_NoToken(t *testing.T) {
 		w.WriteHeader(401)
 	}).Return()
 
-	rtr := router.NewRouter(h, log, nr, nil, "my-version", "http://example.com")
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS)
 
 	s := httptest.NewServer(rtr)
 	defer s.Close()
@@ -251,34 +192,88 @@ func TestRouter_NoToken(t *testing.T) {
 
 	// All mocks used should assert that they met their expectations.
 	h.AssertExpectations(t)
-	nr.AssertExpectations(t)
-	txn.AssertExpectations(t)
+
+	txn := requireTransaction(t, app)
+	assert.Equal(t, "/protected", txn.Name())
 }
 
-func TestRouter_ValidToken(t *testing.T) {
+func TestRouter_ConcurrencyLimit(t *testing.T) {
 	log := zap.NewExample()
 
-	h := &handler.Handler{}
-	nr := &mockNewRelicApp{}
-	txn := &mockNewRelicTxn{}
+	h := &mockHandler{}
+	app := instrumentation.NewMemory()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	h.On("Cached", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+	}).Return().Once()
+
+	h.On("ServiceUnavailable", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		w := args.Get(0).(http.ResponseWriter)
+		w.WriteHeader(503)
+	}).Return()
+
+	h.On("Unauthorized", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		w := args.Get(0).(http.ResponseWriter)
+		w.WriteHeader(401)
+	}).Return()
+
+	h.On("Health", mock.Anything, mock.Anything).Return()
+
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS,
+		router.WithConcurrencyLimit(middleware.ConcurrencyLimitOptions{InitialLimit: 1, MaxLimit: 1}),
+	)
+
+	s := httptest.NewServer(rtr)
+	defer s.Close()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		resp, err := http.Get(s.URL + "/cached")
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+
+	get := func(path string) int {
+		resp, err := http.Get(s.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	// The default group is at its limit, but the health check is never shed, and the protected
+	// routes have a limit of their own.
+	assert.Equal(t, 503, get("/cached"))
+	assert.Equal(t, 200, get("/health"))
+	assert.Equal(t, 401, get("/protected/1"))
+
+	close(release)
+	<-done
+
+	h.AssertExpectations(t)
+}
 
-	nr.On("StartTransaction", "/protected/1", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-		txn.w = args.Get(1).(http.ResponseWriter)
-	}).Return(txn)
+func TestRouter_ValidToken(t *testing.T) {
+	log := zap.NewExample()
 
-	txn.On("Header")
-	txn.On("WriteHeader", 200)
-	txn.On("Write", mock.Anything)
-	txn.On("AddAttribute", "X-Trace-Id", mock.Anything).Return(nil)
-	txn.On("AddAttribute", "id", "1").Return(nil)
-	txn.On("SetName", "/protected/{id:[0-9]+}").Return(nil)
-	txn.On("End").Return(nil)
+	h := &handler.Handler{}
+	app := instrumentation.NewMemory()
 
 	signingKey := []byte("my-key")
 
 	auth := jwtauth.New("HS256", signingKey, nil)
 
-	rtr := router.NewRouter(h, log, nr, auth, "my-version", "http://example.com")
+	rtr := router.NewRouter(h, log, app, auth, "my-version", testCORS)
 
 	s := httptest.NewServer(rtr)
 	defer s.Close()
@@ -306,7 +301,201 @@ func TestRouter_ValidToken(t *testing.T) {
 
 	assert.Contains(t, string(body), "\"message\":\"your username is: myemail@example.com; the id you requested is: 1\"")
 
+	txn := requireTransaction(t, app)
+	assert.Equal(t, "/protected/{id:[0-9]+}", txn.Name())
+	assert.Equal(t, "1", txn.Attributes()["id"])
+}
+
+func TestRouter_Tenants(t *testing.T) {
+	signingKey := []byte("my-key")
+
+	h := &handler.Handler{}
+	app := instrumentation.NewMemory()
+
+	rtr := router.NewRouter(h, zap.NewNop(), app, jwtauth.New("HS256", signingKey, nil), "my-version", testCORS,
+		router.WithTenants(middleware.TenantOptions{Domain: "example.com"}),
+	)
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":    "user-1",
+		"tenant": "acme",
+	})
+
+	tokenString, err := tok.SignedString(signingKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		host string
+		code int
+	}{
+		{name: "own tenant", host: "acme.example.com", code: 200},
+		{name: "from token", host: "example.com", code: 200},
+		{name: "other tenant", host: "globex.example.com", code: 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://"+tt.host+"/protected/1", nil)
+			r.Header.Set("Authorization", "Bearer "+tokenString)
+
+			rtr.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+
+	txns := app.Transactions()
+	require.Len(t, txns, 3)
+	assert.Equal(t, "acme", txns[0].Attributes()["tenant"])
+	assert.Equal(t, "acme", txns[1].Attributes()["tenant"])
+	assert.Equal(t, "globex", txns[2].Attributes()["tenant"])
+}
+
+func TestRouter_CORS(t *testing.T) {
+	h := &mockHandler{}
+	h.On("Health", mock.Anything, mock.Anything).Return()
+
+	def := middleware.DefaultCORSPolicy("http://example.com")
+	login := def
+	login.AllowedOrigins = []string{"https://*.example.com"}
+
+	rtr := router.NewRouter(h, zap.NewNop(), instrumentation.NewMemory(), nil, "my-version", middleware.NewCORSHandler(middleware.CORSOptions{
+		Default: def,
+		Routes:  map[string]middleware.CORSPolicy{"/auth": login},
+	}))
+
+	preflight := func(path, origin string) http.Header {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("OPTIONS", path, nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+
+		rtr.ServeHTTP(w, r)
+
+		return w.Header()
+	}
+
+	assert.Equal(t, "http://example.com", preflight("/health", "http://example.com").Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, preflight("/health", "https://app.example.com").Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "https://app.example.com", preflight("/auth/token", "https://app.example.com").Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, preflight("/auth/token", "http://example.com").Get("Access-Control-Allow-Origin"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/health", nil)
+	r.Header.Set("Origin", "http://example.com")
+
+	rtr.ServeHTTP(w, r)
+
+	assert.Equal(t, "http://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Trace-Id, X-Version", w.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestRouter_SecurityHeaders(t *testing.T) {
+	h := &mockHandler{}
+	h.On("Health", mock.Anything, mock.Anything).Return()
+	h.On("CSPReport", mock.Anything, mock.Anything).Return()
+
+	o := middleware.APISecurityHeaders()
+	o.CSPReportURI = router.CSPReportPath
+
+	rtr := router.NewRouter(h, zap.NewNop(), instrumentation.NewMemory(), nil, "my-version", testCORS,
+		router.WithSecurityHeaders(o),
+	)
+
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Contains(t, w.Header().Get("Content-Security-Policy"), "report-uri /csp-report")
+
+	w = httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest("POST", "/csp-report", nil))
+
+	assert.Equal(t, 204, w.Code)
+
+	h.AssertExpectations(t)
+}
+
+func TestRouter_Panic(t *testing.T) {
+	log := zap.NewExample()
+
+	h := &mockHandler{}
+	app := instrumentation.NewMemory()
+
+	h.On("Health", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		panic("oh no")
+	}).Return()
+
+	// make sure we call the InternalServerError func after the panic.
+	h.On("InternalServerError", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		w := args.Get(0).(http.ResponseWriter)
+		w.WriteHeader(500)
+	}).Return()
+
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS)
+
+	s := httptest.NewServer(rtr)
+	defer s.Close()
+
+	req, err := http.NewRequest("GET", s.URL+"/health", nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, 500, resp.StatusCode)
+
 	// All mocks used should assert that they met their expectations.
-	nr.AssertExpectations(t)
-	txn.AssertExpectations(t)
+	h.AssertExpectations(t)
+
+	txn := requireTransaction(t, app)
+	require.Len(t, txn.Errors(), 1)
+	assert.EqualError(t, txn.Errors()[0], "oh no")
+}
+
+func TestRouter_PanicAfterHeaders(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	h := &mockHandler{}
+	app := instrumentation.NewMemory()
+	reg := metrics.NewRegistry()
+
+	h.On("Health", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		w := args.Get(0).(http.ResponseWriter)
+		w.WriteHeader(200)
+		panic("oh no")
+	}).Return()
+
+	rtr := router.NewRouter(h, log, app, nil, "my-version", testCORS, router.WithMetrics(reg))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/health", nil)
+
+	// The response can not be fixed, so the connection is aborted.
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		rtr.ServeHTTP(w, r)
+	})
+
+	// The request is still recorded by every middleware.
+	txn := requireTransaction(t, app)
+	assert.Equal(t, "/health", txn.Name())
+	require.Len(t, txn.Errors(), 1)
+	assert.EqualError(t, txn.Errors()[0], "oh no")
+
+	assert.Contains(t, buf.String(), `"msg":"panic recovered"`)
+	assert.Contains(t, buf.String(), `"msg":"request complete"`)
+
+	mw := httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(mw, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Contains(t, mw.Body.String(), `http_server_requests_total{route="/health",method="GET",status="2xx"} 1`)
 }
@@ -0,0 +1,129 @@
+package router_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/chiapi/handler"
+	"github.com/rickbassham/example-go/chiapi/router"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+)
+
+func TestRouter_Sessions(t *testing.T) {
+	hash, err := auth.HashPassword("hunter2")
+	require.NoError(t, err)
+
+	sessions := auth.NewSessions(auth.NewMemorySessionStore(), auth.SessionOptions{})
+
+	rtr := router.NewRouter(&handler.Handler{}, zap.NewNop(), instrumentation.NewMemory(), jwtauth.New("HS256", []byte("my-key"), nil), "my-version", testCORS,
+		router.WithSessions(handler.NewSessions(sessions, testUsers{"rick": hash}, nil), sessions),
+	)
+
+	s := httptest.NewServer(rtr)
+	defer s.Close()
+
+	// The cookie is Secure, so it is sent by hand over http.
+	do := func(method, path, cookie, csrf, body string) *http.Response {
+		req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: cookie})
+		}
+
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := do("POST", "/auth/session", "", "", `{"username":"rick","password":"hunter2"}`)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var cookie *http.Cookie
+
+	for _, c := range resp.Cookies() {
+		if c.Name == auth.SessionCookieName {
+			cookie = c
+		}
+	}
+
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.Equal(t, "/", cookie.Path)
+
+	var current handler.SessionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&current))
+	resp.Body.Close()
+
+	assert.True(t, current.Current)
+	assert.NotEmpty(t, current.CSRFToken)
+
+	// A session and a token produce the same identity.
+	resp = do("GET", "/protected/1", cookie.Value, "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "your username is: rick;")
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "rick"}).SignedString([]byte("my-key"))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", s.URL+"/protected/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tok)
+
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Contains(t, readBody(t, resp), "your username is: rick;")
+
+	resp = do("GET", "/auth/sessions", cookie.Value, "", "")
+	require.Equal(t, 200, resp.StatusCode)
+
+	var list []handler.SessionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	require.Len(t, list, 1)
+	assert.Equal(t, current.ID, list[0].ID)
+
+	// Unsafe requests need the CSRF token.
+	resp = do("DELETE", "/auth/session", cookie.Value, "", "")
+	resp.Body.Close()
+	assert.Equal(t, 403, resp.StatusCode)
+
+	resp = do("DELETE", "/auth/session", cookie.Value, "wrong", "")
+	resp.Body.Close()
+	assert.Equal(t, 403, resp.StatusCode)
+
+	resp = do("DELETE", "/auth/session", cookie.Value, current.CSRFToken, "")
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp = do("GET", "/protected/1", cookie.Value, "", "")
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return string(b)
+}
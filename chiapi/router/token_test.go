@@ -0,0 +1,102 @@
+package router_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/chiapi/handler"
+	"github.com/rickbassham/example-go/chiapi/router"
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+)
+
+type testUsers map[string]string
+
+func (u testUsers) Credentials(ctx context.Context, username string) (string, string, error) {
+	hash, ok := u[username]
+	if !ok {
+		return "", "", auth.ErrUserNotFound
+	}
+
+	return username, hash, nil
+}
+
+func TestRouter_Tokens(t *testing.T) {
+	hash, err := auth.HashPassword("hunter2")
+	require.NoError(t, err)
+
+	revoked := auth.NewMemoryRevocationList()
+	issuer := auth.NewTokenIssuer(auth.TokenIssuerOptions{
+		Key:     []byte("my-key"),
+		Users:   testUsers{"rick": hash},
+		Refresh: auth.NewMemoryRefreshStore(),
+		Revoked: revoked,
+	})
+
+	rtr := router.NewRouter(&handler.Handler{}, zap.NewNop(), instrumentation.NewMemory(), jwtauth.New("HS256", []byte("my-key"), nil), "my-version", testCORS,
+		router.WithTokens(handler.NewTokens(issuer)),
+		router.WithRevocationList(revoked),
+	)
+
+	s := httptest.NewServer(rtr)
+	defer s.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	tokensFrom := func(resp *http.Response) auth.Tokens {
+		defer resp.Body.Close()
+
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+		var tokens auth.Tokens
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+
+		return tokens
+	}
+
+	resp := do("POST", "/auth/token", "", `{"username":"rick","password":"wrong"}`)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+
+	tokens := tokensFrom(do("POST", "/auth/token", "", `{"username":"rick","password":"hunter2"}`))
+
+	resp = do("GET", "/protected/1", tokens.AccessToken, "")
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+
+	tokens = tokensFrom(do("POST", "/auth/refresh", "", `{"refresh_token":"`+tokens.RefreshToken+`"}`))
+
+	resp = do("POST", "/auth/logout", tokens.AccessToken, `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	resp.Body.Close()
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp = do("GET", "/protected/1", tokens.AccessToken, "")
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+
+	resp = do("POST", "/auth/refresh", "", `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	resp.Body.Close()
+	assert.Equal(t, 401, resp.StatusCode)
+}
@@ -3,7 +3,6 @@ module github.com/rickbassham/example-go
 go 1.13
 
 require (
-	github.com/caarlos0/env v3.5.0+incompatible
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-chi/chi v4.0.2+incompatible
@@ -11,6 +10,7 @@ require (
 	github.com/go-chi/jwtauth v3.3.0+incompatible
 	github.com/go-redis/redis/v7 v7.0.0-beta.4
 	github.com/google/uuid v1.1.1
+	github.com/jmoiron/sqlx v1.2.0
 	github.com/newrelic/go-agent v2.11.0+incompatible
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/stretchr/objx v0.1.1 // indirect
@@ -20,4 +20,5 @@ require (
 	go.uber.org/zap v1.10.0
 	gogs.rickbassham.com/rick/database v1.0.1
 	google.golang.org/appengine v1.6.3 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,175 @@
+// Package audit records security relevant events, such as logins, denied requests and admin actions,
+// with who made them and where from, to sinks kept apart from the application logs.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// Types of events.
+const (
+	// TypeAuthentication is a request or login that was, or was not, authenticated.
+	TypeAuthentication = "authentication"
+	// TypeAuthorization is a request denied by a policy.
+	TypeAuthorization = "authorization"
+	// TypeAPIKeyUse is a request authenticated with an API key.
+	TypeAPIKeyUse = "api_key_use"
+	// TypeAdminAction is a change made from the admin listener, such as a log level change.
+	TypeAdminAction = "admin_action"
+)
+
+// Outcomes of events.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+	// OutcomeError is an event that could not be completed, such as an authentication whose
+	// credentials could not be checked because their store was down.
+	OutcomeError = "error"
+)
+
+// Event is a security relevant event. The fields describing the request, such as the Principal and
+// TraceID, are filled in from the context by Record when they are empty.
+type Event struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Type is what kind of event it is, such as TypeAuthentication.
+	Type string `json:"type"`
+	// Action is what was done, such as login or log_level.set.
+	Action string `json:"action,omitempty"`
+	// Outcome is OutcomeSuccess, OutcomeFailure, OutcomeDenied or OutcomeError.
+	Outcome string `json:"outcome"`
+	// Reason is why the event failed or was denied, such as the reason a token was rejected or the
+	// name of the policy that denied it.
+	Reason string `json:"reason,omitempty"`
+	// Principal is the identity.Principal.ID of who made the request, if known.
+	Principal  string `json:"principal,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	TraceID    string `json:"trace_id,omitempty"`
+	ClientIP   string `json:"client_ip,omitempty"`
+	// Resource is what the event acted on, such as the id of an API key.
+	Resource string            `json:"resource,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// Sink stores or forwards events, such as LogSink.
+type Sink interface {
+	WriteEvent(ctx context.Context, e Event) error
+}
+
+// Filter selects the events returned by a Store. Empty fields match every event.
+type Filter struct {
+	Principal string
+	Type      string
+	// From and To limit the events to those at or after From, and before To.
+	From time.Time
+	To   time.Time
+	// Limit is the most events to return.
+	Limit int
+}
+
+// Match returns true if the event is selected by the filter, ignoring the Limit.
+func (f Filter) Match(e Event) bool {
+	if f.Principal != "" && e.Principal != f.Principal {
+		return false
+	}
+
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// Store returns the recorded events, such as Memory or the audit_events table of testdb.
+type Store interface {
+	// Events returns the events selected by the filter, newest first.
+	Events(ctx context.Context, f Filter) ([]Event, error)
+}
+
+// Auditor records events to every one of its sinks.
+type Auditor struct {
+	sinks []Sink
+}
+
+// New creates a new Auditor that records to the sinks.
+func New(sinks ...Sink) *Auditor {
+	return &Auditor{sinks: sinks}
+}
+
+// Record fills in the id and time of the event, and who made the request on the context, and writes
+// it to every sink. A sink that fails is logged, and does not fail the request. A nil Auditor does
+// nothing.
+func (a *Auditor) Record(ctx context.Context, e Event) {
+	if a == nil {
+		return
+	}
+
+	e = fill(ctx, e)
+
+	for _, s := range a.sinks {
+		if err := s.WriteEvent(ctx, e); err != nil {
+			logging.FromContext(ctx).Error("error recording audit event",
+				zap.String("audit_type", e.Type),
+				zap.String("audit_id", e.ID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Record records the event with the Auditor on the context, if there is one; see NewContext.
+func Record(ctx context.Context, e Event) {
+	FromContext(ctx).Record(ctx, e)
+}
+
+func fill(ctx context.Context, e Event) Event {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	// The auth method is only taken from the context along with its principal, and never replaces
+	// the one of the event, such as the method of the credentials that were rejected.
+	if p, ok := identity.PrincipalFromContext(ctx); ok && e.Principal == "" {
+		e.Principal = p.ID()
+
+		if e.AuthMethod == "" {
+			e.AuthMethod = p.AuthMethod
+		}
+	}
+
+	if e.Tenant == "" {
+		e.Tenant, _ = identity.TenantFromContext(ctx)
+	}
+
+	if e.TraceID == "" {
+		e.TraceID = tracing.FromContext(ctx)
+	}
+
+	if e.ClientIP == "" {
+		e.ClientIP = ClientIPFromContext(ctx)
+	}
+
+	return e
+}
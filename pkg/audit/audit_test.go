@@ -0,0 +1,128 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+type failingSink struct{}
+
+func (failingSink) WriteEvent(ctx context.Context, e audit.Event) error {
+	return errors.New("disk full")
+}
+
+func newLogger() (*zap.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+
+	return zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	)), &buf
+}
+
+func TestRecord(t *testing.T) {
+	auditLog, auditBuf := newLogger()
+	log, buf := newLogger()
+
+	mem := audit.NewMemory(10)
+	a := audit.New(audit.LogSink{Log: auditLog}, mem, failingSink{})
+
+	ctx := logging.WithLogger(context.Background(), log)
+	ctx = audit.NewContext(ctx, a)
+	ctx = audit.WithClientIP(ctx, "10.0.0.1")
+	ctx = tracing.WithTraceID(ctx, "trace-1")
+	ctx = identity.WithTenant(ctx, "acme")
+	ctx = identity.WithPrincipal(ctx, identity.Principal{Subject: "user-1", AuthMethod: identity.AuthMethodJWT})
+
+	audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAuthorization,
+		Outcome: audit.OutcomeDenied,
+		Reason:  "roles:admin",
+	})
+
+	events, err := mem.Events(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	e := events[0]
+	assert.NotEmpty(t, e.ID)
+	assert.WithinDuration(t, time.Now(), e.Time, time.Minute)
+	assert.Equal(t, "user-1", e.Principal)
+	assert.Equal(t, identity.AuthMethodJWT, e.AuthMethod)
+	assert.Equal(t, "acme", e.Tenant)
+	assert.Equal(t, "trace-1", e.TraceID)
+	assert.Equal(t, "10.0.0.1", e.ClientIP)
+
+	assert.Contains(t, auditBuf.String(), `"msg":"audit event"`)
+	assert.Contains(t, auditBuf.String(), `"audit_type":"authorization","outcome":"denied","reason":"roles:admin","principal":"user-1"`)
+	assert.Contains(t, buf.String(), `"msg":"error recording audit event"`)
+
+	// Without an auditor on the context, nothing is recorded.
+	audit.Record(context.Background(), audit.Event{Type: audit.TypeAuthentication})
+}
+
+func TestRecord_AuthMethod(t *testing.T) {
+	mem := audit.NewMemory(10)
+
+	ctx := audit.NewContext(context.Background(), audit.New(mem))
+	ctx = identity.WithPrincipal(ctx, identity.Principal{Subject: "user-1", AuthMethod: identity.AuthMethodSession})
+
+	// A token rejected on a request that already has a session keeps the method of the token.
+	audit.Record(ctx, audit.Event{
+		Type:       audit.TypeAuthentication,
+		Outcome:    audit.OutcomeFailure,
+		AuthMethod: identity.AuthMethodJWT,
+	})
+
+	events, err := mem.Events(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	assert.Equal(t, "user-1", events[0].Principal)
+	assert.Equal(t, identity.AuthMethodJWT, events[0].AuthMethod)
+}
+
+func TestMemory_Events(t *testing.T) {
+	ctx := context.Background()
+	mem := audit.NewMemory(3)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, p := range []string{"a", "b", "a", "a"} {
+		require.NoError(t, mem.WriteEvent(ctx, audit.Event{
+			ID:        string(rune('0' + i)),
+			Time:      start.Add(time.Duration(i) * time.Hour),
+			Principal: p,
+		}))
+	}
+
+	// Only the 3 most recent events are kept, and the newest is first.
+	events, err := mem.Events(ctx, audit.Filter{Principal: "a"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "3", events[0].ID)
+	assert.Equal(t, "2", events[1].ID)
+
+	events, err = mem.Events(ctx, audit.Filter{From: start.Add(2 * time.Hour), To: start.Add(3 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "2", events[0].ID)
+
+	events, err = mem.Events(ctx, audit.Filter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "3", events[0].ID)
+}
@@ -0,0 +1,37 @@
+package audit
+
+import "context"
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return "context key: " + string(k)
+}
+
+var (
+	auditorKey  = contextKey("auditor")
+	clientIPKey = contextKey("client_ip")
+)
+
+// NewContext adds the auditor to the request context.
+func NewContext(ctx context.Context, a *Auditor) context.Context {
+	return context.WithValue(ctx, auditorKey, a)
+}
+
+// FromContext retrieves the auditor from the request context. If there is no auditor on the
+// context, it returns nil, which records nothing.
+func FromContext(ctx context.Context) *Auditor {
+	a, _ := ctx.Value(auditorKey).(*Auditor)
+	return a
+}
+
+// WithClientIP adds the ip address of the client to the request context.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIPFromContext retrieves the ip address of the client from the request context.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// LogSink writes each event as an "audit event" entry to the logger, such as one from
+// logging.NewAuditLogger, which writes to its own file and ignores the log level.
+type LogSink struct {
+	Log *zap.Logger
+}
+
+// WriteEvent logs the event.
+func (s LogSink) WriteEvent(ctx context.Context, e Event) error {
+	fields := []zap.Field{
+		zap.String("audit_id", e.ID),
+		zap.Time("audit_time", e.Time),
+		zap.String("audit_type", e.Type),
+		zap.String("outcome", e.Outcome),
+	}
+
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, zap.String(key, value))
+		}
+	}
+
+	add("action", e.Action)
+	add("reason", e.Reason)
+	add("principal", e.Principal)
+	add("auth_method", e.AuthMethod)
+	add("tenant", e.Tenant)
+	add("trace_id", e.TraceID)
+	add("client_ip", e.ClientIP)
+	add("resource", e.Resource)
+
+	if len(e.Details) > 0 {
+		fields = append(fields, zap.Any("details", e.Details))
+	}
+
+	s.Log.Info("audit event", fields...)
+
+	return nil
+}
+
+// Memory keeps the most recent events in memory, for the admin listener to query when there is no
+// database, and for tests. It is a Sink and a Store.
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+}
+
+// NewMemory creates a Memory that keeps the size most recent events.
+func NewMemory(size int) *Memory {
+	return &Memory{size: size}
+}
+
+// WriteEvent keeps the event, dropping the oldest one if there are too many.
+func (m *Memory) WriteEvent(ctx context.Context, e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, e)
+	if len(m.events) > m.size {
+		m.events = m.events[len(m.events)-m.size:]
+	}
+
+	return nil
+}
+
+// Events returns the events selected by the filter, newest first.
+func (m *Memory) Events(ctx context.Context, f Filter) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []Event
+
+	for _, e := range m.events {
+		if f.Match(e) {
+			events = append(events, e)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+
+	if f.Limit > 0 && len(events) > f.Limit {
+		events = events[:f.Limit]
+	}
+
+	return events, nil
+}
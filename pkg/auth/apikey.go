@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// APIKeyHeader is the request header API keys are sent in; see httputil.APIKeyTransport.
+const APIKeyHeader = "X-Api-Key"
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize, such as by secret
+// scanners.
+const APIKeyPrefix = "ak"
+
+// ReasonRevoked is the reason an API key that was revoked is rejected.
+const ReasonRevoked = "revoked"
+
+var (
+	// ErrAPIKeyNotFound is returned by an APIKeyStore when there is no key with the id.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrAPIKeyRevoked is returned when rotating a key that was revoked.
+	ErrAPIKeyRevoked = errors.New("api key is revoked")
+)
+
+// APIKey is an API key, as stored. Only the hash of its secret is kept; the key itself is only shown
+// when it is issued.
+type APIKey struct {
+	// ID is the public part of the key, used to look it up.
+	ID string `json:"id"`
+	// Name describes what the key is used for.
+	Name string `json:"name"`
+	// Owner is the identity.Principal.ID of the principal the key acts as.
+	Owner string `json:"owner"`
+	// Scopes are the scopes granted to requests made with the key.
+	Scopes []string `json:"scopes,omitempty"`
+	// Tenant is the tenant the key acts in, if any.
+	Tenant string `json:"tenant,omitempty"`
+	// Hash is the hex encoded SHA-256 hash of the secret part of the key.
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	// CreatedBy is who issued the key.
+	CreatedBy string `json:"created_by,omitempty"`
+	// ExpiresAt is when the key stops working. If zero, it does not expire.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// LastUsedAt is roughly when the key was last used; see APIKeys.TouchInterval.
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty"`
+	// RevokedBy is who revoked the key.
+	RevokedBy string `json:"revoked_by,omitempty"`
+	// ReplacedBy is the id of the key that replaced this one when it was rotated.
+	ReplacedBy string `json:"replaced_by,omitempty"`
+}
+
+// OwnerID returns the owner of the key, so it can be checked with OwnerOrRoles.
+func (k APIKey) OwnerID() string {
+	return k.Owner
+}
+
+// Revoked returns true if the key has been revoked.
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// Expired returns true if the key has expired at the given time.
+func (k APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// APIKeyStore stores API keys, such as in redis; see cache.NewAPIKeyStore.
+type APIKeyStore interface {
+	// Create stores a new key.
+	Create(ctx context.Context, k APIKey) error
+	// Get returns the key with the id, or ErrAPIKeyNotFound.
+	Get(ctx context.Context, id string) (APIKey, error)
+	// List returns every key, including revoked and expired ones.
+	List(ctx context.Context) ([]APIKey, error)
+	// Update replaces a stored key.
+	Update(ctx context.Context, k APIKey) error
+	// Touch records that the key with the id was used at the time.
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+// APIKeys issues, authenticates and revokes API keys kept in a store.
+type APIKeys struct {
+	store APIKeyStore
+
+	// TouchInterval is how often the last use of a key is written to the store, so a busy key does
+	// not write on every request. By default, it is one minute.
+	TouchInterval time.Duration
+}
+
+// NewAPIKeys creates a new APIKeys using the store.
+func NewAPIKeys(store APIKeyStore) *APIKeys {
+	return &APIKeys{
+		store:         store,
+		TouchInterval: time.Minute,
+	}
+}
+
+// APIKeyRequest describes a key to issue.
+type APIKeyRequest struct {
+	Name   string
+	Owner  string
+	Scopes []string
+	Tenant string
+	// TTL is how long the key is valid for. If zero, it does not expire.
+	TTL time.Duration
+}
+
+// Issue creates a new key, issued by the principal on the context. The returned key, which includes
+// its secret, is not stored and cannot be shown again.
+func (a *APIKeys) Issue(ctx context.Context, req APIKeyRequest) (APIKey, string, error) {
+	if req.Owner == "" {
+		return APIKey{}, "", errors.New("api key owner is required")
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	now := time.Now().UTC()
+
+	k := APIKey{
+		ID:        id,
+		Name:      req.Name,
+		Owner:     req.Owner,
+		Scopes:    req.Scopes,
+		Tenant:    req.Tenant,
+		Hash:      hashSecret(secret),
+		CreatedAt: now,
+		CreatedBy: identity.FromContext(ctx),
+	}
+
+	if req.TTL > 0 {
+		k.ExpiresAt = now.Add(req.TTL)
+	}
+
+	if err := a.store.Create(ctx, k); err != nil {
+		return APIKey{}, "", err
+	}
+
+	logging.FromContext(ctx).Info("api key issued",
+		zap.String("api_key_id", k.ID),
+		zap.String("owner", k.Owner),
+		zap.String("by", k.CreatedBy),
+	)
+
+	return k, APIKeyPrefix + "_" + id + "_" + secret, nil
+}
+
+// Authenticate returns the principal for the raw key, acting as its owner with its scopes, in its
+// tenant. It returns an *Error if the key is unknown, wrong, expired or revoked.
+func (a *APIKeys) Authenticate(ctx context.Context, raw string) (identity.Principal, error) {
+	id, secret, ok := parseAPIKey(raw)
+	if !ok {
+		return identity.Principal{}, reject(ReasonInvalidToken, "api key is invalid")
+	}
+
+	k, err := a.store.Get(ctx, id)
+	if err == ErrAPIKeyNotFound {
+		return identity.Principal{}, reject(ReasonInvalidToken, "api key is invalid")
+	} else if err != nil {
+		return identity.Principal{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) != 1 {
+		return identity.Principal{}, reject(ReasonInvalidToken, "api key is invalid")
+	}
+
+	now := time.Now()
+
+	if k.Revoked() {
+		return identity.Principal{}, reject(ReasonRevoked, "api key is revoked")
+	}
+
+	if k.Expired(now) {
+		return identity.Principal{}, reject(ReasonExpired, "api key is expired")
+	}
+
+	if now.Sub(k.LastUsedAt) >= a.TouchInterval {
+		// Failing to record the last use should not fail the request.
+		if err := a.store.Touch(ctx, k.ID, now.UTC()); err != nil {
+			logging.FromContext(ctx).Warn("error recording api key use", zap.String("api_key_id", k.ID), zap.Error(err))
+		}
+	}
+
+	return identity.Principal{
+		Subject:    k.Owner,
+		Scopes:     k.Scopes,
+		Tenant:     k.Tenant,
+		AuthMethod: identity.AuthMethodAPIKey,
+		TokenID:    k.ID,
+	}, nil
+}
+
+// List returns every key, newest first.
+func (a *APIKeys) List(ctx context.Context) ([]APIKey, error) {
+	keys, err := a.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// Revoke revokes the key with the id, on behalf of the principal on the context. It returns
+// ErrAPIKeyNotFound if there is no such key. Revoking a revoked key does nothing.
+func (a *APIKeys) Revoke(ctx context.Context, id string) (APIKey, error) {
+	return a.revoke(ctx, id, "")
+}
+
+func (a *APIKeys) revoke(ctx context.Context, id, replacedBy string) (APIKey, error) {
+	k, err := a.store.Get(ctx, id)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if k.Revoked() {
+		return k, nil
+	}
+
+	k.RevokedAt = time.Now().UTC()
+	k.RevokedBy = identity.FromContext(ctx)
+	k.ReplacedBy = replacedBy
+
+	if err := a.store.Update(ctx, k); err != nil {
+		return APIKey{}, err
+	}
+
+	logging.FromContext(ctx).Info("api key revoked",
+		zap.String("api_key_id", k.ID),
+		zap.String("owner", k.Owner),
+		zap.String("by", k.RevokedBy),
+	)
+
+	return k, nil
+}
+
+// Rotate issues a new key with the same name, owner, scopes, tenant and lifetime as the key with the id,
+// and revokes the old one. It returns ErrAPIKeyNotFound if there is no such key, and
+// ErrAPIKeyRevoked if it was revoked.
+func (a *APIKeys) Rotate(ctx context.Context, id string) (APIKey, string, error) {
+	old, err := a.store.Get(ctx, id)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	if old.Revoked() {
+		return APIKey{}, "", ErrAPIKeyRevoked
+	}
+
+	var ttl time.Duration
+	if !old.ExpiresAt.IsZero() {
+		ttl = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+
+	k, raw, err := a.Issue(ctx, APIKeyRequest{
+		Name:   old.Name,
+		Owner:  old.Owner,
+		Scopes: old.Scopes,
+		Tenant: old.Tenant,
+		TTL:    ttl,
+	})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	if _, err := a.revoke(ctx, old.ID, k.ID); err != nil {
+		return APIKey{}, "", err
+	}
+
+	return k, raw, nil
+}
+
+// parseAPIKey splits a key such as ak_<id>_<secret> into its id and secret.
+func parseAPIKey(raw string) (string, string, bool) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != APIKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+
+	return parts[1], parts[2], true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// MemoryAPIKeyStore is an APIKeyStore kept in memory, for tests and local runs. Keys are lost when the
+// process exits.
+type MemoryAPIKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]APIKey
+}
+
+// NewMemoryAPIKeyStore creates an empty MemoryAPIKeyStore.
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: map[string]APIKey{}}
+}
+
+// Create stores a new key.
+func (s *MemoryAPIKeyStore) Create(ctx context.Context, k APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[k.ID]; ok {
+		return errors.New("api key already exists")
+	}
+
+	s.keys[k.ID] = k
+
+	return nil
+}
+
+// Get returns the key with the id, or ErrAPIKeyNotFound.
+func (s *MemoryAPIKeyStore) Get(ctx context.Context, id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+
+	return k, nil
+}
+
+// List returns every key.
+func (s *MemoryAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// Update replaces a stored key.
+func (s *MemoryAPIKeyStore) Update(ctx context.Context, k APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[k.ID]; !ok {
+		return ErrAPIKeyNotFound
+	}
+
+	s.keys[k.ID] = k
+
+	return nil
+}
+
+// Touch records that the key with the id was used at the time.
+func (s *MemoryAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+
+	k.LastUsedAt = at
+	s.keys[id] = k
+
+	return nil
+}
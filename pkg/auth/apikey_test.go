@@ -0,0 +1,103 @@
+package auth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestAPIKeys(t *testing.T) {
+	store := auth.NewMemoryAPIKeyStore()
+	keys := auth.NewAPIKeys(store)
+	ctx := identity.WithUser(context.Background(), "admin")
+
+	k, raw, err := keys.Issue(ctx, auth.APIKeyRequest{Name: "ci", Owner: "svc-ci", Scopes: []string{"read"}, Tenant: "acme"})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(raw, "ak_"+k.ID+"_"))
+	assert.NotContains(t, raw, k.Hash)
+	assert.Equal(t, "admin", k.CreatedBy)
+	assert.True(t, k.ExpiresAt.IsZero())
+
+	p, err := keys.Authenticate(context.Background(), raw)
+	require.NoError(t, err)
+
+	assert.Equal(t, identity.Principal{
+		Subject:    "svc-ci",
+		Scopes:     []string{"read"},
+		Tenant:     "acme",
+		AuthMethod: identity.AuthMethodAPIKey,
+		TokenID:    k.ID,
+	}, p)
+
+	stored, err := store.Get(context.Background(), k.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.LastUsedAt.IsZero())
+
+	for _, bad := range []string{"", "nope", "ak_" + k.ID + "_wrong", "ak_unknown_secret", strings.Replace(raw, "ak_", "xx_", 1)} {
+		_, err = keys.Authenticate(context.Background(), bad)
+		assert.Equal(t, &auth.Error{Reason: auth.ReasonInvalidToken, Description: "api key is invalid"}, err, bad)
+	}
+
+	rotated, newRaw, err := keys.Rotate(ctx, k.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", rotated.Tenant)
+
+	_, err = keys.Authenticate(context.Background(), raw)
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonRevoked, Description: "api key is revoked"}, err)
+
+	_, err = keys.Authenticate(context.Background(), newRaw)
+	assert.NoError(t, err)
+
+	_, _, err = keys.Rotate(ctx, k.ID)
+	assert.Equal(t, auth.ErrAPIKeyRevoked, err)
+
+	list, err := keys.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, rotated.ID, list[0].ReplacedBy+list[1].ReplacedBy)
+
+	_, err = keys.Revoke(ctx, "unknown")
+	assert.Equal(t, auth.ErrAPIKeyNotFound, err)
+}
+
+func TestAPIKeys_Expired(t *testing.T) {
+	keys := auth.NewAPIKeys(auth.NewMemoryAPIKeyStore())
+
+	_, raw, err := keys.Issue(context.Background(), auth.APIKeyRequest{Owner: "svc-ci", TTL: time.Millisecond})
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = keys.Authenticate(context.Background(), raw)
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonExpired, Description: "api key is expired"}, err)
+}
+
+func TestAPIKeys_TouchInterval(t *testing.T) {
+	store := auth.NewMemoryAPIKeyStore()
+	keys := auth.NewAPIKeys(store)
+
+	k, raw, err := keys.Issue(context.Background(), auth.APIKeyRequest{Owner: "svc-ci"})
+	require.NoError(t, err)
+
+	_, err = keys.Authenticate(context.Background(), raw)
+	require.NoError(t, err)
+
+	first, err := store.Get(context.Background(), k.ID)
+	require.NoError(t, err)
+
+	// Uses within the interval are not written again.
+	_, err = keys.Authenticate(context.Background(), raw)
+	require.NoError(t, err)
+
+	second, err := store.Get(context.Background(), k.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first.LastUsedAt, second.LastUsedAt)
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reasons a token is rejected, for logs.
+const (
+	ReasonMissingToken  = "missing_token"
+	ReasonInvalidToken  = "invalid_token"
+	ReasonExpired       = "expired"
+	ReasonIssuer        = "issuer"
+	ReasonAudience      = "audience"
+	ReasonNotYetValid   = "not_yet_valid"
+	ReasonTooOld        = "too_old"
+	ReasonMissingClaim  = "missing_claim"
+	ReasonInvalidClaims = "invalid_claims"
+)
+
+// Error is the reason a token was rejected. The Description can be shown to the caller, such as in
+// the error_description of a WWW-Authenticate header.
+type Error struct {
+	Reason      string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Description
+}
+
+func reject(reason, format string, args ...interface{}) *Error {
+	return &Error{Reason: reason, Description: fmt.Sprintf(format, args...)}
+}
+
+// ClaimsPolicy decides which verified tokens are accepted, based on their claims. The zero value
+// accepts every token.
+type ClaimsPolicy struct {
+	// Issuers are the accepted iss values. If empty, any issuer is accepted.
+	Issuers []string
+	// Audiences are the accepted aud values; the token must include at least one of them. If empty,
+	// any audience is accepted.
+	Audiences []string
+	// Leeway allows for clock skew between us and the issuer when checking nbf and iat.
+	Leeway time.Duration
+	// MaxAge is how long after it was issued a token is accepted, based on its iat, which is then
+	// required. If zero, tokens are accepted until they expire.
+	MaxAge time.Duration
+	// Required are the claims that must be present and not empty, such as email.
+	Required []string
+}
+
+// Validate checks the claims against the policy at the given time. It returns an *Error if they are
+// rejected.
+func (p ClaimsPolicy) Validate(claims map[string]interface{}, now time.Time) error {
+	if len(p.Issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+		if !contains(p.Issuers, iss) {
+			return reject(ReasonIssuer, "issuer %q is not accepted", iss)
+		}
+	}
+
+	if len(p.Audiences) > 0 {
+		aud, ok := audiences(claims["aud"])
+		if !ok {
+			return reject(ReasonInvalidClaims, "aud must be a string or an array of strings")
+		}
+
+		found := false
+
+		for _, a := range aud {
+			if contains(p.Audiences, a) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return reject(ReasonAudience, "audience must include one of %q", strings.Join(p.Audiences, " "))
+		}
+	}
+
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(p.Leeway).Before(nbf) {
+		return reject(ReasonNotYetValid, "token is not valid yet")
+	}
+
+	iat, ok, err := numericDate(claims, "iat")
+	if err != nil {
+		return err
+	}
+
+	if ok && now.Add(p.Leeway).Before(iat) {
+		return reject(ReasonInvalidClaims, "token was issued in the future")
+	}
+
+	if p.MaxAge > 0 {
+		if !ok {
+			return reject(ReasonMissingClaim, "missing required claim %q", "iat")
+		}
+
+		if now.Sub(iat) > p.MaxAge+p.Leeway {
+			return reject(ReasonTooOld, "token is too old")
+		}
+	}
+
+	for _, name := range p.Required {
+		if v, ok := claims[name]; !ok || v == nil || v == "" {
+			return reject(ReasonMissingClaim, "missing required claim %q", name)
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// audiences returns the aud claim, which can be a string or an array of strings.
+func audiences(v interface{}) ([]string, bool) {
+	switch aud := v.(type) {
+	case nil:
+		return nil, true
+	case string:
+		return []string{aud}, true
+	case []string:
+		return aud, true
+	case []interface{}:
+		out := make([]string, 0, len(aud))
+
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, false
+			}
+
+			out = append(out, s)
+		}
+
+		return out, true
+	}
+
+	return nil, false
+}
+
+// numericDate returns the time in the claim, and whether it is present.
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	var secs float64
+
+	switch v := claims[name].(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case float64:
+		secs = v
+	case int64:
+		secs = float64(v)
+	case int:
+		secs = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false, reject(ReasonInvalidClaims, "%s must be a number", name)
+		}
+
+		secs = f
+	default:
+		return time.Time{}, false, reject(ReasonInvalidClaims, "%s must be a number", name)
+	}
+
+	return time.Unix(int64(secs), 0), true, nil
+}
@@ -0,0 +1,82 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func TestClaimsPolicy(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	p := auth.ClaimsPolicy{
+		Issuers:   []string{"https://issuer.example.com"},
+		Audiences: []string{"api", "api-v2"},
+		Leeway:    time.Minute,
+		MaxAge:    time.Hour,
+		Required:  []string{"email"},
+	}
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://issuer.example.com",
+			"aud":   []interface{}{"other", "api"},
+			"iat":   float64(now.Add(-time.Minute).Unix()),
+			"nbf":   json.Number("1600000030"),
+			"email": "rick@example.com",
+		}
+	}
+
+	assert.NoError(t, p.Validate(valid(), now))
+
+	for _, tc := range []struct {
+		name   string
+		change func(c map[string]interface{})
+		reason string
+		desc   string
+	}{
+		{"issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+			auth.ReasonIssuer, `issuer "https://evil.example.com" is not accepted`},
+		{"no issuer", func(c map[string]interface{}) { delete(c, "iss") },
+			auth.ReasonIssuer, `issuer "" is not accepted`},
+		{"audience", func(c map[string]interface{}) { c["aud"] = "other" },
+			auth.ReasonAudience, `audience must include one of "api api-v2"`},
+		{"bad audience", func(c map[string]interface{}) { c["aud"] = 7.0 },
+			auth.ReasonInvalidClaims, "aud must be a string or an array of strings"},
+		{"not before", func(c map[string]interface{}) { c["nbf"] = float64(now.Add(2 * time.Minute).Unix()) },
+			auth.ReasonNotYetValid, "token is not valid yet"},
+		{"issued in the future", func(c map[string]interface{}) { c["iat"] = float64(now.Add(2 * time.Minute).Unix()) },
+			auth.ReasonInvalidClaims, "token was issued in the future"},
+		{"too old", func(c map[string]interface{}) { c["iat"] = float64(now.Add(-62 * time.Minute).Unix()) },
+			auth.ReasonTooOld, "token is too old"},
+		{"no iat", func(c map[string]interface{}) { delete(c, "iat") },
+			auth.ReasonMissingClaim, `missing required claim "iat"`},
+		{"bad nbf", func(c map[string]interface{}) { c["nbf"] = "soon" },
+			auth.ReasonInvalidClaims, "nbf must be a number"},
+		{"required", func(c map[string]interface{}) { c["email"] = "" },
+			auth.ReasonMissingClaim, `missing required claim "email"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid()
+			tc.change(c)
+
+			err := p.Validate(c, now)
+			if assert.IsType(t, &auth.Error{}, err) {
+				assert.Equal(t, tc.reason, err.(*auth.Error).Reason)
+				assert.Equal(t, tc.desc, err.Error())
+			}
+		})
+	}
+
+	// Within the leeway.
+	c := valid()
+	c["nbf"] = float64(now.Add(30 * time.Second).Unix())
+	c["iat"] = float64(now.Add(-60*time.Minute - 30*time.Second).Unix())
+	assert.NoError(t, p.Validate(c, now))
+
+	assert.NoError(t, auth.ClaimsPolicy{}.Validate(map[string]interface{}{}, now))
+}
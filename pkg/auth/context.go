@@ -0,0 +1,37 @@
+package auth
+
+import "context"
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return "auth context key: " + string(k)
+}
+
+var (
+	forbiddenKey = contextKey("forbidden")
+	sessionKey   = contextKey("session")
+)
+
+// WithForbidden adds the reason a request was denied to the request context, for the handler that
+// renders the 403 response.
+func WithForbidden(ctx context.Context, err *Forbidden) context.Context {
+	return context.WithValue(ctx, forbiddenKey, err)
+}
+
+// ForbiddenFromContext retrieves the reason the request was denied, if it was.
+func ForbiddenFromContext(ctx context.Context) (*Forbidden, bool) {
+	err, ok := ctx.Value(forbiddenKey).(*Forbidden)
+	return err, ok
+}
+
+// WithSession adds the session the request was authenticated with to the request context.
+func WithSession(ctx context.Context, s Session) context.Context {
+	return context.WithValue(ctx, sessionKey, s)
+}
+
+// SessionFromContext retrieves the session the request was authenticated with, if it was.
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	s, ok := ctx.Value(sessionKey).(Session)
+	return s, ok
+}
@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+var (
+	// ErrUserNotFound is returned by a CredentialStore when there is no user with the username.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrRefreshTokenNotFound is returned by a RefreshStore when there is no refresh token with the
+	// id, such as after it expired.
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrInvalidCredentials is returned by CheckCredentials when the username or password is wrong.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// CredentialStore looks up the password hash of a user, such as in the users table of testdb.
+type CredentialStore interface {
+	// Credentials returns the subject the user is issued tokens for, and their password hash made by
+	// HashPassword. It returns ErrUserNotFound if there is no such user.
+	Credentials(ctx context.Context, username string) (subject, passwordHash string, err error)
+}
+
+// RefreshToken is a refresh token, as stored. Only the hash of the token is kept, as its ID. Every
+// token issued by refreshing a token is in the same Family, so a stolen token that is reused can
+// revoke all of them.
+type RefreshToken struct {
+	ID        string    `json:"id"`
+	Family    string    `json:"family"`
+	Subject   string    `json:"subject"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Used is true if the token was already exchanged for new tokens.
+	Used bool `json:"-"`
+}
+
+// RefreshStore stores refresh tokens until they expire, such as in redis; see cache.NewTokenStore.
+type RefreshStore interface {
+	// Save stores a new refresh token.
+	Save(ctx context.Context, t RefreshToken) error
+	// Use marks the refresh token with the id as used, and returns it as it was before, so Used is
+	// true if it had already been used. It returns ErrRefreshTokenNotFound if there is no such token.
+	Use(ctx context.Context, id string) (RefreshToken, error)
+	// RevokeFamily removes every refresh token in the family.
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+// RevocationList records access tokens that were revoked before they expire, by their jti claim.
+type RevocationList interface {
+	// Revoke revokes the token with the jti until the time it expires. Tokens that have already
+	// expired are not recorded.
+	Revoke(ctx context.Context, jti string, until time.Time) error
+	// IsRevoked returns true if the token with the jti has been revoked.
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// TokenIssuerOptions configures a TokenIssuer.
+type TokenIssuerOptions struct {
+	// Method signs the access tokens. By default, it is HS256.
+	Method jwt.SigningMethod
+	// Key signs the access tokens, such as the HMAC secret or a private key for Method.
+	Key interface{}
+	// KeyID is set as the kid header of the access tokens, if not empty.
+	KeyID string
+	// Issuer and Audience are set as the iss and aud claims of the access tokens, if not empty.
+	Issuer   string
+	Audience []string
+	// Scopes are granted to every access token, in the scope claim.
+	Scopes []string
+	// AccessTTL is how long access tokens are valid for. By default, it is 15 minutes.
+	AccessTTL time.Duration
+	// RefreshTTL is how long refresh tokens are valid for. By default, it is 30 days.
+	RefreshTTL time.Duration
+	// Users are the credentials checked by Login.
+	Users CredentialStore
+	// Refresh stores the refresh tokens.
+	Refresh RefreshStore
+	// Revoked records the access tokens revoked by Logout.
+	Revoked RevocationList
+}
+
+// Tokens are the tokens issued by a TokenIssuer, in the form of an OAuth 2.0 token response.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenIssuer issues access tokens for users who log in with their password, and rotating refresh
+// tokens to renew them.
+type TokenIssuer struct {
+	o   TokenIssuerOptions
+	key atomic.Value
+}
+
+// signingKey holds the key in an atomic.Value, which needs the same concrete type on every Store.
+type signingKey struct {
+	key interface{}
+}
+
+// NewTokenIssuer creates a new TokenIssuer.
+func NewTokenIssuer(o TokenIssuerOptions) *TokenIssuer {
+	if o.Method == nil {
+		o.Method = jwt.SigningMethodHS256
+	}
+
+	if o.AccessTTL <= 0 {
+		o.AccessTTL = 15 * time.Minute
+	}
+
+	if o.RefreshTTL <= 0 {
+		o.RefreshTTL = 30 * 24 * time.Hour
+	}
+
+	i := &TokenIssuer{o: o}
+	i.SetKey(o.Key)
+
+	return i
+}
+
+// SetKey signs every later access token with the key, instead of TokenIssuerOptions.Key, such as
+// when the secret is reloaded. It is safe for concurrent use.
+func (i *TokenIssuer) SetKey(key interface{}) {
+	i.key.Store(signingKey{key: key})
+}
+
+// Login checks the password of the user, and issues new tokens for them, for the tenant on the
+// context, if any. It returns ErrInvalidCredentials if the user does not exist or the password is
+// wrong; see CheckCredentials.
+func (i *TokenIssuer) Login(ctx context.Context, username, password string) (Tokens, error) {
+	subject, err := CheckCredentials(ctx, i.o.Users, username, password)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	tenant, _ := identity.TenantFromContext(ctx)
+
+	return i.issue(ctx, RefreshToken{
+		Family:  uuid.New().String(),
+		Subject: subject,
+		Scopes:  i.o.Scopes,
+		Tenant:  tenant,
+	})
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// CheckCredentials checks the password of the user, and returns the subject they are known as. It
+// returns ErrInvalidCredentials if the user does not exist or the password is wrong, taking as long
+// in both cases so the usernames cannot be guessed from the timing. Every attempt is recorded as an
+// audit event.
+func CheckCredentials(ctx context.Context, users CredentialStore, username, password string) (string, error) {
+	subject, hash, err := users.Credentials(ctx, username)
+	if err == ErrUserNotFound {
+		dummyOnce.Do(func() {
+			dummyHash, _ = HashPassword("")
+		})
+
+		CheckPassword(dummyHash, password) // nolint
+		logging.FromContext(ctx).Info("login failed", zap.String("reason", "unknown user"))
+		recordLogin(ctx, "", username, "unknown_user")
+
+		return "", ErrInvalidCredentials
+	} else if err != nil {
+		return "", err
+	}
+
+	ok, err := CheckPassword(hash, password)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		logging.FromContext(ctx).Info("login failed", zap.String("reason", "wrong password"), zap.String("principal", subject))
+		recordLogin(ctx, subject, username, "wrong_password")
+
+		return "", ErrInvalidCredentials
+	}
+
+	recordLogin(ctx, subject, username, "")
+
+	return subject, nil
+}
+
+// recordLogin records a login with a password as an audit event, which failed if there is a reason.
+func recordLogin(ctx context.Context, subject, username, reason string) {
+	e := audit.Event{
+		Type:       audit.TypeAuthentication,
+		Action:     "login",
+		Outcome:    audit.OutcomeSuccess,
+		Principal:  subject,
+		AuthMethod: "password",
+		Details:    map[string]string{"username": username},
+	}
+
+	if reason != "" {
+		e.Outcome = audit.OutcomeFailure
+		e.Reason = reason
+	}
+
+	audit.Record(ctx, e)
+}
+
+// Refresh exchanges the refresh token for new tokens. The refresh token can only be used once; if it
+// is used again, it may have been stolen, so every refresh token issued from the same login is
+// revoked. A refresh token issued for one tenant is rejected for another. It returns an *Error if
+// the refresh token is rejected.
+func (i *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	t, err := i.o.Refresh.Use(ctx, hashSecret(refreshToken))
+	if err == ErrRefreshTokenNotFound {
+		return Tokens{}, reject(ReasonInvalidToken, "refresh token is invalid")
+	} else if err != nil {
+		return Tokens{}, err
+	}
+
+	if t.Used {
+		logging.FromContext(ctx).Warn("refresh token reused; revoking its family",
+			zap.String("principal", t.Subject),
+			zap.String("family", t.Family),
+		)
+
+		if err := i.o.Refresh.RevokeFamily(ctx, t.Family); err != nil {
+			return Tokens{}, err
+		}
+
+		return Tokens{}, reject(ReasonRevoked, "refresh token is revoked")
+	}
+
+	if !time.Now().Before(t.ExpiresAt) {
+		return Tokens{}, reject(ReasonExpired, "refresh token is expired")
+	}
+
+	if tenant, ok := identity.TenantFromContext(ctx); ok && tenant != t.Tenant {
+		return Tokens{}, reject(ReasonInvalidToken, "refresh token is invalid")
+	}
+
+	return i.issue(ctx, RefreshToken{
+		Family:  t.Family,
+		Subject: t.Subject,
+		Scopes:  t.Scopes,
+		Tenant:  t.Tenant,
+	})
+}
+
+// Logout revokes the access token with the jti until it expires, and every refresh token issued
+// from the same login as the refresh token, if it is not empty.
+func (i *TokenIssuer) Logout(ctx context.Context, jti string, expires time.Time, refreshToken string) error {
+	if jti != "" && i.o.Revoked != nil {
+		if err := i.o.Revoked.Revoke(ctx, jti, expires); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	t, err := i.o.Refresh.Use(ctx, hashSecret(refreshToken))
+	if err == ErrRefreshTokenNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return i.o.Refresh.RevokeFamily(ctx, t.Family)
+}
+
+// issue creates an access token for the subject and tenant of the refresh token, and saves the
+// refresh token.
+func (i *TokenIssuer) issue(ctx context.Context, rt RefreshToken) (Tokens, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"sub": rt.Subject,
+		"iat": now.Unix(),
+		"exp": now.Add(i.o.AccessTTL).Unix(),
+		"jti": uuid.New().String(),
+	}
+
+	if i.o.Issuer != "" {
+		claims["iss"] = i.o.Issuer
+	}
+
+	switch len(i.o.Audience) {
+	case 0:
+	case 1:
+		claims["aud"] = i.o.Audience[0]
+	default:
+		claims["aud"] = i.o.Audience
+	}
+
+	if len(rt.Scopes) > 0 {
+		claims["scope"] = strings.Join(rt.Scopes, " ")
+	}
+
+	if rt.Tenant != "" {
+		claims["tenant"] = rt.Tenant
+	}
+
+	token := jwt.NewWithClaims(i.o.Method, claims)
+	if i.o.KeyID != "" {
+		token.Header["kid"] = i.o.KeyID
+	}
+
+	access, err := token.SignedString(i.key.Load().(signingKey).key)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	rt.ID = hashSecret(secret)
+	rt.ExpiresAt = now.Add(i.o.RefreshTTL).UTC()
+
+	if err := i.o.Refresh.Save(ctx, rt); err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(i.o.AccessTTL / time.Second),
+		RefreshToken: secret,
+	}, nil
+}
+
+// MemoryRefreshStore is a RefreshStore kept in memory, for tests and local runs. Expired tokens are
+// not removed.
+type MemoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+// NewMemoryRefreshStore creates an empty MemoryRefreshStore.
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{tokens: map[string]RefreshToken{}}
+}
+
+// Save stores a new refresh token.
+func (s *MemoryRefreshStore) Save(ctx context.Context, t RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[t.ID] = t
+
+	return nil
+}
+
+// Use marks the refresh token with the id as used, and returns it as it was before.
+func (s *MemoryRefreshStore) Use(ctx context.Context, id string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+
+	used := t
+	used.Used = true
+	s.tokens[id] = used
+
+	return t, nil
+}
+
+// RevokeFamily removes every refresh token in the family.
+func (s *MemoryRefreshStore) RevokeFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if t.Family == family {
+			delete(s.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+// MemoryRevocationList is a RevocationList kept in memory, for tests and local runs.
+type MemoryRevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryRevocationList creates an empty MemoryRevocationList.
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{revoked: map[string]time.Time{}}
+}
+
+// Revoke revokes the token with the jti until the time it expires.
+func (l *MemoryRevocationList) Revoke(ctx context.Context, jti string, until time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.revoked[jti] = until
+
+	return nil
+}
+
+// IsRevoked returns true if the token with the jti has been revoked, and has not expired yet.
+func (l *MemoryRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until, ok := l.revoked[jti]
+	if ok && !time.Now().Before(until) {
+		delete(l.revoked, jti)
+		ok = false
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,163 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+// users is a CredentialStore of usernames to password hashes.
+type users map[string]string
+
+func (u users) Credentials(ctx context.Context, username string) (string, string, error) {
+	hash, ok := u[username]
+	if !ok {
+		return "", "", auth.ErrUserNotFound
+	}
+
+	return username, hash, nil
+}
+
+func newTokenIssuer(t *testing.T) (*auth.TokenIssuer, *auth.MemoryRevocationList) {
+	hash, err := auth.HashPassword("hunter2")
+	require.NoError(t, err)
+
+	revoked := auth.NewMemoryRevocationList()
+
+	return auth.NewTokenIssuer(auth.TokenIssuerOptions{
+		Key:      []byte("secret"),
+		Issuer:   "example-go",
+		Audience: []string{"api"},
+		Scopes:   []string{"read", "write"},
+		Users:    users{"rick": hash},
+		Refresh:  auth.NewMemoryRefreshStore(),
+		Revoked:  revoked,
+	}), revoked
+}
+
+func TestTokenIssuer_Login(t *testing.T) {
+	issuer, _ := newTokenIssuer(t)
+	ctx := context.Background()
+
+	_, err := issuer.Login(ctx, "rick", "wrong")
+	assert.Equal(t, auth.ErrInvalidCredentials, err)
+
+	_, err = issuer.Login(ctx, "nobody", "hunter2")
+	assert.Equal(t, auth.ErrInvalidCredentials, err)
+
+	tokens, err := issuer.Login(ctx, "rick", "hunter2")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, 900, tokens.ExpiresIn)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	token, err := auth.NewHMACVerifier([]byte("secret")).Verify(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, "rick", claims["sub"])
+	assert.Equal(t, "example-go", claims["iss"])
+	assert.Equal(t, "api", claims["aud"])
+	assert.Equal(t, "read write", claims["scope"])
+	assert.NotEmpty(t, claims["jti"])
+
+	assert.NoError(t, auth.ClaimsPolicy{
+		Issuers:   []string{"example-go"},
+		Audiences: []string{"api"},
+		MaxAge:    time.Hour,
+	}.Validate(claims, time.Now()))
+}
+
+func TestTokenIssuer_SetKey(t *testing.T) {
+	issuer, _ := newTokenIssuer(t)
+	ctx := context.Background()
+
+	issuer.SetKey([]byte("other"))
+
+	tokens, err := issuer.Login(ctx, "rick", "hunter2")
+	require.NoError(t, err)
+
+	_, err = auth.NewHMACVerifier([]byte("secret")).Verify(ctx, tokens.AccessToken)
+	assert.Error(t, err)
+
+	_, err = auth.NewHMACVerifier([]byte("other")).Verify(ctx, tokens.AccessToken)
+	assert.NoError(t, err)
+}
+
+func TestTokenIssuer_Refresh(t *testing.T) {
+	issuer, _ := newTokenIssuer(t)
+	ctx := context.Background()
+
+	first, err := issuer.Login(ctx, "rick", "hunter2")
+	require.NoError(t, err)
+
+	second, err := issuer.Refresh(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEqual(t, first.AccessToken, second.AccessToken)
+
+	_, err = issuer.Refresh(ctx, "bogus")
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonInvalidToken, Description: "refresh token is invalid"}, err)
+
+	// Reusing a refresh token revokes every token refreshed from the same login.
+	_, err = issuer.Refresh(ctx, first.RefreshToken)
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonRevoked, Description: "refresh token is revoked"}, err)
+
+	_, err = issuer.Refresh(ctx, second.RefreshToken)
+	assert.Error(t, err)
+}
+
+func TestTokenIssuer_Tenant(t *testing.T) {
+	issuer, _ := newTokenIssuer(t)
+	ctx := identity.WithTenant(context.Background(), "acme")
+
+	first, err := issuer.Login(ctx, "rick", "hunter2")
+	require.NoError(t, err)
+
+	token, err := auth.NewHMACVerifier([]byte("secret")).Verify(ctx, first.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", token.Claims.(jwt.MapClaims)["tenant"])
+
+	// The tenant is kept when refreshing without one on the context.
+	second, err := issuer.Refresh(context.Background(), first.RefreshToken)
+	require.NoError(t, err)
+
+	token, err = auth.NewHMACVerifier([]byte("secret")).Verify(ctx, second.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", token.Claims.(jwt.MapClaims)["tenant"])
+
+	_, err = issuer.Refresh(identity.WithTenant(ctx, "globex"), second.RefreshToken)
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonInvalidToken, Description: "refresh token is invalid"}, err)
+}
+
+func TestTokenIssuer_Logout(t *testing.T) {
+	issuer, revoked := newTokenIssuer(t)
+	ctx := context.Background()
+
+	tokens, err := issuer.Login(ctx, "rick", "hunter2")
+	require.NoError(t, err)
+
+	require.NoError(t, issuer.Logout(ctx, "my-jti", time.Now().Add(time.Minute), tokens.RefreshToken))
+
+	isRevoked, err := revoked.IsRevoked(ctx, "my-jti")
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	assert.Error(t, err)
+
+	// Expired tokens do not need to be revoked.
+	require.NoError(t, issuer.Logout(ctx, "old-jti", time.Now().Add(-time.Minute), ""))
+
+	isRevoked, err = revoked.IsRevoked(ctx, "old-jti")
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
@@ -0,0 +1,376 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownKey is returned when no key in the set matches the kid of a token, even after
+	// refetching the set.
+	ErrUnknownKey = errors.New("auth: unknown signing key")
+	// ErrNoKid is returned when a token has no kid, and the set has more than one key.
+	ErrNoKid = errors.New("auth: token has no kid")
+)
+
+// Default KeySetOptions.
+const (
+	DefaultRefreshInterval    = time.Hour
+	DefaultMinRefetchInterval = time.Minute
+)
+
+// KeySetOptions configures a KeySet.
+type KeySetOptions struct {
+	// Source is where the JWKS document is loaded from: an http or https url, or a local file.
+	Source string
+	// RefreshInterval is how often the set is reloaded in the background. It defaults to
+	// DefaultRefreshInterval.
+	RefreshInterval time.Duration
+	// MinRefetchInterval is how long to wait between reloads caused by a token with an unknown kid,
+	// so bad tokens cannot flood the source. It defaults to DefaultMinRefetchInterval.
+	MinRefetchInterval time.Duration
+	// Client fetches the document from a url. It defaults to http.DefaultClient.
+	Client *http.Client
+	// Log is where reload failures are logged. It defaults to a no-op logger.
+	Log *zap.Logger
+}
+
+// Key is a public key from a JWKS document.
+type Key struct {
+	// ID is the kid of the key.
+	ID string
+	// Algorithm is the alg of the key, if the document sets one.
+	Algorithm string
+	// Public is an *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+	Public interface{}
+}
+
+// KeySet holds the public keys from a JWKS document, picked by kid. The keys are reloaded in the
+// background once Start is called, and when a token has a kid that is not in the set, at most once
+// per MinRefetchInterval. Create it with NewKeySet.
+type KeySet struct {
+	opts KeySetOptions
+
+	mu          sync.RWMutex
+	keys        map[string]Key
+	lastFetched time.Time
+
+	fetchMu sync.Mutex
+}
+
+// NewKeySet creates a new KeySet, and loads the document. It returns an error if the document cannot
+// be loaded, or has no usable keys.
+func NewKeySet(ctx context.Context, o KeySetOptions) (*KeySet, error) {
+	if o.RefreshInterval <= 0 {
+		o.RefreshInterval = DefaultRefreshInterval
+	}
+
+	if o.MinRefetchInterval <= 0 {
+		o.MinRefetchInterval = DefaultMinRefetchInterval
+	}
+
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+
+	if o.Log == nil {
+		o.Log = zap.NewNop()
+	}
+
+	k := &KeySet{opts: o}
+
+	if err := k.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Start reloads the set every RefreshInterval until the returned func is called. A failed reload is
+// logged, and the previous keys are kept.
+func (k *KeySet) Start() (stop func()) {
+	done := make(chan struct{})
+	t := time.NewTicker(k.opts.RefreshInterval)
+
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				if err := k.Refresh(context.Background()); err != nil {
+					k.opts.Log.Warn("error refreshing jwks", zap.String("source", k.opts.Source), zap.Error(err))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			t.Stop()
+			close(done)
+		})
+	}
+}
+
+// Refresh reloads the document now, replacing the keys if it succeeds.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+
+	return k.refresh(ctx)
+}
+
+func (k *KeySet) refresh(ctx context.Context) error {
+	body, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	k.lastFetched = time.Now()
+	k.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseKeySet(body)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+
+	k.opts.Log.Info("loaded jwks", zap.String("source", k.opts.Source), zap.Int("keys", len(keys)))
+
+	return nil
+}
+
+func (k *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(k.opts.Source, "http://") && !strings.HasPrefix(k.opts.Source, "https://") {
+		return ioutil.ReadFile(k.opts.Source)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, k.opts.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.opts.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
+
+// maxDocumentSize caps how much of a JWKS document is read.
+const maxDocumentSize = 1 << 20
+
+// Key returns the key with the kid. If the kid is empty, the only key in the set is returned. If no
+// key matches, the set is reloaded first, unless it was loaded less than MinRefetchInterval ago.
+func (k *KeySet) Key(ctx context.Context, kid string) (Key, error) {
+	if key, err := k.lookup(kid); err != ErrUnknownKey {
+		return key, err
+	}
+
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+
+	// Another request may have reloaded the set while we waited.
+	if key, err := k.lookup(kid); err != ErrUnknownKey {
+		return key, err
+	}
+
+	k.mu.RLock()
+	wait := time.Until(k.lastFetched.Add(k.opts.MinRefetchInterval))
+	k.mu.RUnlock()
+
+	if wait > 0 {
+		return Key{}, ErrUnknownKey
+	}
+
+	if err := k.refresh(ctx); err != nil {
+		k.opts.Log.Warn("error refetching jwks for unknown kid", zap.String("source", k.opts.Source),
+			zap.String("kid", kid), zap.Error(err))
+	}
+
+	return k.lookup(kid)
+}
+
+func (k *KeySet) lookup(kid string) (Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		if len(k.keys) != 1 {
+			return Key{}, ErrNoKid
+		}
+
+		for _, key := range k.keys {
+			return key, nil
+		}
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseKeySet parses a JWKS document, keyed by kid. RSA, EC (P-256, P-384 and P-521) and OKP
+// (Ed25519) keys are supported; keys of other types, or that are not for signatures, are skipped.
+func ParseKeySet(doc []byte) (map[string]Key, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(doc, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %v", err)
+	}
+
+	keys := map[string]Key{}
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		pub, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %q: %v", jwk.Kid, err)
+		}
+
+		if pub == nil {
+			continue
+		}
+
+		keys[jwk.Kid] = Key{ID: jwk.Kid, Algorithm: jwk.Alg, Public: pub}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("invalid jwks: no usable keys")
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the public key, or nil if the key type is not supported.
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, nil
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("missing key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PasswordIterations is the number of PBKDF2-HMAC-SHA256 iterations used by HashPassword, as
+// recommended by OWASP.
+const PasswordIterations = 600000
+
+const passwordScheme = "pbkdf2-sha256"
+
+// ErrInvalidPasswordHash is returned when a stored password hash cannot be parsed.
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+// HashPassword hashes the password with PBKDF2-HMAC-SHA256 and a random salt, for storing in the
+// users table. The hash has the form pbkdf2-sha256$<iterations>$<salt>$<key>, so the number of
+// iterations can be raised without breaking the stored hashes.
+func HashPassword(password string) (string, error) {
+	return hashPassword(password, PasswordIterations)
+}
+
+func hashPassword(password string, iterations int) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2([]byte(password), salt, iterations, sha256.Size)
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword returns true if the password matches the hash made by HashPassword. It returns
+// ErrInvalidPasswordHash if the hash cannot be parsed.
+func CheckPassword(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false, ErrInvalidPasswordHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	got := pbkdf2([]byte(password), salt, iterations, len(want))
+
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// pbkdf2 derives a key from the password with PBKDF2-HMAC-SHA256, as described in RFC 8018.
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keyLen + prf.Size() - 1) / prf.Size()
+
+	key := make([]byte, 0, blocks*prf.Size())
+	counter := make([]byte, 4)
+	u := make([]byte, prf.Size())
+	t := make([]byte, prf.Size())
+
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter, uint32(block))
+
+		prf.Reset()
+		prf.Write(salt)    // nolint
+		prf.Write(counter) // nolint
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u) // nolint
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
@@ -0,0 +1,65 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func TestCheckPassword_Vectors(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("salt"))
+
+	// PBKDF2-HMAC-SHA256 test vectors for the password "password".
+	for _, tc := range []struct {
+		iterations string
+		key        string
+	}{
+		{"1", "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"2", "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"4096", "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	} {
+		key, err := hex.DecodeString(tc.key)
+		require.NoError(t, err)
+
+		hash := "pbkdf2-sha256$" + tc.iterations + "$" + salt + "$" + base64.RawStdEncoding.EncodeToString(key)
+
+		ok, err := auth.CheckPassword(hash, "password")
+		require.NoError(t, err)
+		assert.True(t, ok, tc.iterations)
+
+		ok, err = auth.CheckPassword(hash, "Password")
+		require.NoError(t, err)
+		assert.False(t, ok, tc.iterations)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := auth.HashPassword("hunter2")
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^pbkdf2-sha256\$600000\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, hash)
+
+	other, err := auth.HashPassword("hunter2")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salts are random")
+
+	ok, err := auth.CheckPassword(hash, "hunter2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = auth.CheckPassword(hash, "hunter3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCheckPassword_Invalid(t *testing.T) {
+	for _, hash := range []string{"", "hunter2", "bcrypt$1$c2FsdA$a2V5", "pbkdf2-sha256$0$c2FsdA$a2V5", "pbkdf2-sha256$1$!!$a2V5"} {
+		_, err := auth.CheckPassword(hash, "hunter2")
+		assert.Equal(t, auth.ErrInvalidPasswordHash, err, hash)
+	}
+}
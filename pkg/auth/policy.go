@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// Policy decides whether a principal may act on a resource. The Name is logged when the policy
+// denies a request.
+type Policy struct {
+	Name  string
+	Allow func(p identity.Principal, resource interface{}) bool
+}
+
+// Forbidden is returned when a policy denies a principal.
+type Forbidden struct {
+	Policy string
+}
+
+func (e *Forbidden) Error() string {
+	return fmt.Sprintf("denied by policy %s", e.Policy)
+}
+
+// RequireScopes allows principals whose token has every one of the scopes.
+func RequireScopes(scopes ...string) Policy {
+	return Policy{
+		Name: "scopes:" + strings.Join(scopes, ","),
+		Allow: func(p identity.Principal, resource interface{}) bool {
+			for _, s := range scopes {
+				if !p.HasScope(s) {
+					return false
+				}
+			}
+
+			return true
+		},
+	}
+}
+
+// RequireRoles allows principals with at least one of the roles.
+func RequireRoles(roles ...string) Policy {
+	return Policy{
+		Name: "roles:" + strings.Join(roles, ","),
+		Allow: func(p identity.Principal, resource interface{}) bool {
+			for _, r := range roles {
+				if p.HasRole(r) {
+					return true
+				}
+			}
+
+			return false
+		},
+	}
+}
+
+// Owned is a resource that belongs to a principal.
+type Owned interface {
+	// OwnerID is the identity.Principal.ID of the owner.
+	OwnerID() string
+}
+
+// OwnerOrRoles allows the owner of the resource, and principals with at least one of the roles, such
+// as an admin. The resource is an Owned, or the owner id as a string.
+func OwnerOrRoles(roles ...string) Policy {
+	byRole := RequireRoles(roles...)
+
+	return Policy{
+		Name: "owner-or-roles:" + strings.Join(roles, ","),
+		Allow: func(p identity.Principal, resource interface{}) bool {
+			var owner string
+
+			switch r := resource.(type) {
+			case Owned:
+				owner = r.OwnerID()
+			case string:
+				owner = r
+			}
+
+			if owner != "" && owner == p.ID() {
+				return true
+			}
+
+			return byRole.Allow(p, resource)
+		},
+	}
+}
+
+// RequireCSRFToken allows requests whose resource, the token sent with the request, is the CSRF token
+// of the session.
+func RequireCSRFToken(sess Session) Policy {
+	return Policy{
+		Name: "csrf",
+		Allow: func(p identity.Principal, resource interface{}) bool {
+			token, _ := resource.(string)
+			return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sess.CSRFToken)) == 1
+		},
+	}
+}
+
+// RequireTenant allows principals that belong to the resource, the tenant the request is for.
+// Principals without a tenant are denied, so they cannot act on any tenant.
+func RequireTenant() Policy {
+	return Policy{
+		Name: "tenant",
+		Allow: func(p identity.Principal, resource interface{}) bool {
+			tenant, _ := resource.(string)
+			return tenant != "" && p.Tenant == tenant
+		},
+	}
+}
+
+// Authorize checks the policy for the principal on the context, acting on the resource. If the
+// policy denies it, the denial is logged with the principal and the policy, recorded as an audit
+// event, and a *Forbidden is returned. A request without a principal is always denied.
+func Authorize(ctx context.Context, policy Policy, resource interface{}) error {
+	p, ok := identity.PrincipalFromContext(ctx)
+	if ok && policy.Allow(p, resource) {
+		return nil
+	}
+
+	fields := append(PrincipalFields(p), zap.String("policy", policy.Name))
+
+	logging.FromContext(ctx).Warn("access denied", fields...)
+	logging.AddRequestFields(ctx, zap.String("denied_by", policy.Name))
+
+	audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAuthorization,
+		Outcome: audit.OutcomeDenied,
+		Reason:  policy.Name,
+	})
+
+	return &Forbidden{Policy: policy.Name}
+}
+
+// PrincipalFields returns the log fields for the principal. The email and name are left out, since
+// they are personal data; the subject identifies the principal. The tenant is left out too, since
+// it is logged for the whole request once it is resolved; see middleware.Tenant.
+func PrincipalFields(p identity.Principal) []zap.Field {
+	fields := []zap.Field{
+		zap.String("principal", p.ID()),
+		zap.String("auth_method", p.AuthMethod),
+	}
+
+	if len(p.Roles) > 0 {
+		fields = append(fields, zap.Strings("roles", p.Roles))
+	}
+
+	if len(p.Scopes) > 0 {
+		fields = append(fields, zap.Strings("scopes", p.Scopes))
+	}
+
+	if p.TokenID != "" {
+		fields = append(fields, zap.String("token_id", p.TokenID))
+	}
+
+	return fields
+}
+
+// RoleSource looks up the roles granted to a principal outside of their token, such as in a
+// database table.
+type RoleSource interface {
+	Roles(ctx context.Context, p identity.Principal) ([]string, error)
+}
+
+// WithRoles adds the roles from the source to the principal on the context, keeping the roles from
+// the token.
+func WithRoles(ctx context.Context, src RoleSource) (context.Context, error) {
+	p, ok := identity.PrincipalFromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+
+	roles, err := src.Roles(ctx, p)
+	if err != nil {
+		return ctx, err
+	}
+
+	merged := append([]string(nil), p.Roles...)
+
+	for _, r := range roles {
+		if !p.HasRole(r) {
+			merged = append(merged, r)
+		}
+	}
+
+	p.Roles = merged
+
+	return identity.WithPrincipal(ctx, p), nil
+}
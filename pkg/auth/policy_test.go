@@ -0,0 +1,93 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+type record struct {
+	owner string
+}
+
+func (r record) OwnerID() string {
+	return r.owner
+}
+
+func TestPolicies(t *testing.T) {
+	user := identity.Principal{Subject: "user-1", Roles: []string{"editor"}, Scopes: []string{"read", "write"}}
+	admin := identity.Principal{Subject: "admin-1", Roles: []string{"admin"}}
+
+	assert.True(t, auth.RequireScopes("read", "write").Allow(user, nil))
+	assert.False(t, auth.RequireScopes("read", "delete").Allow(user, nil))
+
+	assert.True(t, auth.RequireRoles("admin", "editor").Allow(user, nil))
+	assert.False(t, auth.RequireRoles("admin").Allow(user, nil))
+
+	ownerOrAdmin := auth.OwnerOrRoles("admin")
+	assert.True(t, ownerOrAdmin.Allow(user, record{owner: "user-1"}))
+	assert.True(t, ownerOrAdmin.Allow(user, "user-1"))
+	assert.False(t, ownerOrAdmin.Allow(user, record{owner: "user-2"}))
+	assert.True(t, ownerOrAdmin.Allow(admin, record{owner: "user-2"}))
+	assert.False(t, ownerOrAdmin.Allow(identity.Principal{}, record{}))
+
+	tenant := auth.RequireTenant()
+	assert.True(t, tenant.Allow(identity.Principal{Tenant: "acme"}, "acme"))
+	assert.False(t, tenant.Allow(identity.Principal{Tenant: "acme"}, "globex"))
+	assert.False(t, tenant.Allow(identity.Principal{}, ""))
+}
+
+func TestAuthorize(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	ctx := logging.WithLogger(context.Background(), log)
+
+	err := auth.Authorize(ctx, auth.RequireRoles("admin"), nil)
+	assert.EqualError(t, err, "denied by policy roles:admin")
+
+	ctx = identity.WithPrincipal(ctx, identity.Principal{Subject: "user-1", AuthMethod: identity.AuthMethodJWT})
+
+	err = auth.Authorize(ctx, auth.OwnerOrRoles("admin"), record{owner: "user-2"})
+	assert.Equal(t, &auth.Forbidden{Policy: "owner-or-roles:admin"}, err)
+	assert.Contains(t, buf.String(), `"msg":"access denied","principal":"user-1","auth_method":"jwt","policy":"owner-or-roles:admin"`)
+
+	assert.NoError(t, auth.Authorize(ctx, auth.OwnerOrRoles("admin"), record{owner: "user-1"}))
+}
+
+type roleSource struct {
+	roles []string
+	err   error
+}
+
+func (s roleSource) Roles(ctx context.Context, p identity.Principal) ([]string, error) {
+	return s.roles, s.err
+}
+
+func TestWithRoles(t *testing.T) {
+	ctx := identity.WithPrincipal(context.Background(), identity.Principal{Subject: "user-1", Roles: []string{"editor"}})
+
+	ctx, err := auth.WithRoles(ctx, roleSource{roles: []string{"editor", "admin"}})
+	require.NoError(t, err)
+
+	p, _ := identity.PrincipalFromContext(ctx)
+	assert.Equal(t, []string{"editor", "admin"}, p.Roles)
+
+	_, err = auth.WithRoles(ctx, roleSource{err: errors.New("db down")})
+	assert.EqualError(t, err, "db down")
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+// ErrSessionNotFound is returned by a SessionStore when there is no session with the id.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionCookieName is the name of the session cookie. The __Host- prefix makes browsers reject it
+// unless it is Secure, for the whole host, and set over https.
+const SessionCookieName = "__Host-session"
+
+// CSRFHeader is the request header the CSRF token of the session is sent in.
+const CSRFHeader = "X-CSRF-Token"
+
+// SessionCookie returns the session cookie with the value, which expires after maxAge. If maxAge is
+// negative, the cookie is deleted. It is HttpOnly, so scripts cannot read it, and SameSite strict.
+func SessionCookie(value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    value,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(maxAge / time.Second),
+	}
+
+	if maxAge < 0 {
+		c.MaxAge = -1
+	}
+
+	return c
+}
+
+// Session is a browser session, as stored. Only the hash of the session cookie is kept, as its ID,
+// so the ID can be shown when listing sessions.
+type Session struct {
+	ID string `json:"id"`
+	// Principal is who logged in, with AuthMethodSession.
+	Principal identity.Principal `json:"principal"`
+	// CSRFToken must be sent with every unsafe request made with the session; see
+	// middleware.CSRF.
+	CSRFToken string `json:"csrf_token"`
+	// UserAgent and IP describe where the session was created, to help users recognize it.
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ExpiresAt is the absolute timeout of the session. It ends earlier if it is idle for too long.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionStore stores sessions until they expire, such as in redis; see cache.NewSessionStore.
+type SessionStore interface {
+	// Save stores the session, replacing it if it exists, until the ttl has passed.
+	Save(ctx context.Context, s Session, ttl time.Duration) error
+	// Get returns the session with the id, or ErrSessionNotFound.
+	Get(ctx context.Context, id string) (Session, error)
+	// List returns the sessions of the subject.
+	List(ctx context.Context, subject string) ([]Session, error)
+	// Delete removes the session.
+	Delete(ctx context.Context, s Session) error
+}
+
+// SessionOptions configures Sessions.
+type SessionOptions struct {
+	// IdleTimeout ends a session that has not been used for this long. By default, it is 30 minutes.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends a session this long after it was created, however much it is used. By
+	// default, it is 12 hours.
+	AbsoluteTimeout time.Duration
+	// TouchInterval is how often the last use of a session is written to the store, so a busy
+	// session does not write on every request. By default, it is one minute.
+	TouchInterval time.Duration
+}
+
+// Sessions creates, looks up and revokes browser sessions kept in a store.
+type Sessions struct {
+	store SessionStore
+	o     SessionOptions
+}
+
+// NewSessions creates a new Sessions using the store.
+func NewSessions(store SessionStore, o SessionOptions) *Sessions {
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 30 * time.Minute
+	}
+
+	if o.AbsoluteTimeout <= 0 {
+		o.AbsoluteTimeout = 12 * time.Hour
+	}
+
+	if o.TouchInterval <= 0 {
+		o.TouchInterval = time.Minute
+	}
+
+	return &Sessions{store: store, o: o}
+}
+
+// AbsoluteTimeout is how long after it was created a session ends.
+func (s *Sessions) AbsoluteTimeout() time.Duration {
+	return s.o.AbsoluteTimeout
+}
+
+// Create starts a session for the principal. The returned cookie value is not stored and cannot be
+// recovered from the session.
+func (s *Sessions) Create(ctx context.Context, p identity.Principal, userAgent, ip string) (Session, string, error) {
+	cookie, err := randomHex(32)
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	csrf, err := randomHex(32)
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	now := time.Now().UTC()
+	id := hashSecret(cookie)
+
+	p.AuthMethod = identity.AuthMethodSession
+	p.TokenID = id
+
+	sess := Session{
+		ID:         id,
+		Principal:  p,
+		CSRFToken:  csrf,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.o.AbsoluteTimeout),
+	}
+
+	if err := s.store.Save(ctx, sess, s.ttl(sess, now)); err != nil {
+		return Session{}, "", err
+	}
+
+	logging.FromContext(ctx).Info("session created", append(PrincipalFields(p), zap.String("ip", ip))...)
+
+	return sess, cookie, nil
+}
+
+// Lookup returns the session for the cookie value, and extends its idle timeout. It returns an
+// *Error if the session is unknown or has ended.
+func (s *Sessions) Lookup(ctx context.Context, cookie string) (Session, error) {
+	sess, err := s.store.Get(ctx, hashSecret(cookie))
+	if err == ErrSessionNotFound {
+		return Session{}, reject(ReasonInvalidToken, "session is invalid")
+	} else if err != nil {
+		return Session{}, err
+	}
+
+	now := time.Now()
+
+	if !now.Before(sess.ExpiresAt) || now.Sub(sess.LastSeenAt) >= s.o.IdleTimeout {
+		// The store may not have expired it yet.
+		if err := s.store.Delete(ctx, sess); err != nil {
+			return Session{}, err
+		}
+
+		return Session{}, reject(ReasonExpired, "session is expired")
+	}
+
+	if now.Sub(sess.LastSeenAt) >= s.o.TouchInterval {
+		sess.LastSeenAt = now.UTC()
+
+		// Failing to extend the session should not fail the request.
+		if err := s.store.Save(ctx, sess, s.ttl(sess, now)); err != nil {
+			logging.FromContext(ctx).Warn("error extending session", zap.Error(err))
+		}
+	}
+
+	return sess, nil
+}
+
+// List returns the sessions of the subject in the tenant on the context, most recently used first.
+func (s *Sessions) List(ctx context.Context, subject string) ([]Session, error) {
+	all, err := s.store.List(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+
+	for _, sess := range all {
+		if inTenant(ctx, sess.Principal) {
+			sessions = append(sessions, sess)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// Revoke ends the session with the id, if it belongs to the subject in the tenant on the context. It
+// returns ErrSessionNotFound otherwise, so the sessions of other users cannot be found.
+func (s *Sessions) Revoke(ctx context.Context, subject, id string) error {
+	sess, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if sess.Principal.ID() != subject || !inTenant(ctx, sess.Principal) {
+		return ErrSessionNotFound
+	}
+
+	if err := s.store.Delete(ctx, sess); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("session revoked", PrincipalFields(sess.Principal)...)
+
+	return nil
+}
+
+// RevokeAll ends every session of the subject, in every tenant.
+func (s *Sessions) RevokeAll(ctx context.Context, subject string) error {
+	sessions, err := s.store.List(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	for _, sess := range sessions {
+		if err := s.store.Delete(ctx, sess); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inTenant returns true if the principal belongs to the tenant on the context, or neither has one.
+func inTenant(ctx context.Context, p identity.Principal) bool {
+	tenant, _ := identity.TenantFromContext(ctx)
+	return p.Tenant == tenant
+}
+
+// ttl is how long the store should keep the session: until it is idle for too long, or it reaches
+// its absolute timeout.
+func (s *Sessions) ttl(sess Session, now time.Time) time.Duration {
+	ttl := s.o.IdleTimeout
+	if remaining := sess.ExpiresAt.Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+
+	return ttl
+}
+
+// MemorySessionStore is a SessionStore kept in memory, for tests and local runs. Sessions are only
+// removed when they are looked up after they end.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore creates an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+// Save stores the session, replacing it if it exists.
+func (m *MemorySessionStore) Save(ctx context.Context, s Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.ID] = s
+
+	return nil
+}
+
+// Get returns the session with the id, or ErrSessionNotFound.
+func (m *MemorySessionStore) Get(ctx context.Context, id string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+
+	return s, nil
+}
+
+// List returns the sessions of the subject.
+func (m *MemorySessionStore) List(ctx context.Context, subject string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []Session
+
+	for _, s := range m.sessions {
+		if s.Principal.ID() == subject {
+			sessions = append(sessions, s)
+		}
+	}
+
+	return sessions, nil
+}
+
+// Delete removes the session.
+func (m *MemorySessionStore) Delete(ctx context.Context, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, s.ID)
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestSessions(t *testing.T) {
+	sessions := auth.NewSessions(auth.NewMemorySessionStore(), auth.SessionOptions{})
+	ctx := context.Background()
+
+	sess, cookie, err := sessions.Create(ctx, identity.Principal{Subject: "rick", Scopes: []string{"read"}}, "my-browser", "10.0.0.1")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, cookie, sess.ID)
+	assert.NotEmpty(t, sess.CSRFToken)
+	assert.Equal(t, identity.AuthMethodSession, sess.Principal.AuthMethod)
+	assert.Equal(t, sess.ID, sess.Principal.TokenID)
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), sess.ExpiresAt, time.Minute)
+
+	found, err := sessions.Lookup(ctx, cookie)
+	require.NoError(t, err)
+	assert.Equal(t, sess.ID, found.ID)
+	assert.Equal(t, "rick", found.Principal.ID())
+
+	_, err = sessions.Lookup(ctx, sess.ID)
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonInvalidToken, Description: "session is invalid"}, err)
+
+	other, _, err := sessions.Create(ctx, identity.Principal{Subject: "rick"}, "my-phone", "10.0.0.2")
+	require.NoError(t, err)
+
+	list, err := sessions.List(ctx, "rick")
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// Sessions of other users cannot be revoked.
+	assert.Equal(t, auth.ErrSessionNotFound, sessions.Revoke(ctx, "someone-else", sess.ID))
+
+	require.NoError(t, sessions.Revoke(ctx, "rick", sess.ID))
+
+	_, err = sessions.Lookup(ctx, cookie)
+	assert.Error(t, err)
+
+	require.NoError(t, sessions.RevokeAll(ctx, "rick"))
+
+	list, err = sessions.List(ctx, "rick")
+	require.NoError(t, err)
+	assert.Empty(t, list, other.ID)
+}
+
+func TestSessions_Tenant(t *testing.T) {
+	sessions := auth.NewSessions(auth.NewMemorySessionStore(), auth.SessionOptions{})
+	acme := identity.WithTenant(context.Background(), "acme")
+	globex := identity.WithTenant(context.Background(), "globex")
+
+	sess, _, err := sessions.Create(acme, identity.Principal{Subject: "rick", Tenant: "acme"}, "my-browser", "10.0.0.1")
+	require.NoError(t, err)
+
+	_, _, err = sessions.Create(globex, identity.Principal{Subject: "rick", Tenant: "globex"}, "my-browser", "10.0.0.1")
+	require.NoError(t, err)
+
+	list, err := sessions.List(acme, "rick")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, sess.ID, list[0].ID)
+
+	// The same subject in another tenant is someone else.
+	assert.Equal(t, auth.ErrSessionNotFound, sessions.Revoke(globex, "rick", sess.ID))
+	assert.NoError(t, sessions.Revoke(acme, "rick", sess.ID))
+}
+
+func TestSessions_Timeouts(t *testing.T) {
+	ctx := context.Background()
+
+	idle := auth.NewSessions(auth.NewMemorySessionStore(), auth.SessionOptions{
+		IdleTimeout:   50 * time.Millisecond,
+		TouchInterval: time.Millisecond,
+	})
+
+	_, cookie, err := idle.Create(ctx, identity.Principal{Subject: "rick"}, "", "")
+	require.NoError(t, err)
+
+	// Using the session keeps it alive.
+	for i := 0; i < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		_, err = idle.Lookup(ctx, cookie)
+		require.NoError(t, err)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+
+	_, err = idle.Lookup(ctx, cookie)
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonExpired, Description: "session is expired"}, err)
+
+	absolute := auth.NewSessions(auth.NewMemorySessionStore(), auth.SessionOptions{
+		AbsoluteTimeout: 20 * time.Millisecond,
+		TouchInterval:   time.Millisecond,
+	})
+
+	_, cookie, err = absolute.Create(ctx, identity.Principal{Subject: "rick"}, "", "")
+	require.NoError(t, err)
+
+	// The session ends however much it is used.
+	for i := 0; i < 3 && err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err = absolute.Lookup(ctx, cookie)
+	}
+
+	assert.Equal(t, &auth.Error{Reason: auth.ReasonExpired, Description: "session is expired"}, err)
+}
@@ -0,0 +1,120 @@
+// Package auth verifies the JSON web tokens used to authenticate API requests, either with a shared
+// HMAC secret or with public keys loaded from a JWKS document, and the API keys issued by APIKeys.
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+)
+
+// KeySetAlgorithms are the algorithms accepted by a KeySet verifier.
+var KeySetAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Verifier verifies the signature and expiry of a token. Create it with NewHMACVerifier or
+// NewKeySetVerifier.
+type Verifier struct {
+	parser  *jwt.Parser
+	keyFunc func(ctx context.Context, t *jwt.Token) (interface{}, error)
+}
+
+// NewHMACVerifier creates a Verifier for HS256 tokens signed with the shared secret.
+func NewHMACVerifier(secret []byte) *Verifier {
+	return &Verifier{
+		parser: &jwt.Parser{ValidMethods: []string{"HS256"}, SkipClaimsValidation: true},
+		keyFunc: func(ctx context.Context, t *jwt.Token) (interface{}, error) {
+			return secret, nil
+		},
+	}
+}
+
+// NewKeySetVerifier creates a Verifier for tokens signed with one of the KeySetAlgorithms, by a key in
+// the set. The key is picked by the kid in the token header, and must match the algorithm of the
+// token.
+func NewKeySetVerifier(keys *KeySet) *Verifier {
+	return &Verifier{
+		parser: &jwt.Parser{ValidMethods: KeySetAlgorithms, SkipClaimsValidation: true},
+		keyFunc: func(ctx context.Context, t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+
+			key, err := keys.Key(ctx, kid)
+			if err != nil {
+				return nil, err
+			}
+
+			if !keyMatches(key, t.Method.Alg()) {
+				return nil, fmt.Errorf("auth: key %q cannot verify %s tokens", key.ID, t.Method.Alg())
+			}
+
+			return key.Public, nil
+		},
+	}
+}
+
+func keyMatches(key Key, alg string) bool {
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return false
+	}
+
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		return alg[:2] == "RS"
+	case *ecdsa.PublicKey:
+		return alg[:2] == "ES"
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+
+	return false
+}
+
+// Verify parses the token and checks its signature and expiry. It returns the token, whose claims
+// are jwt.MapClaims, or an error, which is jwtauth.ErrExpired if the token has expired.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	token, err := v.parser.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		return v.keyFunc(ctx, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return token, jwtauth.ErrUnauthorized
+	}
+
+	if jwtauth.IsExpired(token) {
+		return token, jwtauth.ErrExpired
+	}
+
+	return token, nil
+}
+
+// SwappableVerifier verifies tokens with a Verifier that can be replaced while the server is running,
+// such as when the JWT secret is reloaded. It is safe for concurrent use.
+type SwappableVerifier struct {
+	v atomic.Value
+}
+
+// NewSwappableVerifier creates a SwappableVerifier that verifies tokens with v.
+func NewSwappableVerifier(v *Verifier) *SwappableVerifier {
+	s := &SwappableVerifier{}
+	s.Swap(v)
+
+	return s
+}
+
+// Swap verifies every later token with v.
+func (s *SwappableVerifier) Swap(v *Verifier) {
+	s.v.Store(v)
+}
+
+// Verify verifies the token with the current Verifier; see Verifier.Verify.
+func (s *SwappableVerifier) Verify(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	return s.v.Load().(*Verifier).Verify(ctx, tokenString)
+}
@@ -0,0 +1,255 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(k.X.Bytes()), "y": b64(k.Y.Bytes()),
+	}
+}
+
+func edJWK(kid string, k ed25519.PublicKey) map[string]string {
+	return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k)}
+}
+
+func jwks(t *testing.T, keys ...map[string]string) []byte {
+	doc, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+
+	return doc
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return s
+}
+
+// jwksServer serves the document returned by doc, counting the requests.
+type jwksServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	doc      []byte
+	requests int32
+}
+
+func newJWKSServer(doc []byte) *jwksServer {
+	s := &jwksServer{doc: doc}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.doc) // nolint
+	}))
+
+	return s
+}
+
+func (s *jwksServer) setDoc(doc []byte) {
+	s.mu.Lock()
+	s.doc = doc
+	s.mu.Unlock()
+}
+
+func TestKeySetVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	s := newJWKSServer(jwks(t, rsaJWK("rsa", &rsaKey.PublicKey), ecJWK("ec", &ecKey.PublicKey), edJWK("ed", edPub)))
+	defer s.Close()
+
+	keys, err := auth.NewKeySet(context.Background(), auth.KeySetOptions{Source: s.URL})
+	require.NoError(t, err)
+
+	v := auth.NewKeySetVerifier(keys)
+	ctx := context.Background()
+	claims := jwt.MapClaims{"email": "rick@example.com", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for _, tc := range []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    interface{}
+	}{
+		{"RS256", jwt.SigningMethodRS256, "rsa", rsaKey},
+		{"ES256", jwt.SigningMethodES256, "ec", ecKey},
+		{"EdDSA", auth.SigningMethodEdDSA, "ed", edKey},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := v.Verify(ctx, sign(t, tc.method, tc.kid, tc.key, claims))
+			require.NoError(t, err)
+			assert.Equal(t, "rick@example.com", token.Claims.(jwt.MapClaims)["email"])
+		})
+	}
+
+	t.Run("wrong key for kid", func(t *testing.T) {
+		_, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, "rsa", ecKey, claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("HS256 not accepted", func(t *testing.T) {
+		_, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		_, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, jwt.MapClaims{
+			"exp": time.Now().Add(-time.Minute).Unix(),
+		}))
+		assert.Equal(t, jwtauth.ErrExpired, err)
+	})
+
+	t.Run("no kid with many keys", func(t *testing.T) {
+		_, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "", rsaKey, claims))
+		assert.Error(t, err)
+	})
+}
+
+func TestKeySet_UnknownKid(t *testing.T) {
+	oldKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	newPub, newKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	s := newJWKSServer(jwks(t, edJWK("old", oldKey)))
+	defer s.Close()
+
+	keys, err := auth.NewKeySet(context.Background(), auth.KeySetOptions{
+		Source:             s.URL,
+		MinRefetchInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	v := auth.NewKeySetVerifier(keys)
+	token := sign(t, auth.SigningMethodEdDSA, "new", newKey, jwt.MapClaims{})
+
+	// The key rotated right after the set was loaded, so it is too soon to refetch.
+	s.setDoc(jwks(t, edJWK("old", oldKey), edJWK("new", newPub)))
+
+	_, err = v.Verify(context.Background(), token)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&s.requests))
+
+	time.Sleep(60 * time.Millisecond)
+
+	_, err = v.Verify(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&s.requests))
+
+	// Unknown kids do not refetch again until the interval has passed.
+	for i := 0; i < 5; i++ {
+		_, err = v.Verify(context.Background(), sign(t, auth.SigningMethodEdDSA, "bogus", newKey, jwt.MapClaims{}))
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&s.requests))
+}
+
+func TestKeySet_File(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "jwks")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // nolint
+
+	_, err = f.Write(jwks(t, edJWK("ed", pub)))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	keys, err := auth.NewKeySet(context.Background(), auth.KeySetOptions{Source: f.Name()})
+	require.NoError(t, err)
+
+	// With a single key, a token without a kid uses it.
+	_, err = auth.NewKeySetVerifier(keys).Verify(context.Background(), sign(t, auth.SigningMethodEdDSA, "", key, jwt.MapClaims{}))
+	assert.NoError(t, err)
+}
+
+func TestParseKeySet_Invalid(t *testing.T) {
+	_, err := auth.ParseKeySet([]byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`))
+	assert.EqualError(t, err, "invalid jwks: no usable keys")
+
+	_, err = auth.ParseKeySet([]byte(`{"keys":[{"kty":"EC","kid":"ec","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	assert.EqualError(t, err, `invalid jwk "ec": point is not on the curve`)
+}
+
+func TestHMACVerifier(t *testing.T) {
+	v := auth.NewHMACVerifier([]byte("secret"))
+
+	_, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{}))
+	assert.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("other"), jwt.MapClaims{}))
+	assert.Error(t, err)
+}
+
+func TestSwappableVerifier(t *testing.T) {
+	v := auth.NewSwappableVerifier(auth.NewHMACVerifier([]byte("secret")))
+
+	token := sign(t, jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{})
+
+	_, err := v.Verify(context.Background(), token)
+	assert.NoError(t, err)
+
+	v.Swap(auth.NewHMACVerifier([]byte("other")))
+
+	_, err = v.Verify(context.Background(), token)
+	assert.Error(t, err)
+
+	_, err = v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("other"), jwt.MapClaims{}))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+const apiKeySetKey = "apikeys"
+
+func apiKeyKey(id string) string {
+	return "apikey:" + id
+}
+
+// The last use is kept apart from the key, so recording it cannot race with a revoke.
+func apiKeyLastUsedKey(id string) string {
+	return "apikey:" + id + ":last_used"
+}
+
+// APIKeyStore is an auth.APIKeyStore kept in redis. Each key is stored as JSON, with the ids of every
+// key in a set for listing. Keys are managed from the admin listener, outside of any tenant, so
+// their redis keys are not prefixed; each key records its own tenant instead.
+type APIKeyStore struct {
+	c *Cache
+}
+
+// NewAPIKeyStore creates a new APIKeyStore using the cache.
+func NewAPIKeyStore(c *Cache) *APIKeyStore {
+	return &APIKeyStore{c: c}
+}
+
+// Create stores a new key.
+func (s *APIKeyStore) Create(ctx context.Context, k auth.APIKey) error {
+	b, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	client := s.c.client.WithContext(ctx)
+
+	ok, err := client.SetNX(apiKeyKey(k.ID), b, 0).Result()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("api key already exists")
+	}
+
+	return client.SAdd(apiKeySetKey, k.ID).Err()
+}
+
+// Get returns the key with the id, or auth.ErrAPIKeyNotFound.
+func (s *APIKeyStore) Get(ctx context.Context, id string) (auth.APIKey, error) {
+	client := s.c.client.WithContext(ctx)
+
+	values, err := client.MGet(apiKeyKey(id), apiKeyLastUsedKey(id)).Result()
+	if err != nil {
+		return auth.APIKey{}, err
+	}
+
+	return decodeAPIKey(values[0], values[1])
+}
+
+// List returns every key.
+func (s *APIKeyStore) List(ctx context.Context) ([]auth.APIKey, error) {
+	client := s.c.client.WithContext(ctx)
+
+	ids, err := client.SMembers(apiKeySetKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]auth.APIKey, 0, len(ids))
+
+	for _, id := range ids {
+		k, err := s.Get(ctx, id)
+		if err == auth.ErrAPIKeyNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// Update replaces a stored key.
+func (s *APIKeyStore) Update(ctx context.Context, k auth.APIKey) error {
+	b, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.c.client.WithContext(ctx).SetXX(apiKeyKey(k.ID), b, 0).Result()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return auth.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Touch records that the key with the id was used at the time.
+func (s *APIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return s.c.client.WithContext(ctx).Set(apiKeyLastUsedKey(id), at.Format(time.RFC3339Nano), 0).Err()
+}
+
+func decodeAPIKey(value, lastUsed interface{}) (auth.APIKey, error) {
+	var k auth.APIKey
+
+	s, ok := value.(string)
+	if !ok {
+		return k, auth.ErrAPIKeyNotFound
+	}
+
+	if err := json.Unmarshal([]byte(s), &k); err != nil {
+		return k, err
+	}
+
+	if s, ok := lastUsed.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil && t.After(k.LastUsedAt) {
+			k.LastUsedAt = t
+		}
+	}
+
+	return k, nil
+}
@@ -0,0 +1,85 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/cache"
+)
+
+func TestDecodeAPIKey(t *testing.T) {
+	stored := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	touched := stored.Add(time.Minute)
+
+	value := `{"id":"k1","name":"ci","owner":"user-1","hash":"abc","created_at":"2020-01-01T00:00:00Z","last_used_at":"2020-01-02T03:04:05Z"}`
+
+	for _, tt := range []struct {
+		name     string
+		value    interface{}
+		lastUsed interface{}
+		want     time.Time
+		err      error
+	}{
+		{name: "never touched", value: value, lastUsed: nil, want: stored},
+		{name: "touched since", value: value, lastUsed: touched.Format(time.RFC3339Nano), want: touched},
+		{name: "touched before", value: value, lastUsed: stored.Add(-time.Minute).Format(time.RFC3339Nano), want: stored},
+		{name: "bad last use", value: value, lastUsed: "yesterday", want: stored},
+		{name: "missing", value: nil, lastUsed: touched.Format(time.RFC3339Nano), err: auth.ErrAPIKeyNotFound},
+	} {
+		k, err := cache.DecodeAPIKey(tt.value, tt.lastUsed)
+		if tt.err != nil {
+			assert.Equal(t, tt.err, err, tt.name)
+			continue
+		}
+
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, "k1", k.ID, tt.name)
+		assert.Equal(t, "user-1", k.Owner, tt.name)
+		assert.True(t, tt.want.Equal(k.LastUsedAt), tt.name)
+	}
+
+	_, err := cache.DecodeAPIKey("{", nil)
+	assert.Error(t, err)
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	c, _, stop := newTestCache(t)
+	defer stop()
+
+	ctx := context.Background()
+	s := cache.NewAPIKeyStore(c)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	k := auth.APIKey{ID: "k1", Name: "ci", Owner: "user-1", Hash: "abc", CreatedAt: created}
+
+	require.NoError(t, s.Create(ctx, k))
+	assert.Error(t, s.Create(ctx, k))
+
+	// The last use is stored apart from the key, and merged in when it is read.
+	used := created.Add(time.Minute)
+	require.NoError(t, s.Touch(ctx, "k1", used))
+
+	got, err := s.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.True(t, used.Equal(got.LastUsedAt))
+
+	// Revoking the key does not lose its last use.
+	k.RevokedAt = used.Add(time.Minute)
+	require.NoError(t, s.Update(ctx, k))
+
+	keys, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, k.RevokedAt.Equal(keys[0].RevokedAt))
+	assert.True(t, used.Equal(keys[0].LastUsedAt))
+
+	assert.Equal(t, auth.ErrAPIKeyNotFound, s.Update(ctx, auth.APIKey{ID: "k2"}))
+
+	_, err = s.Get(ctx, "k2")
+	assert.Equal(t, auth.ErrAPIKeyNotFound, err)
+}
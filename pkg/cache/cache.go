@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/go-redis/redis/v7"
+
+	"github.com/rickbassham/example-go/pkg/identity"
 )
 
 // Client represents the functions needed for this wrapper.
@@ -17,17 +19,33 @@ type Cache struct {
 	client Client
 }
 
-// New creates a new Cache.
-func New(client Client) *Cache {
-	client.AddHook(LoggerHook{})
-	client.AddHook(NewRelicHook{})
+// New creates a new Cache that logs every call with the given LoggerHook. Any extra hooks, such as a
+// MetricsHook, are added after the default ones.
+func New(client Client, log LoggerHook, hooks ...redis.Hook) *Cache {
+	client.AddHook(log)
+	client.AddHook(InstrumentationHook{})
+	client.AddHook(TracingHook{})
+
+	for _, h := range hooks {
+		client.AddHook(h)
+	}
 
 	return &Cache{
 		client: client,
 	}
 }
 
-// GetValue retrieves the value from redis.
+// Key returns the redis key for k in the tenant on the context, prefixed with tenant:<tenant>:, so
+// tenants cannot read each other's keys. Without a tenant, k is returned as is.
+func Key(ctx context.Context, k string) string {
+	if tenant, ok := identity.TenantFromContext(ctx); ok {
+		return "tenant:" + tenant + ":" + k
+	}
+
+	return k
+}
+
+// GetValue retrieves the value for the tenant on the context from redis.
 func (c *Cache) GetValue(ctx context.Context) (string, error) {
-	return c.client.WithContext(ctx).Get("value").Result()
+	return c.client.WithContext(ctx).Get(Key(ctx, "value")).Result()
 }
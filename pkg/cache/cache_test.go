@@ -0,0 +1,35 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/pkg/cache"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestKey(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Equal(t, "value", cache.Key(ctx, "value"))
+	assert.Equal(t, "tenant:acme:value", cache.Key(identity.WithTenant(ctx, "acme"), "value"))
+}
+
+func TestKeys(t *testing.T) {
+	for _, tt := range []struct {
+		key, want string
+	}{
+		{cache.APIKeyKey("k1"), "apikey:k1"},
+		{cache.APIKeyLastUsedKey("k1"), "apikey:k1:last_used"},
+		{cache.RefreshKey("r1"), "refresh:r1"},
+		{cache.RefreshUsedKey("r1"), "refresh:r1:used"},
+		{cache.RefreshFamilyKey("f1"), "refresh_family:f1"},
+		{cache.RevokedKey("j1"), "revoked:j1"},
+		{cache.SessionKey("s1"), "session:s1"},
+		{cache.UserSessionsKey("user-1"), "user_sessions:user-1"},
+	} {
+		assert.Equal(t, tt.want, tt.key)
+	}
+}
@@ -0,0 +1,14 @@
+package cache
+
+// Exported for the tests of the redis keys and values, which other services may depend on.
+var (
+	DecodeAPIKey      = decodeAPIKey
+	APIKeyKey         = apiKeyKey
+	APIKeyLastUsedKey = apiKeyLastUsedKey
+	RefreshKey        = refreshKey
+	RefreshUsedKey    = refreshUsedKey
+	RefreshFamilyKey  = refreshFamilyKey
+	RevokedKey        = revokedKey
+	SessionKey        = sessionKey
+	UserSessionsKey   = userSessionsKey
+)
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+)
+
+var (
+	segmentKey = contextKey("segment")
+)
+
+// InstrumentationHook is used to instrument all calls to redis using a datastore segment on the
+// transaction in the context.
+type InstrumentationHook struct {
+}
+
+// BeforeProcess is called before the call to redis for a single command.
+func (h InstrumentationHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	s := instrumentation.FromContext(ctx).StartDatastoreSegment(instrumentation.Datastore{
+		Product:   instrumentation.DatastoreRedis,
+		Operation: cmd.Name(),
+	})
+
+	ctx = context.WithValue(ctx, segmentKey, s)
+
+	return ctx, nil
+}
+
+// AfterProcess is called after the call to redis for a single command.
+func (h InstrumentationHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if s, ok := ctx.Value(segmentKey).(instrumentation.Segment); ok {
+		s.End()
+	}
+
+	return nil
+}
+
+// BeforeProcessPipeline is called before the call to redis for a group of pipelined commands.
+func (h InstrumentationHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	var cmd []string
+
+	for _, c := range cmds {
+		cmd = append(cmd, c.Name())
+	}
+
+	s := instrumentation.FromContext(ctx).StartDatastoreSegment(instrumentation.Datastore{
+		Product:   instrumentation.DatastoreRedis,
+		Operation: strings.Join(cmd, " "),
+	})
+
+	ctx = context.WithValue(ctx, segmentKey, s)
+
+	return ctx, nil
+}
+
+// AfterProcessPipeline is called after the call to redis for a group of pipelined commands.
+func (h InstrumentationHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if s, ok := ctx.Value(segmentKey).(instrumentation.Segment); ok {
+		s.End()
+	}
+
+	return nil
+}
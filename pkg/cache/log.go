@@ -2,94 +2,111 @@ package cache
 
 import (
 	"context"
-	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v7"
-	"github.com/rickbassham/example-go/pkg/logging"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/redact"
+)
+
+var (
+	logStartKey = contextKey("log_start")
 )
 
-// LoggerHook is used to log all calls to redis.
+// LoggerHook is used to log all calls to redis, with a logger named cache. Arguments are masked with
+// the redaction policy on the context; see redact.FromContext. Each completed call is logged with its
+// duration, at the level chosen by the Slow thresholds. A failed call is logged at error with the
+// error, which is also noticed on the transaction in the context. A missing key is not a failure.
 type LoggerHook struct {
+	Slow logging.SlowThresholds
 }
 
 // BeforeProcess is called before the call to redis for a single command.
 func (h LoggerHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
-	l := logging.FromContext(ctx)
+	l := logging.FromContext(ctx).Named("cache")
 
-	var full []string
+	l.Info("starting redis call", zap.String("cmd", formatCmd(ctx, cmd)))
 
-	full = append(full, cmd.Name())
-
-	for _, arg := range cmd.Args()[1:] {
-		full = append(full, fmt.Sprintf("%#v", arg))
-	}
-
-	l.Info("starting redis call", zap.String("cmd", strings.Join(full, " ")))
-
-	return ctx, nil
+	return context.WithValue(ctx, logStartKey, time.Now()), nil
 }
 
 // AfterProcess is called after the call to redis for a single command.
 func (h LoggerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
-	l := logging.FromContext(ctx)
-
-	var full []string
-
-	full = append(full, cmd.Name())
-
-	for _, arg := range cmd.Args()[1:] {
-		full = append(full, fmt.Sprintf("%#v", arg))
-	}
-
-	l.Info("redis call complete", zap.String("cmd", strings.Join(full, " ")))
+	h.complete(ctx, zap.String("cmd", formatCmd(ctx, cmd)), cmd.Err())
 
 	return nil
 }
 
 // BeforeProcessPipeline is called before the call to redis for a group of pipelined commands.
 func (h LoggerHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
-	l := logging.FromContext(ctx)
+	l := logging.FromContext(ctx).Named("cache")
 
-	var p []string
+	l.Info("starting redis call", zap.String("cmds", formatCmds(ctx, cmds)))
 
-	for _, cmd := range cmds {
-		var full []string
+	return context.WithValue(ctx, logStartKey, time.Now()), nil
+}
 
-		full = append(full, cmd.Name())
+// AfterProcessPipeline is called after the call to redis for a group of pipelined commands. The
+// pipeline failed if any of its commands did.
+func (h LoggerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
 
-		for _, arg := range cmd.Args()[1:] {
-			full = append(full, fmt.Sprintf("%#v", arg))
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
 		}
-
-		p = append(p, strings.Join(full, " "))
 	}
 
-	l.Info("starting redis call", zap.String("cmds", strings.Join(p, "\n")))
+	h.complete(ctx, zap.String("cmds", formatCmds(ctx, cmds)), err)
 
-	return ctx, nil
+	return nil
 }
 
-// AfterProcessPipeline is called after the call to redis for a group of pipelined commands.
-func (h LoggerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
-	l := logging.FromContext(ctx)
+func (h LoggerHook) complete(ctx context.Context, cmd zap.Field, err error) {
+	l := logging.FromContext(ctx).Named("cache")
 
-	var p []string
+	fields := []zap.Field{cmd}
+	level := zapcore.InfoLevel
 
-	for _, cmd := range cmds {
-		var full []string
+	if start, ok := ctx.Value(logStartKey).(time.Time); ok {
+		d := time.Since(start)
+		level = h.Slow.Level(d)
 
-		full = append(full, cmd.Name())
+		fields = append(fields, zap.Duration("duration", d), zap.Bool("slow", h.Slow.IsSlow(d)))
+	}
 
-		for _, arg := range cmd.Args()[1:] {
-			full = append(full, fmt.Sprintf("%#v", arg))
-		}
+	if err != nil && err != redis.Nil {
+		level = zapcore.ErrorLevel
+		fields = append(fields, zap.Error(err))
+
+		instrumentation.FromContext(ctx).NoticeError(err)
+	}
 
-		p = append(p, strings.Join(full, " "))
+	if ce := l.Check(level, "redis call complete"); ce != nil {
+		ce.Write(fields...)
 	}
+}
 
-	l.Info("redis call complete", zap.String("cmds", strings.Join(p, "\n")))
+// formatCmd formats the command and its masked arguments.
+func formatCmd(ctx context.Context, cmd redis.Cmder) string {
+	full := []string{cmd.Name()}
+	full = append(full, redact.FromContext(ctx).Args(cmd.Args()[1:])...)
 
-	return nil
+	return strings.Join(full, " ")
+}
+
+func formatCmds(ctx context.Context, cmds []redis.Cmder) string {
+	var p []string
+
+	for _, cmd := range cmds {
+		p = append(p, formatCmd(ctx, cmd))
+	}
+
+	return strings.Join(p, "\n")
 }
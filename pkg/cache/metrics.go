@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+
+	"github.com/rickbassham/example-go/pkg/metrics"
+)
+
+var (
+	startKey = contextKey("start")
+)
+
+// MetricsHook is used to record the latency and errors of all calls to redis. Create it with
+// NewMetricsHook.
+type MetricsHook struct {
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+// NewMetricsHook registers the redis metrics in the registry.
+func NewMetricsHook(reg *metrics.Registry) MetricsHook {
+	return MetricsHook{
+		duration: reg.NewHistogramVec("redis_command_duration_seconds",
+			"Latency of redis commands.", nil, "command"),
+		errors: reg.NewCounterVec("redis_command_errors_total",
+			"Number of redis commands that failed. A missing key is not a failure.", "command"),
+	}
+}
+
+// BeforeProcess is called before the call to redis for a single command.
+func (h MetricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey, time.Now()), nil
+}
+
+// AfterProcess is called after the call to redis for a single command.
+func (h MetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.observe(ctx, cmd.Name(), cmd.Err())
+
+	return nil
+}
+
+// BeforeProcessPipeline is called before the call to redis for a group of pipelined commands.
+func (h MetricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey, time.Now()), nil
+}
+
+// AfterProcessPipeline is called after the call to redis for a group of pipelined commands. The
+// whole pipeline is recorded as a single "pipeline" command.
+func (h MetricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+
+	h.observe(ctx, "pipeline", err)
+
+	return nil
+}
+
+func (h MetricsHook) observe(ctx context.Context, command string, err error) {
+	if start, ok := ctx.Value(startKey).(time.Time); ok {
+		h.duration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	}
+
+	if err != nil && err != redis.Nil {
+		h.errors.WithLabelValues(command).Inc()
+	}
+}
@@ -0,0 +1,351 @@
+package cache_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/cache"
+)
+
+// fakeRedis is an in-process redis server that understands the few commands the stores use, so they
+// can be tested against a real redis.Client.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	values  map[string]string
+	sets    map[string]map[string]bool
+	expires map[string]time.Time
+}
+
+// newTestCache starts a fakeRedis, and returns a Cache connected to it. Call the returned func to
+// stop it.
+func newTestCache(t *testing.T) (*cache.Cache, *fakeRedis, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeRedis{
+		ln:      ln,
+		values:  map[string]string{},
+		sets:    map[string]map[string]bool{},
+		expires: map[string]time.Time{},
+	}
+
+	go s.serve()
+
+	client := redis.NewClient(&redis.Options{Addr: ln.Addr().String()})
+
+	return cache.New(client, cache.LoggerHook{}), s, func() {
+		client.Close() // nolint
+		ln.Close()     // nolint
+	}
+}
+
+// exists returns true if the key is set, as a value or a set.
+func (s *fakeRedis) exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(key)
+
+	_, value := s.values[key]
+	_, set := s.sets[key]
+
+	return value || set
+}
+
+// ttl returns how long the key has left to live, or zero if it does not expire.
+func (s *fakeRedis) ttl(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at, ok := s.expires[key]; ok {
+		return time.Until(at)
+	}
+
+	return 0
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close() // nolint
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	var queued [][]string
+
+	multi := false
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch name := strings.ToLower(args[0]); {
+		case name == "multi":
+			multi = true
+			w.WriteString("+OK\r\n") // nolint
+		case name == "exec":
+			w.WriteString("*" + strconv.Itoa(len(queued)) + "\r\n") // nolint
+
+			for _, q := range queued {
+				w.WriteString(s.do(q)) // nolint
+			}
+
+			multi, queued = false, nil
+		case multi:
+			queued = append(queued, args)
+			w.WriteString("+QUEUED\r\n") // nolint
+		default:
+			w.WriteString(s.do(args)) // nolint
+		}
+
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(b[:size])
+	}
+
+	return args, nil
+}
+
+func bulk(v string) string {
+	return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+}
+
+func integer(n int) string {
+	return ":" + strconv.Itoa(n) + "\r\n"
+}
+
+const nilReply = "$-1\r\n"
+
+// expire removes the key if it has expired. The lock must be held.
+func (s *fakeRedis) expire(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		delete(s.values, key)
+		delete(s.sets, key)
+		delete(s.expires, key)
+	}
+}
+
+// do runs the command, and returns its reply.
+func (s *fakeRedis) do(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range args[1:] {
+		s.expire(key)
+	}
+
+	has := func(key string) bool {
+		_, value := s.values[key]
+		_, set := s.sets[key]
+
+		return value || set
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "ping":
+		return "+PONG\r\n"
+	case "get":
+		if v, ok := s.values[args[1]]; ok {
+			return bulk(v)
+		}
+
+		return nilReply
+	case "mget":
+		reply := "*" + strconv.Itoa(len(args)-1) + "\r\n"
+
+		for _, key := range args[1:] {
+			if v, ok := s.values[key]; ok {
+				reply += bulk(v)
+			} else {
+				reply += nilReply
+			}
+		}
+
+		return reply
+	case "set":
+		key, value := args[1], args[2]
+
+		var ttl time.Duration
+
+		for i := 3; i < len(args); i++ {
+			switch strings.ToLower(args[i]) {
+			case "ex", "px":
+				n, _ := strconv.Atoi(args[i+1])
+
+				ttl = time.Duration(n) * time.Second
+				if strings.ToLower(args[i]) == "px" {
+					ttl = time.Duration(n) * time.Millisecond
+				}
+
+				i++
+			case "nx":
+				if has(key) {
+					return nilReply
+				}
+			case "xx":
+				if !has(key) {
+					return nilReply
+				}
+			}
+		}
+
+		s.values[key] = value
+		delete(s.expires, key)
+
+		if ttl > 0 {
+			s.expires[key] = time.Now().Add(ttl)
+		}
+
+		return "+OK\r\n"
+	case "setnx":
+		if has(args[1]) {
+			return integer(0)
+		}
+
+		s.values[args[1]] = args[2]
+
+		return integer(1)
+	case "del", "exists":
+		n := 0
+
+		for _, key := range args[1:] {
+			if has(key) {
+				n++
+
+				if strings.ToLower(args[0]) == "del" {
+					delete(s.values, key)
+					delete(s.sets, key)
+					delete(s.expires, key)
+				}
+			}
+		}
+
+		return integer(n)
+	case "sadd":
+		set, ok := s.sets[args[1]]
+		if !ok {
+			set = map[string]bool{}
+			s.sets[args[1]] = set
+		}
+
+		n := 0
+
+		for _, m := range args[2:] {
+			if !set[m] {
+				set[m] = true
+				n++
+			}
+		}
+
+		return integer(n)
+	case "srem":
+		n := 0
+
+		for _, m := range args[2:] {
+			if s.sets[args[1]][m] {
+				delete(s.sets[args[1]], m)
+				n++
+			}
+		}
+
+		return integer(n)
+	case "smembers":
+		set := s.sets[args[1]]
+		reply := "*" + strconv.Itoa(len(set)) + "\r\n"
+
+		for m := range set {
+			reply += bulk(m)
+		}
+
+		return reply
+	case "expire", "expireat":
+		if !has(args[1]) {
+			return integer(0)
+		}
+
+		n, _ := strconv.ParseInt(args[2], 10, 64)
+
+		if strings.ToLower(args[0]) == "expire" {
+			s.expires[args[1]] = time.Now().Add(time.Duration(n) * time.Second)
+		} else {
+			s.expires[args[1]] = time.Unix(n, 0)
+		}
+
+		return integer(1)
+	case "ttl":
+		if !has(args[1]) {
+			return integer(-2)
+		}
+
+		at, ok := s.expires[args[1]]
+		if !ok {
+			return integer(-1)
+		}
+
+		return integer(int(time.Until(at).Seconds()))
+	}
+
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
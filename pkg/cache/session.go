@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(subject string) string {
+	return "user_sessions:" + subject
+}
+
+// SessionStore is an auth.SessionStore kept in redis. Each session is stored as JSON until it ends,
+// with the ids of the sessions of each user in a set for listing. Sessions are looked up by their
+// cookie before the tenant is checked, so their redis keys are not prefixed; auth.Sessions filters
+// them by the tenant of their principal.
+type SessionStore struct {
+	c *Cache
+}
+
+// NewSessionStore creates a new SessionStore using the cache.
+func NewSessionStore(c *Cache) *SessionStore {
+	return &SessionStore{c: c}
+}
+
+// Save stores the session, replacing it if it exists, until the ttl has passed.
+func (s *SessionStore) Save(ctx context.Context, sess auth.Session, ttl time.Duration) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	client := s.c.client.WithContext(ctx)
+	user := userSessionsKey(sess.Principal.ID())
+
+	_, err = client.TxPipelined(func(p redis.Pipeliner) error {
+		p.Set(sessionKey(sess.ID), b, ttl)
+		p.SAdd(user, sess.ID)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The set lives as long as the longest session in it could, so it is only ever extended.
+	remaining, err := client.TTL(user).Result()
+	if err != nil {
+		return err
+	}
+
+	if remaining < time.Until(sess.ExpiresAt) {
+		return client.ExpireAt(user, sess.ExpiresAt).Err()
+	}
+
+	return nil
+}
+
+// Get returns the session with the id, or auth.ErrSessionNotFound.
+func (s *SessionStore) Get(ctx context.Context, id string) (auth.Session, error) {
+	var sess auth.Session
+
+	b, err := s.c.client.WithContext(ctx).Get(sessionKey(id)).Bytes()
+	if err == redis.Nil {
+		return sess, auth.ErrSessionNotFound
+	} else if err != nil {
+		return sess, err
+	}
+
+	err = json.Unmarshal(b, &sess)
+
+	return sess, err
+}
+
+// List returns the sessions of the subject. Sessions that ended are removed from the set as they
+// are found.
+func (s *SessionStore) List(ctx context.Context, subject string) ([]auth.Session, error) {
+	client := s.c.client.WithContext(ctx)
+
+	ids, err := client.SMembers(userSessionsKey(subject)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]auth.Session, 0, len(ids))
+
+	for _, id := range ids {
+		sess, err := s.Get(ctx, id)
+		if err == auth.ErrSessionNotFound {
+			client.SRem(userSessionsKey(subject), id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, sess)
+	}
+
+	return sessions, nil
+}
+
+// Delete removes the session.
+func (s *SessionStore) Delete(ctx context.Context, sess auth.Session) error {
+	_, err := s.c.client.WithContext(ctx).TxPipelined(func(p redis.Pipeliner) error {
+		p.Del(sessionKey(sess.ID))
+		p.SRem(userSessionsKey(sess.Principal.ID()), sess.ID)
+
+		return nil
+	})
+
+	return err
+}
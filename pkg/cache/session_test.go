@@ -0,0 +1,53 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/cache"
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestSessionStore(t *testing.T) {
+	c, server, stop := newTestCache(t)
+	defer stop()
+
+	ctx := context.Background()
+	s := cache.NewSessionStore(c)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	p := identity.Principal{Subject: "user-1", AuthMethod: identity.AuthMethodSession}
+
+	short := auth.Session{ID: "s1", Principal: p, CSRFToken: "csrf", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	long := auth.Session{ID: "s2", Principal: p, CreatedAt: now, ExpiresAt: now.Add(2 * time.Hour)}
+
+	require.NoError(t, s.Save(ctx, long, 30*time.Minute))
+	require.NoError(t, s.Save(ctx, short, 30*time.Minute))
+
+	got, err := s.Get(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, short.CSRFToken, got.CSRFToken)
+	assert.Equal(t, p, got.Principal)
+
+	// The set of the user's sessions lives as long as the longest of them.
+	assert.InDelta(t, (2 * time.Hour).Seconds(), server.ttl(cache.UserSessionsKey(p.ID())).Seconds(), 5)
+
+	sessions, err := s.List(ctx, p.ID())
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	require.NoError(t, s.Delete(ctx, short))
+
+	_, err = s.Get(ctx, "s1")
+	assert.Equal(t, auth.ErrSessionNotFound, err)
+
+	sessions, err = s.List(ctx, p.ID())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "s2", sessions[0].ID)
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func refreshKey(id string) string {
+	return "refresh:" + id
+}
+
+func refreshUsedKey(id string) string {
+	return "refresh:" + id + ":used"
+}
+
+func refreshFamilyKey(family string) string {
+	return "refresh_family:" + family
+}
+
+func revokedKey(jti string) string {
+	return "revoked:" + jti
+}
+
+// TokenStore keeps refresh tokens and revoked access tokens in redis, until they expire. It is an
+// auth.RefreshStore and an auth.RevocationList. Its redis keys are not prefixed with the tenant:
+// tokens are looked up before their tenant is checked, and their ids are random.
+type TokenStore struct {
+	c *Cache
+}
+
+// NewTokenStore creates a new TokenStore using the cache.
+func NewTokenStore(c *Cache) *TokenStore {
+	return &TokenStore{c: c}
+}
+
+// Save stores a new refresh token, and adds it to its family.
+func (s *TokenStore) Save(ctx context.Context, t auth.RefreshToken) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(t.ExpiresAt)
+
+	_, err = s.c.client.WithContext(ctx).TxPipelined(func(p redis.Pipeliner) error {
+		p.Set(refreshKey(t.ID), b, ttl)
+		p.SAdd(refreshFamilyKey(t.Family), t.ID)
+		p.Expire(refreshFamilyKey(t.Family), ttl)
+
+		return nil
+	})
+
+	return err
+}
+
+// Use marks the refresh token with the id as used, and returns it as it was before. Only the first
+// call for a token sees it unused.
+func (s *TokenStore) Use(ctx context.Context, id string) (auth.RefreshToken, error) {
+	client := s.c.client.WithContext(ctx)
+
+	var t auth.RefreshToken
+
+	b, err := client.Get(refreshKey(id)).Bytes()
+	if err == redis.Nil {
+		return t, auth.ErrRefreshTokenNotFound
+	} else if err != nil {
+		return t, err
+	}
+
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, err
+	}
+
+	first, err := client.SetNX(refreshUsedKey(id), 1, time.Until(t.ExpiresAt)).Result()
+	if err != nil {
+		return t, err
+	}
+
+	t.Used = !first
+
+	return t, nil
+}
+
+// RevokeFamily removes every refresh token in the family.
+func (s *TokenStore) RevokeFamily(ctx context.Context, family string) error {
+	client := s.c.client.WithContext(ctx)
+
+	ids, err := client.SMembers(refreshFamilyKey(family)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{refreshFamilyKey(family)}
+	for _, id := range ids {
+		keys = append(keys, refreshKey(id))
+	}
+
+	return client.Del(keys...).Err()
+}
+
+// Revoke revokes the access token with the jti until the time it expires.
+func (s *TokenStore) Revoke(ctx context.Context, jti string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.c.client.WithContext(ctx).Set(revokedKey(jti), 1, ttl).Err()
+}
+
+// IsRevoked returns true if the access token with the jti has been revoked.
+func (s *TokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.c.client.WithContext(ctx).Exists(revokedKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
@@ -0,0 +1,93 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+	"github.com/rickbassham/example-go/pkg/cache"
+)
+
+func TestTokenStore_Use(t *testing.T) {
+	c, server, stop := newTestCache(t)
+	defer stop()
+
+	ctx := context.Background()
+	s := cache.NewTokenStore(c)
+
+	saved := auth.RefreshToken{
+		ID:        "r1",
+		Family:    "f1",
+		Subject:   "user-1",
+		Scopes:    []string{"read"},
+		Tenant:    "acme",
+		ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+
+	require.NoError(t, s.Save(ctx, saved))
+
+	// Only the first use sees the token unused, so a replayed token is detected.
+	first, err := s.Use(ctx, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, saved, first)
+
+	second, err := s.Use(ctx, "r1")
+	require.NoError(t, err)
+	assert.True(t, second.Used)
+
+	assert.InDelta(t, time.Hour.Seconds(), server.ttl(cache.RefreshUsedKey("r1")).Seconds(), 5)
+
+	_, err = s.Use(ctx, "missing")
+	assert.Equal(t, auth.ErrRefreshTokenNotFound, err)
+}
+
+func TestTokenStore_RevokeFamily(t *testing.T) {
+	c, server, stop := newTestCache(t)
+	defer stop()
+
+	ctx := context.Background()
+	s := cache.NewTokenStore(c)
+
+	expires := time.Now().Add(time.Hour)
+
+	require.NoError(t, s.Save(ctx, auth.RefreshToken{ID: "r1", Family: "f1", ExpiresAt: expires}))
+	require.NoError(t, s.Save(ctx, auth.RefreshToken{ID: "r2", Family: "f1", ExpiresAt: expires}))
+	require.NoError(t, s.Save(ctx, auth.RefreshToken{ID: "r3", Family: "f2", ExpiresAt: expires}))
+
+	require.NoError(t, s.RevokeFamily(ctx, "f1"))
+
+	for _, id := range []string{"r1", "r2"} {
+		_, err := s.Use(ctx, id)
+		assert.Equal(t, auth.ErrRefreshTokenNotFound, err, id)
+	}
+
+	assert.False(t, server.exists(cache.RefreshFamilyKey("f1")))
+
+	_, err := s.Use(ctx, "r3")
+	assert.NoError(t, err)
+}
+
+func TestTokenStore_Revoke(t *testing.T) {
+	c, _, stop := newTestCache(t)
+	defer stop()
+
+	ctx := context.Background()
+	s := cache.NewTokenStore(c)
+
+	require.NoError(t, s.Revoke(ctx, "j1", time.Now().Add(time.Hour)))
+
+	// A token that already expired does not need revoking.
+	require.NoError(t, s.Revoke(ctx, "j2", time.Now().Add(-time.Hour)))
+
+	revoked, err := s.IsRevoked(ctx, "j1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = s.IsRevoked(ctx, "j2")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
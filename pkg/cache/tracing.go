@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// TracingHook is used to record a span for all calls to redis, using the tracer on the context.
+type TracingHook struct {
+}
+
+// BeforeProcess is called before the call to redis for a single command.
+func (h TracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, s := tracing.StartSpan(ctx, "redis "+cmd.Name(), tracing.SpanKindClient)
+
+	s.SetAttribute("db.system", "redis")
+	s.SetAttribute("db.operation", cmd.Name())
+
+	return ctx, nil
+}
+
+// AfterProcess is called after the call to redis for a single command.
+func (h TracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	s := tracing.SpanFromContext(ctx)
+
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		s.SetError(err)
+	}
+
+	s.End()
+
+	return nil
+}
+
+// BeforeProcessPipeline is called before the call to redis for a group of pipelined commands.
+func (h TracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	var cmd []string
+
+	for _, c := range cmds {
+		cmd = append(cmd, c.Name())
+	}
+
+	ctx, s := tracing.StartSpan(ctx, "redis pipeline", tracing.SpanKindClient)
+
+	s.SetAttribute("db.system", "redis")
+	s.SetAttribute("db.operation", strings.Join(cmd, " "))
+
+	return ctx, nil
+}
+
+// AfterProcessPipeline is called after the call to redis for a group of pipelined commands.
+func (h TracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	s := tracing.SpanFromContext(ctx)
+
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			s.SetError(err)
+			break
+		}
+	}
+
+	s.End()
+
+	return nil
+}
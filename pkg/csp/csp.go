@@ -0,0 +1,45 @@
+// Package csp generates Content-Security-Policy nonces, and parses the violation reports browsers
+// send when a policy blocks, or would block, something.
+package csp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// NoncePlaceholder is replaced in a policy by the nonce of the request, such as
+// script-src 'self' {nonce}.
+const NoncePlaceholder = "{nonce}"
+
+type contextKey int
+
+const nonceKey contextKey = iota
+
+// NewNonce returns a new random nonce, encoded as base64.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// WithNonce adds the nonce of the policy of the response to the context.
+func WithNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey, nonce)
+}
+
+// NonceFromContext returns the nonce of the policy of the response, for the nonce attribute of the
+// inline scripts and styles of a page, or an empty string if there is none.
+func NonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey).(string)
+	return nonce
+}
+
+// Policy returns the policy with the NoncePlaceholder replaced by the nonce.
+func Policy(policy, nonce string) string {
+	return strings.Replace(policy, NoncePlaceholder, "'nonce-"+nonce+"'", -1)
+}
@@ -0,0 +1,61 @@
+package csp_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/csp"
+)
+
+func TestNonce(t *testing.T) {
+	nonce, err := csp.NewNonce()
+	require.NoError(t, err)
+
+	assert.Len(t, nonce, 24)
+	assert.Equal(t, nonce, csp.NonceFromContext(csp.WithNonce(context.Background(), nonce)))
+	assert.Empty(t, csp.NonceFromContext(context.Background()))
+
+	assert.Equal(t, "script-src 'self' 'nonce-abc'", csp.Policy("script-src 'self' {nonce}", "abc"))
+}
+
+func TestParseReports(t *testing.T) {
+	violations, err := csp.ParseReports("application/csp-report", strings.NewReader(`{"csp-report":{
+		"document-uri":"https://example.com/page",
+		"blocked-uri":"https://evil.com/x.js",
+		"violated-directive":"script-src-elem",
+		"disposition":"report",
+		"line-number":12
+	}}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []csp.Violation{{
+		DocumentURI:        "https://example.com/page",
+		BlockedURI:         "https://evil.com/x.js",
+		EffectiveDirective: "script-src-elem",
+		Disposition:        "report",
+		LineNumber:         12,
+	}}, violations)
+
+	violations, err = csp.ParseReports("application/reports+json; charset=utf-8", strings.NewReader(`[
+		{"type":"deprecation","body":{}},
+		{"type":"csp-violation","body":{"documentURL":"https://example.com/","blockedURL":"inline","effectiveDirective":"style-src","disposition":"enforce"}}
+	]`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []csp.Violation{{
+		DocumentURI:        "https://example.com/",
+		BlockedURI:         "inline",
+		EffectiveDirective: "style-src",
+		Disposition:        "enforce",
+	}}, violations)
+
+	_, err = csp.ParseReports("text/plain", strings.NewReader(`hello`))
+	assert.Equal(t, csp.ErrUnsupportedReport, err)
+
+	_, err = csp.ParseReports("application/csp-report", strings.NewReader(`{`))
+	assert.Error(t, err)
+}
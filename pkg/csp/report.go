@@ -0,0 +1,142 @@
+package csp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+)
+
+// MaxReportBytes is the largest report body read by ParseReports.
+const MaxReportBytes = 64 << 10
+
+// ErrUnsupportedReport is returned by ParseReports for a content type that is not a report.
+var ErrUnsupportedReport = errors.New("unsupported report content type")
+
+// Violation is a violation of a policy, as reported by a browser.
+type Violation struct {
+	DocumentURI        string `json:"document_uri"`
+	Referrer           string `json:"referrer,omitempty"`
+	BlockedURI         string `json:"blocked_uri"`
+	EffectiveDirective string `json:"effective_directive"`
+	OriginalPolicy     string `json:"original_policy,omitempty"`
+	// Disposition is enforce if the violation was blocked, or report if the policy is report-only.
+	Disposition  string `json:"disposition,omitempty"`
+	SourceFile   string `json:"source_file,omitempty"`
+	LineNumber   int    `json:"line_number,omitempty"`
+	ColumnNumber int    `json:"column_number,omitempty"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	Sample       string `json:"sample,omitempty"`
+}
+
+// legacyReport is the body of a report sent to a report-uri, as application/csp-report.
+type legacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		StatusCode         int    `json:"status-code"`
+		ScriptSample       string `json:"script-sample"`
+	} `json:"csp-report"`
+}
+
+// report is one of the reports sent to a report-to endpoint by the Reporting API, as
+// application/reports+json.
+type report struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		StatusCode         int    `json:"statusCode"`
+		Sample             string `json:"sample"`
+	} `json:"body"`
+}
+
+// ParseReports reads the violations from a report body of the content type, either
+// application/csp-report, sent to a report-uri, or application/reports+json, sent by the Reporting
+// API to a report-to endpoint. Reports of other types, such as deprecations, are skipped. At most
+// MaxReportBytes of the body are read.
+func ParseReports(contentType string, body io.Reader) ([]Violation, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedReport
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(body, MaxReportBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case "application/csp-report", "application/json":
+		var r legacyReport
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+
+		directive := r.Report.EffectiveDirective
+		if directive == "" {
+			directive = r.Report.ViolatedDirective
+		}
+
+		return []Violation{{
+			DocumentURI:        r.Report.DocumentURI,
+			Referrer:           r.Report.Referrer,
+			BlockedURI:         r.Report.BlockedURI,
+			EffectiveDirective: directive,
+			OriginalPolicy:     r.Report.OriginalPolicy,
+			Disposition:        r.Report.Disposition,
+			SourceFile:         r.Report.SourceFile,
+			LineNumber:         r.Report.LineNumber,
+			ColumnNumber:       r.Report.ColumnNumber,
+			StatusCode:         r.Report.StatusCode,
+			Sample:             r.Report.ScriptSample,
+		}}, nil
+	case "application/reports+json":
+		var reports []report
+		if err := json.Unmarshal(b, &reports); err != nil {
+			return nil, err
+		}
+
+		violations := []Violation{}
+
+		for _, r := range reports {
+			if r.Type != "csp-violation" {
+				continue
+			}
+
+			violations = append(violations, Violation{
+				DocumentURI:        r.Body.DocumentURL,
+				Referrer:           r.Body.Referrer,
+				BlockedURI:         r.Body.BlockedURL,
+				EffectiveDirective: r.Body.EffectiveDirective,
+				OriginalPolicy:     r.Body.OriginalPolicy,
+				Disposition:        r.Body.Disposition,
+				SourceFile:         r.Body.SourceFile,
+				LineNumber:         r.Body.LineNumber,
+				ColumnNumber:       r.Body.ColumnNumber,
+				StatusCode:         r.Body.StatusCode,
+				Sample:             r.Body.Sample,
+			})
+		}
+
+		return violations, nil
+	default:
+		return nil, ErrUnsupportedReport
+	}
+}
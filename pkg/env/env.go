@@ -1,9 +1,10 @@
 package env
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
-
-	"github.com/caarlos0/env"
 )
 
 // Config represents the common environment variables needed for all apps.
@@ -14,10 +15,84 @@ type Config struct {
 	BuildDate       time.Time `env:"BUILD_DATE"`
 	BuildGitHash    string    `env:"BUILD_GIT_HASH,required"`
 	BuildGitTag     string    `env:"BUILD_GIT_TAG,required"`
-	NewRelicLicense string    `env:"NEW_RELIC_LICENSE,required"`
+	NewRelicLicense string    `env:"NEW_RELIC_LICENSE" secret:"true"`
+	// LogLevel is the base log level, such as debug or info. It can be changed at runtime, and is
+	// reloaded; see Reloader.
+	LogLevel string `env:"LOG_LEVEL" envDefault:"info" reload:"true"`
+	// LogOutputs are where logs are written, side by side: stdout, file and syslog. Stdout is human
+	// readable when Environment is development, and JSON otherwise.
+	LogOutputs []string `env:"LOG_OUTPUTS" envSeparator:"," envDefault:"stdout"`
+	// LogFile is the file written by the file output. It is rotated once it reaches
+	// LogFileMaxSizeMB, and rotated files are removed after LogFileMaxAge or once there are more than
+	// LogFileMaxBackups of them. Zero means no limit.
+	LogFile           string        `env:"LOG_FILE"`
+	LogFileMaxSizeMB  int           `env:"LOG_FILE_MAX_SIZE_MB" envDefault:"100"`
+	LogFileMaxAge     time.Duration `env:"LOG_FILE_MAX_AGE" envDefault:"168h"`
+	LogFileMaxBackups int           `env:"LOG_FILE_MAX_BACKUPS" envDefault:"10"`
+	// LogAccessFile, if set, is where the "request complete" entry of each incoming request is
+	// written, instead of the other outputs. It is rotated like LogFile.
+	LogAccessFile string `env:"LOG_ACCESS_FILE"`
+	// LogAuditFile, if set, is where audit events are written, instead of stdout. It is rotated like
+	// LogFile.
+	LogAuditFile string `env:"LOG_AUDIT_FILE"`
+	// NewRelicConnectTimeout is how long to wait for New Relic to connect at startup. If zero, we
+	// don't wait.
+	NewRelicConnectTimeout time.Duration `env:"NEW_RELIC_CONNECT_TIMEOUT"`
+}
+
+// Redacted is the text shown in place of secret values.
+const Redacted = "[REDACTED]"
+
+// secretNames are the last words of an environment variable name that mark it as a secret, even if
+// its field is not tagged with secret:"true", such as REDIS_PASSWORD or NEW_RELIC_LICENSE_KEY, but
+// not TOKEN_ACCESS_TTL or REDACT_KEYS.
+var secretNames = []string{"SECRET", "PASSWORD", "TOKEN", "KEY"}
+
+// Value is the effective value of a variable, and where it came from; see Sources.
+type Value struct {
+	Value  string `json:"value"`
+	Source string `json:"source,omitempty"`
 }
 
-// Load will bind the environment variables to the given config.
-func Load(c interface{}) error {
-	return env.Parse(c)
+// Dump returns the effective value of every environment variable bound to the given config, keyed by
+// variable name, with the source of each value, so it can be shown to operators. Fields tagged with
+// secret:"true", or whose name ends like a secret, such as _PASSWORD, are replaced with Redacted
+// unless they are empty. Embedded and nested structs are included. The sources may be nil.
+func Dump(c interface{}, sources Sources) map[string]Value {
+	values := map[string]Value{}
+
+	v, err := structValue(c)
+	if err != nil {
+		return values
+	}
+
+	walk(v, func(f reflect.StructField, fv reflect.Value, name string) {
+		if !fv.CanInterface() {
+			return
+		}
+
+		value := fmt.Sprintf("%v", fv.Interface())
+
+		if value != "" && isSecret(f, name) {
+			value = Redacted
+		}
+
+		values[name] = Value{Value: value, Source: sources[name]}
+	})
+
+	return values
+}
+
+func isSecret(f reflect.StructField, name string) bool {
+	if f.Tag.Get("secret") == "true" {
+		return true
+	}
+
+	for _, s := range secretNames {
+		if name == s || strings.HasSuffix(name, "_"+s) {
+			return true
+		}
+	}
+
+	return false
 }
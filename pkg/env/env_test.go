@@ -0,0 +1,204 @@
+package env_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/env"
+)
+
+type testConfig struct {
+	env.Config
+	ListenAddress string        `env:"LISTEN_ADDRESS,required"`
+	JWTAuthSecret string        `env:"JWT_AUTH_SECRET"`
+	Origins       []string      `env:"ORIGINS" envSeparator:","`
+	Timeout       time.Duration `env:"TIMEOUT" envDefault:"5s"`
+	Workers       int           `env:"WORKERS" envDefault:"2"`
+	Debug         bool          `env:"DEBUG"`
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "env")
+	require.NoError(t, err)
+
+	return dir, func() { os.RemoveAll(dir) } // nolint
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+func lookup(vars map[string]string) env.Option {
+	return env.WithLookup(func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	})
+}
+
+var common = map[string]string{
+	"APP_NAME":       "my-app",
+	"TEAM_NAME":      "my-team",
+	"APP_ENV":        "test",
+	"BUILD_GIT_HASH": "abc123",
+	"BUILD_GIT_TAG":  "v1.0.0",
+}
+
+func TestLoad_Layers(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "LISTEN_ADDRESS: \":8080\"\nORIGINS:\n  - https://a.example.com\n  - https://b.example.com\nWORKERS: 4\nDEBUG: true\n")
+	writeFile(t, filepath.Join(dir, ".env"), "# local overrides\nexport WORKERS=8\nLOG_LEVEL=\"debug\" # comment\nNEW_RELIC_LICENSE='abc # def'\n")
+	writeFile(t, filepath.Join(dir, "jwt"), "s3cret\n")
+
+	vars := map[string]string{
+		"JWT_AUTH_SECRET_FILE": filepath.Join(dir, "jwt"),
+		"LISTEN_ADDRESS":       ":9090",
+	}
+	for k, v := range common {
+		vars[k] = v
+	}
+
+	var c testConfig
+
+	sources, err := env.Load(&c,
+		env.WithConfigFile(filepath.Join(dir, "config.yaml")),
+		env.WithEnvFiles(filepath.Join(dir, ".env"), filepath.Join(dir, "missing.env")),
+		lookup(vars),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "my-app", c.AppName)
+	assert.Equal(t, ":9090", c.ListenAddress)
+	assert.Equal(t, "s3cret", c.JWTAuthSecret)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, c.Origins)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Equal(t, 8, c.Workers)
+	assert.True(t, c.Debug)
+	assert.Equal(t, "debug", c.LogLevel)
+	assert.Equal(t, "abc # def", c.NewRelicLicense)
+
+	assert.Equal(t, env.SourceEnv, sources["APP_NAME"])
+	assert.Equal(t, env.SourceEnv, sources["LISTEN_ADDRESS"])
+	assert.Equal(t, "secret_file:"+filepath.Join(dir, "jwt"), sources["JWT_AUTH_SECRET"])
+	assert.Equal(t, "config_file:"+filepath.Join(dir, "config.yaml"), sources["ORIGINS"])
+	assert.Equal(t, "dotenv:"+filepath.Join(dir, ".env"), sources["WORKERS"])
+	assert.Equal(t, env.SourceDefault, sources["TIMEOUT"])
+	assert.NotContains(t, sources, "LOG_FILE")
+
+	dump := env.Dump(&c, sources)
+	assert.Equal(t, env.Value{Value: env.Redacted, Source: "secret_file:" + filepath.Join(dir, "jwt")}, dump["JWT_AUTH_SECRET"])
+	assert.Equal(t, env.Value{Value: env.Redacted, Source: "dotenv:" + filepath.Join(dir, ".env")}, dump["NEW_RELIC_LICENSE"])
+	assert.Equal(t, env.Value{Value: "my-app", Source: env.SourceEnv}, dump["APP_NAME"])
+	assert.Equal(t, env.Value{Value: ""}, dump["LOG_FILE"])
+}
+
+func TestLoad_JSON(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, "config.json"), `{"LISTEN_ADDRESS": ":8080", "TIMEOUT": "1m"}`)
+
+	var c testConfig
+
+	_, err := env.Load(&c, env.WithConfigFile(filepath.Join(dir, "config.json")), env.WithEnvFiles(), lookup(common))
+	require.NoError(t, err)
+
+	assert.Equal(t, ":8080", c.ListenAddress)
+	assert.Equal(t, time.Minute, c.Timeout)
+}
+
+type validatedConfig struct {
+	A string `env:"A"`
+	B string `env:"B"`
+}
+
+func (c validatedConfig) Validate() error {
+	if c.A == "" && c.B == "" {
+		return env.Errors{errors.New("either A or B is required")}
+	}
+
+	return nil
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "WORKERS: many\nLISTEN_ADRESS: \":8080\"\n")
+
+	vars := map[string]string{
+		"TIMEOUT":              "soon",
+		"JWT_AUTH_SECRET_FILE": filepath.Join(dir, "missing"),
+		"APP_NAME":             "my-app",
+	}
+
+	var c testConfig
+
+	_, err := env.Load(&c, env.WithConfigFile(filepath.Join(dir, "config.yaml")), env.WithEnvFiles(), lookup(vars))
+	require.Error(t, err)
+
+	var errs env.Errors
+	require.True(t, errors.As(err, &errs))
+
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+
+	assert.Contains(t, msgs, `required variable "TEAM_NAME" is not set`)
+	assert.Contains(t, msgs, `required variable "LISTEN_ADDRESS" is not set`)
+	assert.Contains(t, msgs, `unknown variable "LISTEN_ADRESS" in `+filepath.Join(dir, "config.yaml"))
+	assert.Contains(t, err.Error(), "invalid TIMEOUT from env")
+	assert.Contains(t, err.Error(), "invalid WORKERS from config_file:")
+	assert.Contains(t, err.Error(), "error reading JWT_AUTH_SECRET_FILE")
+
+	_, err = env.Load(&validatedConfig{}, env.WithEnvFiles(), lookup(nil))
+	assert.Equal(t, env.Errors{errors.New("either A or B is required")}, err)
+
+	_, err = env.Load(&validatedConfig{}, env.WithEnvFiles(), lookup(map[string]string{"A": "a"}))
+	assert.NoError(t, err)
+}
+
+func TestDump_SecretNames(t *testing.T) {
+	var c struct {
+		RedisPassword       string        `env:"REDIS_PASSWORD"`
+		LicenseKey          string        `env:"NEW_RELIC_LICENSE_KEY"`
+		Secret              string        `env:"SECRET"`
+		Tagged              string        `env:"SIGNING" secret:"true"`
+		TokenAccessTTL      time.Duration `env:"TOKEN_ACCESS_TTL"`
+		RedactKeys          []string      `env:"REDACT_KEYS"`
+		APIKeyTouchInterval time.Duration `env:"API_KEY_TOUCH_INTERVAL"`
+		AdminTLSKeyFile     string        `env:"ADMIN_TLS_KEY_FILE"`
+	}
+
+	_, err := env.Load(&c, lookup(map[string]string{
+		"REDIS_PASSWORD":         "p4ss",
+		"NEW_RELIC_LICENSE_KEY":  "l1cense",
+		"SECRET":                 "s3cret",
+		"SIGNING":                "k3y",
+		"TOKEN_ACCESS_TTL":       "15m",
+		"REDACT_KEYS":            "account,ssn",
+		"API_KEY_TOUCH_INTERVAL": "1m",
+		"ADMIN_TLS_KEY_FILE":     "/etc/tls/admin.key",
+	}))
+	require.NoError(t, err)
+
+	dump := env.Dump(&c, nil)
+
+	for _, name := range []string{"REDIS_PASSWORD", "NEW_RELIC_LICENSE_KEY", "SECRET", "SIGNING"} {
+		assert.Equal(t, env.Redacted, dump[name].Value, name)
+	}
+
+	assert.Equal(t, "15m0s", dump["TOKEN_ACCESS_TTL"].Value)
+	assert.Equal(t, "[account ssn]", dump["REDACT_KEYS"].Value)
+	assert.Equal(t, "1m0s", dump["API_KEY_TOUCH_INTERVAL"].Value)
+	assert.Equal(t, "/etc/tls/admin.key", dump["ADMIN_TLS_KEY_FILE"].Value)
+}
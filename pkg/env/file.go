@@ -0,0 +1,138 @@
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// readConfigFile reads the variables of a YAML or JSON config file, chosen by its extension.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	values := map[string]interface{}{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	case ".json":
+		err = json.Unmarshal(b, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: expected .yaml, .yml or .json", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	return values, nil
+}
+
+// fileString returns the value of a variable in a config file as it would be written in the
+// environment. Lists are joined with the separator of the field.
+func fileString(v interface{}, sep string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+
+		for _, item := range v {
+			s, err := fileString(item, sep)
+			if err != nil {
+				return "", err
+			}
+
+			parts = append(parts, s)
+		}
+
+		return strings.Join(parts, sep), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// readDotEnv reads the variables of a .env file: lines of NAME=value, optionally starting with
+// export. Blank lines and lines starting with # are skipped. Values may be quoted; escapes such as
+// \n are only expanded in double quotes. Unquoted values end at a # preceded by a space.
+func readDotEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() // nolint
+
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid line %d of %s: expected NAME=value", n, path)
+		}
+
+		value, err := dotEnvValue(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d of %s: %v", n, path, err)
+		}
+
+		values[strings.TrimSpace(kv[0])] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	return values, nil
+}
+
+func dotEnvValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+
+	switch v[0] {
+	case '"':
+		end := strings.LastIndex(v, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+
+		return strconv.Unquote(v[:end+1])
+	case '\'':
+		end := strings.LastIndex(v, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+
+		return v[1:end], nil
+	}
+
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+
+	return v, nil
+}
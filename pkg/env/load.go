@@ -0,0 +1,396 @@
+package env
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigFileVariable is the environment variable naming the config file read by Load, unless one is
+// given with WithConfigFile.
+const ConfigFileVariable = "CONFIG_FILE"
+
+// SecretFileSuffix is added to the name of a variable to read its value from a file instead, such as
+// JWT_AUTH_SECRET_FILE=/run/secrets/jwt, for secrets mounted into a container.
+const SecretFileSuffix = "_FILE"
+
+// The sources of values that are not files; see Sources.
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+)
+
+// Sources are where the value of each variable came from, keyed by variable name: SourceDefault,
+// SourceEnv, or the file it was read from, such as config_file:config.yaml, dotenv:.env or
+// secret_file:/run/secrets/jwt. Variables without a value are not included.
+type Sources map[string]string
+
+// Errors are every problem found by Load, such as missing or invalid variables, so they can all be
+// fixed at once.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Validator is implemented by configs that check their values once they are loaded, such as that
+// one of two variables is set. If Validate returns Errors, each of them is reported by Load.
+type Validator interface {
+	Validate() error
+}
+
+// Option configures the sources read by Load.
+type Option func(*options)
+
+type options struct {
+	configFile string
+	envFiles   []string
+	lookup     func(string) (string, bool)
+}
+
+// WithConfigFile reads the YAML or JSON file, chosen by its extension, of variable names and their
+// values, instead of the file named by ConfigFileVariable. Lists can be used for slices.
+func WithConfigFile(path string) Option {
+	return func(o *options) {
+		o.configFile = path
+	}
+}
+
+// WithEnvFiles reads the .env files, for local development, instead of .env. Later files override
+// earlier ones. Files that do not exist are skipped.
+func WithEnvFiles(paths ...string) Option {
+	return func(o *options) {
+		o.envFiles = paths
+	}
+}
+
+// WithLookup looks up environment variables with fn, instead of os.LookupEnv.
+func WithLookup(fn func(string) (string, bool)) Option {
+	return func(o *options) {
+		o.lookup = fn
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		envFiles: []string{".env"},
+		lookup:   os.LookupEnv,
+	}
+
+	for _, fn := range opts {
+		fn(&o)
+	}
+
+	if o.configFile == "" {
+		o.configFile, _ = o.lookup(ConfigFileVariable)
+	}
+
+	return o
+}
+
+// Load will bind the variables named by the env tags of the given config, including those of
+// embedded and nested structs, to their values. Each value is taken from the last of these sources
+// that has it:
+//
+//   - the envDefault tag of the field
+//   - the config file; see WithConfigFile
+//   - the .env files; see WithEnvFiles
+//   - the file named by the variable with SecretFileSuffix, such as JWT_AUTH_SECRET_FILE
+//   - the environment
+//
+// Fields tagged env:"NAME,required" must have a value from a source other than their default. Every
+// problem found, including those from Validate if the config is a Validator, is returned together
+// as Errors. The sources of the values are returned even if there are errors; see Dump.
+func Load(c interface{}, opts ...Option) (Sources, error) {
+	o := newOptions(opts)
+
+	v, err := structValue(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs Errors
+
+	var file map[string]interface{}
+
+	if o.configFile != "" {
+		file, err = readConfigFile(o.configFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	type dotenv struct {
+		path   string
+		values map[string]string
+	}
+
+	var dotenvs []dotenv
+
+	for _, path := range o.envFiles {
+		values, err := readDotEnv(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		dotenvs = append(dotenvs, dotenv{path: path, values: values})
+	}
+
+	// lookupEnv looks a variable up in the environment, then in the .env files.
+	lookupEnv := func(name string) (string, string, bool) {
+		if value, ok := o.lookup(name); ok {
+			return value, SourceEnv, true
+		}
+
+		for i := len(dotenvs) - 1; i >= 0; i-- {
+			if value, ok := dotenvs[i].values[name]; ok {
+				return value, "dotenv:" + dotenvs[i].path, true
+			}
+		}
+
+		return "", "", false
+	}
+
+	sources := Sources{}
+	known := map[string]bool{}
+
+	walk(v, func(f reflect.StructField, fv reflect.Value, name string) {
+		known[name] = true
+
+		if !fv.CanSet() {
+			return
+		}
+
+		var value, source string
+
+		if def, ok := f.Tag.Lookup("envDefault"); ok {
+			value, source = def, SourceDefault
+		}
+
+		if fileValue, ok := file[name]; ok {
+			s, err := fileString(fileValue, separator(f))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s in %s: %v", name, o.configFile, err))
+				return
+			}
+
+			value, source = s, "config_file:"+o.configFile
+		}
+
+		for _, d := range dotenvs {
+			if s, ok := d.values[name]; ok {
+				value, source = s, "dotenv:"+d.path
+			}
+		}
+
+		if path, _, ok := lookupEnv(name + SecretFileSuffix); ok && path != "" {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error reading %s%s: %v", name, SecretFileSuffix, err))
+				return
+			}
+
+			value, source = strings.TrimRight(string(b), "\r\n"), "secret_file:"+path
+		}
+
+		if s, ok := o.lookup(name); ok {
+			value, source = s, SourceEnv
+		}
+
+		if source == "" || source == SourceDefault {
+			if isRequired(f) {
+				errs = append(errs, fmt.Errorf("required variable %q is not set", name))
+				return
+			}
+		}
+
+		if source == "" {
+			return
+		}
+
+		sources[name] = source
+
+		if value == "" {
+			return
+		}
+
+		if err := setField(fv, f, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s from %s: %v", name, source, err))
+		}
+	})
+
+	for name := range file {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("unknown variable %q in %s", name, o.configFile))
+		}
+	}
+
+	if validator, ok := c.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var verrs Errors
+			if errors.As(err, &verrs) {
+				errs = append(errs, verrs...)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return sources, errs
+	}
+
+	return sources, nil
+}
+
+// structValue returns the struct c points to.
+func structValue(c interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(c)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, errors.New("config must be a non-nil pointer to a struct")
+		}
+
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return v, errors.New("config must be a non-nil pointer to a struct")
+	}
+
+	return v, nil
+}
+
+// walk calls fn for every field of the struct with an env tag, in order, including those of embedded
+// and nested structs.
+func walk(v reflect.Value, fn func(f reflect.StructField, fv reflect.Value, name string)) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+
+		name := strings.Split(f.Tag.Get("env"), ",")[0]
+
+		if name == "" {
+			if fv.Kind() == reflect.Struct {
+				walk(fv, fn)
+			}
+
+			continue
+		}
+
+		fn(f, fv, name)
+	}
+}
+
+func isRequired(f reflect.StructField) bool {
+	for _, opt := range strings.Split(f.Tag.Get("env"), ",")[1:] {
+		if opt == "required" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func separator(f reflect.StructField) string {
+	if sep := f.Tag.Get("envSeparator"); sep != "" {
+		return sep
+	}
+
+	return ","
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// setField parses the value into the field: strings, bools, numbers, durations, text unmarshalers
+// such as time.Time, and slices of them split by the envSeparator tag.
+func setField(fv reflect.Value, f reflect.StructField, value string) error {
+	if fv.Kind() == reflect.Slice {
+		parts := strings.Split(value, separator(f))
+		slice := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), part); err != nil {
+				return err
+			}
+		}
+
+		fv.Set(slice)
+
+		return nil
+	}
+
+	return setValue(fv, value)
+}
+
+func setValue(fv reflect.Value, value string) error {
+	if reflect.PtrTo(fv.Type()).Implements(textUnmarshaler) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+
+	return nil
+}
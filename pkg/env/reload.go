@@ -0,0 +1,278 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Change is a variable whose value changed when the config was reloaded. Secret values are
+// Redacted.
+type Change struct {
+	Name   string `json:"name"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Source string `json:"source,omitempty"`
+	// Restart is true if the variable can not be reloaded, so the change is not applied until the
+	// process is restarted; see Reloader.
+	Restart bool `json:"restart,omitempty"`
+}
+
+// Changes are the variables that changed when the config was reloaded.
+type Changes []Change
+
+// Has returns true if any of the variables changed.
+func (c Changes) Has(names ...string) bool {
+	for _, change := range c {
+		for _, name := range names {
+			if change.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Reloader reloads a config loaded by Load while the process is running, such as when it gets a
+// SIGHUP or the config file changes. Only the fields tagged reload:"true" are reloaded; changes to
+// any other field are logged as requiring a restart, and not applied. The new config is validated
+// before it is used, and swapped in atomically, so Current always returns a complete config. The
+// environment of a process can not change, so only the config file, .env files and secret files can
+// change a value.
+type Reloader struct {
+	opts []Option
+	log  *zap.Logger
+	typ  reflect.Type
+
+	current atomic.Value
+
+	mu   sync.Mutex
+	subs []func(c interface{}, changes Changes)
+}
+
+type snapshot struct {
+	config  interface{}
+	sources Sources
+}
+
+// NewReloader creates a new Reloader for the config c, a pointer to a struct, which was loaded from
+// the sources with the options. Reloads and their changes are logged to log.
+func NewReloader(c interface{}, sources Sources, log *zap.Logger, opts ...Option) *Reloader {
+	r := &Reloader{
+		opts: opts,
+		log:  log,
+		typ:  reflect.TypeOf(c).Elem(),
+	}
+
+	r.current.Store(snapshot{config: c, sources: sources})
+
+	return r
+}
+
+// Current returns the current config, a pointer to the same type of struct given to NewReloader.
+// It must not be modified.
+func (r *Reloader) Current() interface{} {
+	return r.current.Load().(snapshot).config
+}
+
+// Sources returns where the values of the current config came from.
+func (r *Reloader) Sources() Sources {
+	return r.current.Load().(snapshot).sources
+}
+
+// Subscribe calls fn with the new config, and the changes that were applied, after every reload that
+// changed a reloadable variable.
+func (r *Reloader) Subscribe(fn func(c interface{}, changes Changes)) {
+	r.mu.Lock()
+	r.subs = append(r.subs, fn)
+	r.mu.Unlock()
+}
+
+// Reload loads the config again. If it is invalid, the error is logged with the changes it would have
+// made, and returned, and the current config is kept. Otherwise the reloadable fields of the current
+// config are updated, each change is logged, and the subscribers are called. It returns every change,
+// including those that require a restart.
+func (r *Reloader) Reload() (Changes, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fresh := reflect.New(r.typ)
+
+	// An invalid config is still diffed, so the error can show the changes that were rejected.
+	sources, err := Load(fresh.Interface(), r.opts...)
+
+	old := r.current.Load().(snapshot)
+
+	// Start from a copy of the current config, so the fields that require a restart keep the values
+	// the process is using.
+	merged := reflect.New(r.typ)
+	merged.Elem().Set(reflect.ValueOf(old.config).Elem())
+
+	mergedSources := Sources{}
+	for name, source := range old.sources {
+		mergedSources[name] = source
+	}
+
+	var changes, applied Changes
+
+	fields := map[string]reflect.Value{}
+
+	walk(merged.Elem(), func(f reflect.StructField, fv reflect.Value, name string) {
+		fields[name] = fv
+	})
+
+	walk(fresh.Elem(), func(f reflect.StructField, fv reflect.Value, name string) {
+		target := fields[name]
+		if !fv.CanInterface() || reflect.DeepEqual(target.Interface(), fv.Interface()) {
+			return
+		}
+
+		change := Change{
+			Name:    name,
+			Old:     fmt.Sprintf("%v", target.Interface()),
+			New:     fmt.Sprintf("%v", fv.Interface()),
+			Source:  sources[name],
+			Restart: f.Tag.Get("reload") != "true",
+		}
+
+		if isSecret(f, name) {
+			change.Old, change.New = Redacted, Redacted
+		}
+
+		changes = append(changes, change)
+
+		if change.Restart {
+			return
+		}
+
+		target.Set(fv)
+
+		if source, ok := sources[name]; ok {
+			mergedSources[name] = source
+		} else {
+			delete(mergedSources, name)
+		}
+
+		applied = append(applied, change)
+	})
+
+	if validator, ok := merged.Interface().(Validator); ok && err == nil {
+		err = validator.Validate()
+	}
+
+	// The diff is only logged once the merged config is valid, so a rejected reload logs a single
+	// error with the changes it rejected.
+	if err != nil {
+		r.log.Error("error reloading config", zap.Error(err), zap.Any("rejected_changes", changes))
+		return nil, err
+	}
+
+	for _, change := range changes {
+		diff := []zap.Field{
+			zap.String("name", change.Name),
+			zap.String("old", change.Old),
+			zap.String("new", change.New),
+			zap.String("source", change.Source),
+		}
+
+		if change.Restart {
+			r.log.Warn("config change requires a restart", diff...)
+		} else {
+			r.log.Info("config changed", diff...)
+		}
+	}
+
+	r.log.Info("config reloaded", zap.Int("changes", len(applied)), zap.Int("restart_required", len(changes)-len(applied)))
+
+	if len(applied) == 0 {
+		return changes, nil
+	}
+
+	r.current.Store(snapshot{config: merged.Interface(), sources: mergedSources})
+
+	for _, fn := range r.subs {
+		fn(merged.Interface(), applied)
+	}
+
+	return changes, nil
+}
+
+// HandleSignals reloads the config whenever the process gets a SIGHUP. Call the returned func to
+// stop handling the signal.
+func (r *Reloader) HandleSignals() (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				r.Reload() // nolint
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// Watch reloads the config whenever the config file changes, checking its size and modification time
+// every interval. It does nothing if there is no config file. Call the returned func to stop
+// watching.
+func (r *Reloader) Watch(interval time.Duration) (stop func()) {
+	o := newOptions(r.opts)
+	if o.configFile == "" {
+		return func() {}
+	}
+
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(o.configFile)
+		if err != nil {
+			return time.Time{}, -1
+		}
+
+		return info.ModTime(), info.Size()
+	}
+
+	modified, size := stat()
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m, s := stat()
+				if m.Equal(modified) && s == size {
+					continue
+				}
+
+				modified, size = m, s
+
+				r.Reload() // nolint
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
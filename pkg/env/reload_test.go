@@ -0,0 +1,134 @@
+package env_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/env"
+)
+
+type reloadConfig struct {
+	env.Config
+	ListenAddress string   `env:"LISTEN_ADDRESS,required"`
+	Origins       []string `env:"ORIGINS" envSeparator:"," reload:"true"`
+	Secret        string   `env:"SECRET" reload:"true"`
+}
+
+func (c reloadConfig) Validate() error {
+	if len(c.Origins) == 0 {
+		return env.Errors{errors.New("ORIGINS is required")}
+	}
+
+	return nil
+}
+
+func TestReloader(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "LISTEN_ADDRESS: \":8080\"\nORIGINS: https://a.example.com\nSECRET: one\n")
+
+	opts := []env.Option{env.WithConfigFile(path), env.WithEnvFiles(), lookup(common)}
+
+	var c reloadConfig
+
+	sources, err := env.Load(&c, opts...)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	r := env.NewReloader(&c, sources, log, opts...)
+
+	var applied env.Changes
+
+	r.Subscribe(func(current interface{}, changes env.Changes) {
+		assert.Equal(t, []string{"https://b.example.com"}, current.(*reloadConfig).Origins)
+
+		applied = changes
+	})
+
+	writeFile(t, path, "LISTEN_ADDRESS: \":9090\"\nORIGINS: https://b.example.com\nSECRET: two\n")
+
+	changes, err := r.Reload()
+	require.NoError(t, err)
+
+	assert.Equal(t, env.Changes{
+		{Name: "LISTEN_ADDRESS", Old: ":8080", New: ":9090", Source: "config_file:" + path, Restart: true},
+		{Name: "ORIGINS", Old: "[https://a.example.com]", New: "[https://b.example.com]", Source: "config_file:" + path},
+		{Name: "SECRET", Old: env.Redacted, New: env.Redacted, Source: "config_file:" + path},
+	}, changes)
+	assert.Equal(t, changes[1:], applied)
+	assert.True(t, applied.Has("SECRET"))
+	assert.False(t, applied.Has("LISTEN_ADDRESS"))
+
+	current := r.Current().(*reloadConfig)
+	assert.Equal(t, ":8080", current.ListenAddress)
+	assert.Equal(t, []string{"https://b.example.com"}, current.Origins)
+	assert.Equal(t, "two", current.Secret)
+	assert.Equal(t, []string{"https://a.example.com"}, c.Origins)
+
+	assert.Contains(t, buf.String(), `"msg":"config change requires a restart","name":"LISTEN_ADDRESS"`)
+	assert.Contains(t, buf.String(), `"msg":"config changed","name":"ORIGINS"`)
+	assert.NotContains(t, buf.String(), "two")
+
+	// An invalid config is not applied, and only its rejected diff is logged.
+	buf.Reset()
+	writeFile(t, path, "LISTEN_ADDRESS: \":8080\"\nORIGINS: \"\"\nSECRET: three\n")
+
+	_, err = r.Reload()
+	assert.EqualError(t, err, "ORIGINS is required")
+	assert.Equal(t, "two", r.Current().(*reloadConfig).Secret)
+	assert.Contains(t, buf.String(), `"msg":"error reloading config"`)
+	assert.Contains(t, buf.String(), `"rejected_changes":[{"name":"ORIGINS","old":"[https://b.example.com]","new":"[]"`)
+	assert.NotContains(t, buf.String(), "config changed")
+	assert.NotContains(t, buf.String(), "config reloaded")
+	assert.NotContains(t, buf.String(), "three")
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "LISTEN_ADDRESS: \":8080\"\nORIGINS: https://a.example.com\n")
+
+	opts := []env.Option{env.WithConfigFile(path), env.WithEnvFiles(), lookup(common)}
+
+	var c reloadConfig
+
+	sources, err := env.Load(&c, opts...)
+	require.NoError(t, err)
+
+	r := env.NewReloader(&c, sources, zap.NewNop(), opts...)
+
+	reloaded := make(chan env.Changes, 1)
+	r.Subscribe(func(current interface{}, changes env.Changes) {
+		reloaded <- changes
+	})
+
+	defer r.Watch(time.Millisecond)()
+
+	writeFile(t, path, "LISTEN_ADDRESS: \":8080\"\nORIGINS: https://a.example.com,https://b.example.com\n")
+
+	select {
+	case changes := <-reloaded:
+		assert.True(t, changes.Has("ORIGINS"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+}
@@ -0,0 +1,84 @@
+// Package feature toggles features on and off while the server is running, such as when the config
+// is reloaded. The middleware adds the flags to the request context, so handlers check them with
+// Enabled.
+package feature
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+type contextKey int
+
+const flagsKey contextKey = iota
+
+// Flags are the names of the features that are enabled. It is safe for concurrent use.
+type Flags struct {
+	enabled atomic.Value
+}
+
+// New creates the flags with the features enabled.
+func New(names ...string) *Flags {
+	f := &Flags{}
+	f.Set(names...)
+
+	return f
+}
+
+// Set enables the features, and disables every other feature. Names are not case sensitive.
+func (f *Flags) Set(names ...string) {
+	enabled := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			enabled[name] = true
+		}
+	}
+
+	f.enabled.Store(enabled)
+}
+
+// Enabled returns true if the feature is enabled. Nil flags enable nothing.
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+
+	return f.enabled.Load().(map[string]bool)[strings.ToLower(name)]
+}
+
+// List returns the names of the features that are enabled, sorted.
+func (f *Flags) List() []string {
+	if f == nil {
+		return nil
+	}
+
+	enabled := f.enabled.Load().(map[string]bool)
+
+	names := make([]string, 0, len(enabled))
+	for name := range enabled {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// NewContext adds the flags to the context.
+func NewContext(ctx context.Context, f *Flags) context.Context {
+	return context.WithValue(ctx, flagsKey, f)
+}
+
+// FromContext returns the flags of the context, or nil if there are none.
+func FromContext(ctx context.Context) *Flags {
+	f, _ := ctx.Value(flagsKey).(*Flags)
+	return f
+}
+
+// Enabled returns true if the feature is enabled by the flags of the context.
+func Enabled(ctx context.Context, name string) bool {
+	return FromContext(ctx).Enabled(name)
+}
@@ -0,0 +1,36 @@
+package feature_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/pkg/feature"
+)
+
+func TestFlags(t *testing.T) {
+	f := feature.New("new-search", " Dark-Mode ", "")
+
+	assert.True(t, f.Enabled("new-search"))
+	assert.True(t, f.Enabled("dark-mode"))
+	assert.False(t, f.Enabled("beta"))
+	assert.Equal(t, []string{"dark-mode", "new-search"}, f.List())
+
+	f.Set("beta")
+
+	assert.False(t, f.Enabled("new-search"))
+	assert.True(t, f.Enabled("BETA"))
+	assert.Equal(t, []string{"beta"}, f.List())
+}
+
+func TestFromContext(t *testing.T) {
+	f := feature.New("beta")
+	ctx := feature.NewContext(context.Background(), f)
+
+	assert.Equal(t, f, feature.FromContext(ctx))
+	assert.True(t, feature.Enabled(ctx, "beta"))
+
+	assert.Nil(t, feature.FromContext(context.Background()))
+	assert.False(t, feature.Enabled(context.Background(), "beta"))
+}
@@ -0,0 +1,178 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rickbassham/example-go/pkg/redact"
+)
+
+// DefaultCaptureMaxBytes is how much of each body is captured, if BodyCapture.MaxBytes is not set.
+const DefaultCaptureMaxBytes = 4096
+
+// DefaultCaptureContentTypes are the content types captured, if BodyCapture.ContentTypes is not set.
+var DefaultCaptureContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"text/",
+}
+
+// BodyCapture configures which request and response bodies are captured for debugging, and how much
+// of them. Captured bodies are masked with the redaction policy on the request context before they
+// are logged; see redact.FromContext.
+type BodyCapture struct {
+	// MaxBytes is how much of each body is captured. The rest is still sent, but not logged.
+	MaxBytes int
+	// ContentTypes are the media types to capture. An entry ending with a slash, such as text/,
+	// matches every subtype. JSON variants, such as application/problem+json, are captured if
+	// application/json is.
+	ContentTypes []string
+}
+
+func (c BodyCapture) maxBytes() int {
+	if c.MaxBytes <= 0 {
+		return DefaultCaptureMaxBytes
+	}
+
+	return c.MaxBytes
+}
+
+// Allowed returns true if bodies with the content type should be captured.
+func (c BodyCapture) Allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	types := c.ContentTypes
+	if len(types) == 0 {
+		types = DefaultCaptureContentTypes
+	}
+
+	for _, t := range types {
+		switch {
+		case strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t):
+			return true
+		case mediaType == t:
+			return true
+		}
+	}
+
+	return strings.HasSuffix(mediaType, "+json") && c.Allowed("application/json")
+}
+
+// Peek reads the start of body, up to MaxBytes, and returns it along with a body that still returns
+// everything, for the request or response to use in its place. The body is only closed when the
+// returned body is.
+func (c BodyCapture) Peek(body io.ReadCloser) (captured []byte, truncated bool, replacement io.ReadCloser, err error) {
+	if body == nil || body == http.NoBody {
+		return nil, false, body, nil
+	}
+
+	captured, err = ioutil.ReadAll(io.LimitReader(body, int64(c.maxBytes())+1))
+
+	truncated = len(captured) > c.maxBytes()
+
+	replacement = readCloser{
+		Reader: io.MultiReader(bytes.NewReader(captured), body),
+		Closer: body,
+	}
+
+	if truncated {
+		captured = captured[:c.maxBytes()]
+	}
+
+	return captured, truncated, replacement, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Buffer keeps the first bytes written to it, up to MaxBytes, to capture a body as it is written.
+type Buffer struct {
+	max       int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// NewBuffer creates a new Buffer that keeps up to MaxBytes.
+func (c BodyCapture) NewBuffer() *Buffer {
+	return &Buffer{max: c.maxBytes()}
+}
+
+// Write keeps what fits, and always reports that all of p was written.
+func (b *Buffer) Write(p []byte) (int, error) {
+	room := b.max - b.buf.Len()
+
+	if len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:room])
+	} else {
+		b.buf.Write(p)
+	}
+
+	return len(p), nil
+}
+
+// Bytes returns what was kept.
+func (b *Buffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Truncated returns true if more was written than was kept.
+func (b *Buffer) Truncated() bool {
+	return b.truncated
+}
+
+// BodyFields returns the log fields for a captured body, masked with the redaction policy on the
+// context. The prefix is request or response.
+func BodyFields(ctx context.Context, prefix, contentType string, body []byte, truncated bool) []zap.Field {
+	return []zap.Field{
+		zap.String(prefix+"_body", redact.FromContext(ctx).Body(contentType, body)),
+		zap.Bool(prefix+"_body_truncated", truncated),
+	}
+}
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return "httputil context key: " + string(k)
+}
+
+var (
+	captureKey = contextKey("capture")
+)
+
+// WithBodyCapture enables body capture for the outgoing requests made with the context, through
+// LogTransport.
+func WithBodyCapture(ctx context.Context, c BodyCapture) context.Context {
+	return context.WithValue(ctx, captureKey, c)
+}
+
+// BodyCaptureFromContext returns the body capture config on the context, and whether there is one.
+func BodyCaptureFromContext(ctx context.Context) (BodyCapture, bool) {
+	c, ok := ctx.Value(captureKey).(BodyCapture)
+	return c, ok
+}
+
+// BodyCaptureTransport enables body capture in LogTransport for every request made with the
+// transport. Use it before LogTransport, so the capture is enabled when LogTransport runs.
+func BodyCaptureTransport(c BodyCapture, old http.RoundTripper) http.RoundTripper {
+	if old == nil {
+		old = http.DefaultTransport
+	}
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return old.RoundTrip(req.WithContext(WithBodyCapture(req.Context(), c)))
+	})
+}
@@ -6,10 +6,11 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/metrics"
+	"github.com/rickbassham/example-go/pkg/redact"
 	"github.com/rickbassham/example-go/pkg/tracing"
 )
 
@@ -26,19 +27,104 @@ func HeaderTransport(key, value string, old http.RoundTripper) http.RoundTripper
 	})
 }
 
-// TraceIDTransport ensures a trace id header is set on all outgoing requests.
+// TraceIDTransport is TraceContextTransport using the default propagator, which writes the W3C
+// Trace Context and legacy X-Trace-Id headers.
 func TraceIDTransport(old http.RoundTripper) http.RoundTripper {
+	return TraceContextTransport(tracing.Propagator{}, old)
+}
+
+// TraceContextTransport ensures the trace headers are set on all outgoing requests. Each request is
+// recorded as a client span, using the tracer on the request context, as a child of the span on the
+// request context. If there is no span on the request context, a new trace is started.
+func TraceContextTransport(p tracing.Propagator, old http.RoundTripper) http.RoundTripper {
+	if old == nil {
+		old = http.DefaultTransport
+	}
+
 	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
 		ctx := req.Context()
 
-		// use the existing trace id if it exists
-		traceID := tracing.FromContext(ctx)
-		if traceID == "" {
-			traceID = uuid.New().String()
-			req = req.WithContext(tracing.WithTraceID(ctx, traceID))
+		// continue a trace that only has a trace id on the context, sending it on as it was given,
+		// such as a UUID
+		if _, ok := tracing.SpanContextFromContext(ctx); !ok {
+			legacy := tracing.FromContext(ctx)
+
+			if traceID, err := tracing.ParseTraceID(legacy); err == nil {
+				sc := tracing.NewSpanContext(true)
+				sc.TraceID = traceID
+
+				if legacy != traceID.String() {
+					sc.LegacyTraceID = legacy
+				}
+
+				ctx = tracing.WithSpanContext(ctx, sc)
+			}
+		}
+
+		ctx, span := tracing.StartSpan(ctx, "HTTP "+req.Method, tracing.SpanKindClient)
+		defer span.End()
+
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+		req = req.WithContext(ctx)
+
+		p.Inject(span.SpanContext(), req.Header)
+
+		resp, err := old.RoundTrip(req)
+		if err != nil {
+			span.SetError(err)
+			return resp, err
+		}
+
+		span.SetAttribute("http.status_code", resp.StatusCode)
+
+		if resp.StatusCode >= 500 {
+			span.SetError(fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
 		}
 
-		req.Header.Set("X-Trace-Id", traceID)
+		return resp, err
+	})
+}
+
+// MetricsTransport records the count and latency of every outgoing request in the registry, labeled
+// by host, method and status class. Requests that fail without a response have the status "error".
+// Create one per registry and share it between clients, since the metrics can only be registered
+// once.
+func MetricsTransport(reg *metrics.Registry, old http.RoundTripper) http.RoundTripper {
+	if old == nil {
+		old = http.DefaultTransport
+	}
+
+	requests := reg.NewCounterVec("http_client_requests_total",
+		"Number of outgoing http requests.", "host", "method", "status")
+	duration := reg.NewHistogramVec("http_client_request_duration_seconds",
+		"Latency of outgoing http requests.", nil, "host", "method", "status")
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+
+		resp, err := old.RoundTrip(req)
+
+		status := "error"
+		if err == nil {
+			status = metrics.StatusClass(resp.StatusCode)
+		}
+
+		requests.WithLabelValues(req.URL.Host, req.Method, status).Inc()
+		duration.WithLabelValues(req.URL.Host, req.Method, status).Observe(time.Since(start).Seconds())
+
+		return resp, err
+	})
+}
+
+// DefaultTracerTransport will add the given tracer to all request contexts that do not already have
+// one, so outgoing requests made outside of an incoming request are traced too.
+func DefaultTracerTransport(t *tracing.Tracer, old http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if tracing.TracerFromContext(req.Context()) == nil {
+			req = req.WithContext(tracing.WithTracer(req.Context(), t))
+		}
 
 		return old.RoundTrip(req)
 	})
@@ -53,19 +139,62 @@ func DefaultLogTransport(log *zap.Logger, old http.RoundTripper) http.RoundTripp
 	})
 }
 
-// LogTransport will log every outgoing request.
+// DefaultRedactTransport will add the given redaction policy to all request contexts that do not
+// already have one, so outgoing requests made outside of an incoming request are masked the same way.
+func DefaultRedactTransport(p *redact.Policy, old http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if redact.FromContext(req.Context()) == redact.Default() {
+			req = req.WithContext(redact.WithPolicy(req.Context(), p))
+		}
+
+		return old.RoundTrip(req)
+	})
+}
+
+// LogTransport will log every outgoing request, with a logger named httputil. The url and redirect
+// location are masked with the redaction policy on the request context; see redact.FromContext. If
+// body capture is enabled on the request context, the request and response bodies are logged too;
+// see WithBodyCapture.
 func LogTransport(old http.RoundTripper) http.RoundTripper {
 	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
-		l := logging.FromContext(req.Context()).With(
+		ctx := req.Context()
+		policy := redact.FromContext(ctx)
+
+		l := logging.FromContext(ctx).Named("httputil").With(
 			zap.String("direction", "outgoing"),
-			zap.String("url", req.URL.String()),
+			zap.String("url", policy.URL(req.URL.String())),
 			zap.String("method", req.Method),
 		)
 
+		capture, captureBodies := BodyCaptureFromContext(ctx)
+
+		if captureBodies && capture.Allowed(req.Header.Get("Content-Type")) {
+			body, truncated, replacement, err := capture.Peek(req.Body)
+			if err != nil {
+				l.Error("request error", zap.Error(err))
+				return nil, err
+			}
+
+			// Don't modify the caller's request.
+			req = req.WithContext(ctx)
+			req.Body = replacement
+
+			l = l.With(BodyFields(ctx, "request", req.Header.Get("Content-Type"), body, truncated)...)
+		}
+
 		start := time.Now()
 
 		resp, err := old.RoundTrip(req)
 
+		if captureBodies && resp != nil && capture.Allowed(resp.Header.Get("Content-Type")) {
+			body, truncated, replacement, peekErr := capture.Peek(resp.Body)
+			resp.Body = replacement
+
+			if peekErr == nil {
+				l = l.With(BodyFields(ctx, "response", resp.Header.Get("Content-Type"), body, truncated)...)
+			}
+		}
+
 		l = l.With(
 			zap.Duration("duration", time.Since(start)),
 		)
@@ -82,7 +211,7 @@ func LogTransport(old http.RoundTripper) http.RoundTripper {
 			)
 
 			if status >= 300 && status < 400 {
-				l = l.With(zap.String("location", resp.Header.Get("Location")))
+				l = l.With(zap.String("location", policy.URL(resp.Header.Get("Location"))))
 			}
 
 			if status < 400 {
@@ -1,13 +1,21 @@
 package httputil_test
 
 import (
+	"bytes"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/rickbassham/example-go/pkg/httputil"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/metrics"
+	"github.com/rickbassham/example-go/pkg/tracing"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -58,3 +66,119 @@ func TestBasicAuthTransport(t *testing.T) {
 
 	require.NoError(t, err)
 }
+
+func TestTraceIDTransport(t *testing.T) {
+	old := &mockTransport{}
+
+	old.On("RoundTrip", mock.Anything).Return(&http.Response{}, nil).Run(func(args mock.Arguments) {
+		r := args.Get(0).(*http.Request)
+
+		sc, ok := tracing.SpanContextFromContext(r.Context())
+		require.True(t, ok)
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", r.Header.Get("X-Trace-Id"))
+		assert.Equal(t, sc.TraceParent(), r.Header.Get("traceparent"))
+		assert.Equal(t, "00f067aa0ba902b7", sc.ParentSpanID.String())
+	})
+
+	rt := httputil.TraceIDTransport(old)
+
+	parent, err := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	r, err := http.NewRequest("GET", "http://test/api", nil)
+	require.NoError(t, err)
+
+	r = r.WithContext(tracing.WithSpanContext(r.Context(), parent))
+
+	_, err = rt.RoundTrip(r)
+
+	require.NoError(t, err)
+}
+
+func TestTraceIDTransport_LegacyTraceID(t *testing.T) {
+	old := &mockTransport{}
+
+	old.On("RoundTrip", mock.Anything).Return(&http.Response{}, nil).Run(func(args mock.Arguments) {
+		r := args.Get(0).(*http.Request)
+
+		assert.Equal(t, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", r.Header.Get("X-Trace-Id"))
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", r.Header.Get("traceparent")[3:35])
+	})
+
+	rt := httputil.TraceIDTransport(old)
+
+	r, err := http.NewRequest("GET", "http://test/api", nil)
+	require.NoError(t, err)
+
+	r = r.WithContext(tracing.WithTraceID(r.Context(), "4bf92f35-77b3-4da6-a3ce-929d0e0e4736"))
+
+	_, err = rt.RoundTrip(r)
+	require.NoError(t, err)
+
+	old.AssertExpectations(t)
+}
+
+func TestMetricsTransport(t *testing.T) {
+	old := &mockTransport{}
+
+	old.On("RoundTrip", mock.Anything).Return(&http.Response{StatusCode: 404}, nil)
+
+	reg := metrics.NewRegistry()
+	rt := httputil.MetricsTransport(reg, old)
+
+	r, err := http.NewRequest("GET", "http://test/api", nil)
+	require.NoError(t, err)
+
+	_, err = rt.RoundTrip(r)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.Write(&buf))
+
+	assert.Contains(t, buf.String(), `http_client_requests_total{host="test",method="GET",status="4xx"} 1`)
+}
+
+func TestLogTransport_BodyCapture(t *testing.T) {
+	var logs bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&logs),
+		zapcore.DebugLevel,
+	))
+
+	old := &mockTransport{}
+
+	old.On("RoundTrip", mock.Anything).Return(&http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader("0123456789")),
+	}, nil).Run(func(args mock.Arguments) {
+		r := args.Get(0).(*http.Request)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "token=abc&page=2", string(body))
+	})
+
+	rt := httputil.BodyCaptureTransport(httputil.BodyCapture{MaxBytes: 4}, httputil.LogTransport(old))
+
+	r, err := http.NewRequest("POST", "http://test/api", strings.NewReader("token=abc&page=2"))
+	require.NoError(t, err)
+
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(logging.WithLogger(r.Context(), log))
+
+	resp, err := rt.RoundTrip(r)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+
+	out := logs.String()
+
+	assert.Contains(t, out, `"request_body":"toke","request_body_truncated":true`)
+	assert.Contains(t, out, `"response_body":"0123","response_body_truncated":true`)
+}
@@ -9,19 +9,39 @@ func (k contextKey) String() string {
 }
 
 var (
-	userKey = contextKey("user")
+	principalKey = contextKey("principal")
+	tenantKey    = contextKey("tenant")
 )
 
-// WithUser adds the user to the request context.
+// WithPrincipal adds the principal to the request context.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext retrieves the principal from the context, and whether there is one.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+// WithUser adds a principal with only a subject, the user, to the request context.
 func WithUser(ctx context.Context, user string) context.Context {
-	return context.WithValue(ctx, userKey, user)
+	return WithPrincipal(ctx, Principal{Subject: user})
 }
 
-// FromContext retrieves the user from the context.
+// FromContext retrieves the user from the context; see Principal.User.
 func FromContext(ctx context.Context) string {
-	if val, ok := ctx.Value(userKey).(string); ok {
-		return val
-	}
+	p, _ := PrincipalFromContext(ctx)
+	return p.User()
+}
+
+// WithTenant adds the tenant the request is for to the request context.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
 
-	return ""
+// TenantFromContext retrieves the tenant from the context, and whether there is one.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	t, ok := ctx.Value(tenantKey).(string)
+	return t, ok && t != ""
 }
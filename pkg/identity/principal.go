@@ -0,0 +1,198 @@
+package identity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Auth methods a Principal can be authenticated with.
+const (
+	AuthMethodJWT        = "jwt"
+	AuthMethodAdminToken = "admin_token"
+	AuthMethodClientCert = "client_cert"
+	AuthMethodAPIKey     = "api_key"
+	AuthMethodSession    = "session"
+)
+
+// Principal is who is making a request, and what they are allowed to do.
+type Principal struct {
+	// Subject is the stable id of the principal, such as the sub claim of their token.
+	Subject string `json:"subject,omitempty"`
+	// Email is the email address of the principal, if known.
+	Email string `json:"email,omitempty"`
+	// Name is the display name of the principal, if known.
+	Name string `json:"name,omitempty"`
+	// Roles are the roles granted to the principal.
+	Roles []string `json:"roles,omitempty"`
+	// Scopes are the scopes granted to the token the principal used.
+	Scopes []string `json:"scopes,omitempty"`
+	// Tenant is the tenant the principal belongs to, if any.
+	Tenant string `json:"tenant,omitempty"`
+	// AuthMethod is how the principal was authenticated, such as AuthMethodJWT.
+	AuthMethod string `json:"auth_method,omitempty"`
+	// TokenID is the id of the token the principal used, such as its jti claim.
+	TokenID string `json:"token_id,omitempty"`
+}
+
+// ID returns the id recorded for the principal, such as in audit columns: the Subject, or the Email
+// if there is no subject.
+func (p Principal) ID() string {
+	if p.Subject != "" {
+		return p.Subject
+	}
+
+	return p.Email
+}
+
+// User returns the name the principal is shown as: the Email, or the ID if there is no email.
+func (p Principal) User() string {
+	if p.Email != "" {
+		return p.Email
+	}
+
+	return p.ID()
+}
+
+// HasRole returns true if the principal has the role.
+func (p Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasScope returns true if the principal has the scope.
+func (p Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClaimMapping names the token claims each Principal field is read from. A name with dots, such as
+// realm_access.roles, reads a claim nested in objects. An empty name leaves the field empty.
+type ClaimMapping struct {
+	Subject string
+	Email   string
+	Name    string
+	Roles   string
+	Scopes  string
+	Tenant  string
+	TokenID string
+}
+
+// DefaultClaimMapping reads the registered and common claims.
+var DefaultClaimMapping = ClaimMapping{
+	Subject: "sub",
+	Email:   "email",
+	Name:    "name",
+	Roles:   "roles",
+	Scopes:  "scope",
+	Tenant:  "tenant",
+	TokenID: "jti",
+}
+
+// ParseClaimMapping overrides fields of DefaultClaimMapping with entries such as
+// roles=realm_access.roles. The fields are subject, email, name, roles, scopes, tenant and token_id.
+func ParseClaimMapping(entries []string) (ClaimMapping, error) {
+	m := DefaultClaimMapping
+
+	fields := map[string]*string{
+		"subject":  &m.Subject,
+		"email":    &m.Email,
+		"name":     &m.Name,
+		"roles":    &m.Roles,
+		"scopes":   &m.Scopes,
+		"tenant":   &m.Tenant,
+		"token_id": &m.TokenID,
+	}
+
+	for _, e := range entries {
+		kv := strings.SplitN(strings.TrimSpace(e), "=", 2)
+		if len(kv) != 2 {
+			return m, fmt.Errorf("invalid claim mapping %q: expected field=claim", e)
+		}
+
+		f, ok := fields[strings.TrimSpace(kv[0])]
+		if !ok {
+			return m, fmt.Errorf("invalid claim mapping %q: unknown field %q", e, kv[0])
+		}
+
+		*f = strings.TrimSpace(kv[1])
+	}
+
+	return m, nil
+}
+
+// Principal creates the Principal for a token with the claims, authenticated with AuthMethodJWT.
+// Roles and scopes can be arrays of strings, or strings separated by spaces.
+func (m ClaimMapping) Principal(claims map[string]interface{}) Principal {
+	return Principal{
+		Subject:    claimString(claims, m.Subject),
+		Email:      claimString(claims, m.Email),
+		Name:       claimString(claims, m.Name),
+		Roles:      claimStrings(claims, m.Roles),
+		Scopes:     claimStrings(claims, m.Scopes),
+		Tenant:     claimString(claims, m.Tenant),
+		AuthMethod: AuthMethodJWT,
+		TokenID:    claimString(claims, m.TokenID),
+	}
+}
+
+func claim(claims map[string]interface{}, name string) interface{} {
+	if name == "" {
+		return nil
+	}
+
+	if v, ok := claims[name]; ok {
+		return v
+	}
+
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	nested, ok := claims[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return claim(nested, parts[1])
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	switch v := claim(claims, name).(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+
+	return ""
+}
+
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claim(claims, name).(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []interface{}:
+		var out []string
+
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+
+		return out
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package identity_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func TestClaimMapping_Principal(t *testing.T) {
+	p := identity.DefaultClaimMapping.Principal(map[string]interface{}{
+		"sub":    "user-1",
+		"email":  "rick@example.com",
+		"name":   "Rick",
+		"roles":  []interface{}{"admin", 7.0, "editor"},
+		"scope":  "read write",
+		"tenant": "acme",
+		"jti":    "token-1",
+	})
+
+	assert.Equal(t, identity.Principal{
+		Subject:    "user-1",
+		Email:      "rick@example.com",
+		Name:       "Rick",
+		Roles:      []string{"admin", "editor"},
+		Scopes:     []string{"read", "write"},
+		Tenant:     "acme",
+		AuthMethod: identity.AuthMethodJWT,
+		TokenID:    "token-1",
+	}, p)
+
+	assert.True(t, p.HasRole("editor"))
+	assert.False(t, p.HasRole("owner"))
+	assert.True(t, p.HasScope("write"))
+	assert.Equal(t, "user-1", p.ID())
+	assert.Equal(t, "rick@example.com", p.User())
+}
+
+func TestParseClaimMapping(t *testing.T) {
+	m, err := identity.ParseClaimMapping([]string{"roles=realm_access.roles", " tenant = org_id "})
+	assert.NoError(t, err)
+	assert.Equal(t, "realm_access.roles", m.Roles)
+	assert.Equal(t, "org_id", m.Tenant)
+	assert.Equal(t, "sub", m.Subject)
+
+	_, err = identity.ParseClaimMapping([]string{"roles"})
+	assert.EqualError(t, err, `invalid claim mapping "roles": expected field=claim`)
+
+	_, err = identity.ParseClaimMapping([]string{"group=groups"})
+	assert.EqualError(t, err, `invalid claim mapping "group=groups": unknown field "group"`)
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", identity.FromContext(ctx))
+
+	ctx = identity.WithUser(ctx, "my-user")
+	assert.Equal(t, "my-user", identity.FromContext(ctx))
+
+	p, ok := identity.PrincipalFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "my-user", p.Subject)
+}
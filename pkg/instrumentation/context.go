@@ -0,0 +1,28 @@
+package instrumentation
+
+import "context"
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return "context key: " + string(k)
+}
+
+var (
+	transactionKey = contextKey("transaction")
+)
+
+// NewContext adds the transaction to the request context.
+func NewContext(ctx context.Context, txn Transaction) context.Context {
+	return context.WithValue(ctx, transactionKey, txn)
+}
+
+// FromContext retrieves the transaction from the request context. If there is no transaction on the
+// context, it will return a valid no-op transaction.
+func FromContext(ctx context.Context) Transaction {
+	if val, ok := ctx.Value(transactionKey).(Transaction); ok {
+		return val
+	}
+
+	return noopTransaction{}
+}
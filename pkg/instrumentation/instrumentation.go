@@ -0,0 +1,73 @@
+// Package instrumentation defines a vendor neutral interface for application performance
+// monitoring, with New Relic, no-op and in-memory implementations.
+package instrumentation
+
+import (
+	"net/http"
+	"time"
+)
+
+// Application starts transactions and records events for the running service.
+type Application interface {
+	// StartTransaction starts a web transaction for the request. The returned http.ResponseWriter
+	// should be used to write the response, so the transaction can record the status code.
+	StartTransaction(name string, w http.ResponseWriter, r *http.Request) (Transaction, http.ResponseWriter)
+	// RecordCustomEvent records an event that is not tied to a transaction.
+	RecordCustomEvent(eventType string, params map[string]interface{})
+	// Shutdown flushes any pending data, waiting up to timeout.
+	Shutdown(timeout time.Duration)
+}
+
+// Transaction is a single unit of work, usually a web request.
+type Transaction interface {
+	// SetName changes the name of the transaction, such as when the route is known after routing.
+	SetName(name string)
+	// AddAttribute adds a custom attribute to the transaction.
+	AddAttribute(key string, value interface{})
+	// NoticeError records an error on the transaction. Use an Error to set the error class.
+	NoticeError(err error)
+	// RecordCustomEvent records an event from within the transaction.
+	RecordCustomEvent(eventType string, params map[string]interface{})
+	// StartSegment times a named part of the transaction.
+	StartSegment(name string) Segment
+	// StartDatastoreSegment times a call to a datastore.
+	StartDatastoreSegment(ds Datastore) Segment
+	// End finishes the transaction.
+	End()
+}
+
+// Segment is a timed part of a transaction.
+type Segment interface {
+	End()
+}
+
+// Datastore products known to the instrumentation.
+const (
+	DatastoreRedis = "Redis"
+	DatastoreMySQL = "MySQL"
+)
+
+// Datastore describes a call to a datastore.
+type Datastore struct {
+	// Product is the datastore, such as DatastoreRedis or DatastoreMySQL.
+	Product string
+	// Operation is the command or statement name.
+	Operation string
+	// Query is the parameterized query, if any.
+	Query string
+}
+
+// Error is an error with a class and extra attributes, such as a recovered panic.
+type Error struct {
+	Message    string
+	Class      string
+	Attributes map[string]interface{}
+}
+
+func (e Error) Error() string { return e.Message }
+
+// ErrorClass returns the class of the error, used to group errors.
+func (e Error) ErrorClass() string { return e.Class }
+
+// ErrorAttributes returns the extra attributes of the error.
+func (e Error) ErrorAttributes() map[string]interface{} { return e.Attributes }
@@ -0,0 +1,199 @@
+package instrumentation
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Memory is an Application that keeps everything it records in memory, so tests can make assertions
+// about it.
+type Memory struct {
+	mu           sync.Mutex
+	transactions []*MemoryTransaction
+	events       []MemoryEvent
+}
+
+// MemoryEvent is a custom event recorded by Memory.
+type MemoryEvent struct {
+	Type   string
+	Params map[string]interface{}
+}
+
+// MemoryTransaction is a transaction recorded by Memory.
+type MemoryTransaction struct {
+	app *Memory
+
+	mu         sync.Mutex
+	name       string
+	attributes map[string]interface{}
+	errors     []error
+	segments   []*MemorySegment
+	ended      bool
+}
+
+// MemorySegment is a segment recorded by a MemoryTransaction. Datastore is empty for named segments.
+type MemorySegment struct {
+	Name      string
+	Datastore Datastore
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// NewMemory creates a new, empty Memory.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// StartTransaction starts a new MemoryTransaction.
+func (m *Memory) StartTransaction(name string, w http.ResponseWriter, r *http.Request) (Transaction, http.ResponseWriter) {
+	txn := &MemoryTransaction{
+		app:        m,
+		name:       name,
+		attributes: map[string]interface{}{},
+	}
+
+	m.mu.Lock()
+	m.transactions = append(m.transactions, txn)
+	m.mu.Unlock()
+
+	return txn, w
+}
+
+// RecordCustomEvent records the event.
+func (m *Memory) RecordCustomEvent(eventType string, params map[string]interface{}) {
+	m.mu.Lock()
+	m.events = append(m.events, MemoryEvent{Type: eventType, Params: params})
+	m.mu.Unlock()
+}
+
+// Shutdown does nothing.
+func (m *Memory) Shutdown(timeout time.Duration) {}
+
+// Transactions returns every transaction started so far.
+func (m *Memory) Transactions() []*MemoryTransaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*MemoryTransaction(nil), m.transactions...)
+}
+
+// Events returns every custom event recorded so far.
+func (m *Memory) Events() []MemoryEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]MemoryEvent(nil), m.events...)
+}
+
+// SetName changes the name of the transaction.
+func (t *MemoryTransaction) SetName(name string) {
+	t.mu.Lock()
+	t.name = name
+	t.mu.Unlock()
+}
+
+// AddAttribute adds an attribute to the transaction.
+func (t *MemoryTransaction) AddAttribute(key string, value interface{}) {
+	t.mu.Lock()
+	t.attributes[key] = value
+	t.mu.Unlock()
+}
+
+// NoticeError records the error.
+func (t *MemoryTransaction) NoticeError(err error) {
+	t.mu.Lock()
+	t.errors = append(t.errors, err)
+	t.mu.Unlock()
+}
+
+// RecordCustomEvent records the event on the Memory that started the transaction.
+func (t *MemoryTransaction) RecordCustomEvent(eventType string, params map[string]interface{}) {
+	t.app.RecordCustomEvent(eventType, params)
+}
+
+// StartSegment starts a named segment.
+func (t *MemoryTransaction) StartSegment(name string) Segment {
+	return t.addSegment(&MemorySegment{Name: name})
+}
+
+// StartDatastoreSegment starts a datastore segment.
+func (t *MemoryTransaction) StartDatastoreSegment(ds Datastore) Segment {
+	return t.addSegment(&MemorySegment{Name: ds.Product + " " + ds.Operation, Datastore: ds})
+}
+
+func (t *MemoryTransaction) addSegment(s *MemorySegment) Segment {
+	t.mu.Lock()
+	t.segments = append(t.segments, s)
+	t.mu.Unlock()
+
+	return s
+}
+
+// End finishes the transaction.
+func (t *MemoryTransaction) End() {
+	t.mu.Lock()
+	t.ended = true
+	t.mu.Unlock()
+}
+
+// Name returns the current name of the transaction.
+func (t *MemoryTransaction) Name() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.name
+}
+
+// Attributes returns a copy of the attributes added to the transaction.
+func (t *MemoryTransaction) Attributes() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attrs := make(map[string]interface{}, len(t.attributes))
+	for k, v := range t.attributes {
+		attrs[k] = v
+	}
+
+	return attrs
+}
+
+// Errors returns the errors noticed on the transaction.
+func (t *MemoryTransaction) Errors() []error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]error(nil), t.errors...)
+}
+
+// Segments returns the segments started on the transaction.
+func (t *MemoryTransaction) Segments() []*MemorySegment {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*MemorySegment(nil), t.segments...)
+}
+
+// Ended returns true once End has been called.
+func (t *MemoryTransaction) Ended() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.ended
+}
+
+// End finishes the segment.
+func (s *MemorySegment) End() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+}
+
+// Ended returns true once End has been called.
+func (s *MemorySegment) Ended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ended
+}
@@ -0,0 +1,79 @@
+package instrumentation
+
+import (
+	"net/http"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+// NewRelic returns an Application that reports to New Relic.
+func NewRelic(app newrelic.Application) Application {
+	return newRelicApplication{app: app}
+}
+
+type newRelicApplication struct {
+	app newrelic.Application
+}
+
+func (a newRelicApplication) StartTransaction(name string, w http.ResponseWriter, r *http.Request) (Transaction, http.ResponseWriter) {
+	txn := a.app.StartTransaction(name, w, r)
+	return newRelicTransaction{txn: txn}, txn
+}
+
+func (a newRelicApplication) RecordCustomEvent(eventType string, params map[string]interface{}) {
+	a.app.RecordCustomEvent(eventType, params) // nolint
+}
+
+func (a newRelicApplication) Shutdown(timeout time.Duration) {
+	a.app.Shutdown(timeout)
+}
+
+type newRelicTransaction struct {
+	txn newrelic.Transaction
+}
+
+func (t newRelicTransaction) SetName(name string) {
+	t.txn.SetName(name) // nolint
+}
+
+func (t newRelicTransaction) AddAttribute(key string, value interface{}) {
+	t.txn.AddAttribute(key, value) // nolint
+}
+
+func (t newRelicTransaction) NoticeError(err error) {
+	// Error satisfies the newrelic ErrorClasser and ErrorAttributer interfaces, so the class and
+	// attributes are kept.
+	t.txn.NoticeError(err) // nolint
+}
+
+func (t newRelicTransaction) RecordCustomEvent(eventType string, params map[string]interface{}) {
+	t.txn.Application().RecordCustomEvent(eventType, params) // nolint
+}
+
+func (t newRelicTransaction) StartSegment(name string) Segment {
+	return newRelicSegment{end: newrelic.StartSegment(t.txn, name).End}
+}
+
+func (t newRelicTransaction) StartDatastoreSegment(ds Datastore) Segment {
+	s := &newrelic.DatastoreSegment{
+		Product:            newrelic.DatastoreProduct(ds.Product),
+		Operation:          ds.Operation,
+		ParameterizedQuery: ds.Query,
+		StartTime:          newrelic.StartSegmentNow(t.txn),
+	}
+
+	return newRelicSegment{end: s.End}
+}
+
+func (t newRelicTransaction) End() {
+	t.txn.End() // nolint
+}
+
+type newRelicSegment struct {
+	end func() error
+}
+
+func (s newRelicSegment) End() {
+	s.end() // nolint
+}
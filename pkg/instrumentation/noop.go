@@ -0,0 +1,35 @@
+package instrumentation
+
+import (
+	"net/http"
+	"time"
+)
+
+// Noop returns an Application that records nothing. Use it for local and offline runs.
+func Noop() Application {
+	return noopApplication{}
+}
+
+type noopApplication struct{}
+
+func (noopApplication) StartTransaction(name string, w http.ResponseWriter, r *http.Request) (Transaction, http.ResponseWriter) {
+	return noopTransaction{}, w
+}
+
+func (noopApplication) RecordCustomEvent(eventType string, params map[string]interface{}) {}
+
+func (noopApplication) Shutdown(timeout time.Duration) {}
+
+type noopTransaction struct{}
+
+func (noopTransaction) SetName(name string)                                               {}
+func (noopTransaction) AddAttribute(key string, value interface{})                        {}
+func (noopTransaction) NoticeError(err error)                                             {}
+func (noopTransaction) RecordCustomEvent(eventType string, params map[string]interface{}) {}
+func (noopTransaction) StartSegment(name string) Segment                                  { return noopSegment{} }
+func (noopTransaction) StartDatastoreSegment(ds Datastore) Segment                        { return noopSegment{} }
+func (noopTransaction) End()                                                              {}
+
+type noopSegment struct{}
+
+func (noopSegment) End() {}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/env"
+)
+
+// AuditLogger is the name of the logger for audit events.
+const AuditLogger = "audit"
+
+// NewAuditLogger creates the logger for audit events, apart from the application logs: it writes
+// JSON to c.LogAuditFile, or to stdout if it is not set, and is not affected by the log level or its
+// overrides, so no event is ever dropped.
+func NewAuditLogger(c env.Config) *zap.Logger {
+	var out zapcore.WriteSyncer = zapcore.Lock(os.Stdout)
+	if c.LogAuditFile != "" {
+		out = rotatingFile(c, c.LogAuditFile)
+	}
+
+	return zap.New(zapcore.NewCore(jsonEncoder(), out, zapcore.DebugLevel)).Named(AuditLogger).With(
+		zap.String("app_name", c.AppName),
+		zap.String("environment", c.Environment),
+		zap.String("build_git_tag", c.BuildGitTag),
+	)
+}
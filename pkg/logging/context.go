@@ -2,6 +2,7 @@ package logging
 
 import (
 	"context"
+	"sync"
 
 	"go.uber.org/zap"
 )
@@ -14,8 +15,14 @@ func (k contextKey) String() string {
 
 var (
 	loggerKey = contextKey("logger")
+	fieldsKey = contextKey("fields")
 )
 
+type requestFields struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
 // WithLogger adds the logger to the request context.
 func WithLogger(ctx context.Context, l *zap.Logger) context.Context {
 	return context.WithValue(ctx, loggerKey, l)
@@ -30,3 +37,31 @@ func FromContext(ctx context.Context) *zap.Logger {
 
 	return zap.NewNop()
 }
+
+// WithRequestFields adds a place to the context for fields that belong on the log entry for the whole
+// request, such as the "request complete" entry from the Logger middleware.
+func WithRequestFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey, &requestFields{})
+}
+
+// AddRequestFields adds fields to the log entry for the whole request. It does nothing if the context
+// was not created by WithRequestFields.
+func AddRequestFields(ctx context.Context, fields ...zap.Field) {
+	if rf, ok := ctx.Value(fieldsKey).(*requestFields); ok {
+		rf.mu.Lock()
+		rf.fields = append(rf.fields, fields...)
+		rf.mu.Unlock()
+	}
+}
+
+// RequestFields returns the fields added with AddRequestFields.
+func RequestFields(ctx context.Context) []zap.Field {
+	if rf, ok := ctx.Value(fieldsKey).(*requestFields); ok {
+		rf.mu.Lock()
+		defer rf.mu.Unlock()
+
+		return append([]zap.Field(nil), rf.fields...)
+	}
+
+	return nil
+}
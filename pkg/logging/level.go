@@ -0,0 +1,343 @@
+package logging
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels controls the log level at runtime. There is a base level for every log, and overrides for
+// a scope. A scope that starts with a slash is a route, such as /protected/*, and applies to the
+// logs of requests whose path matches it; a trailing * matches any suffix. Any other scope is a
+// logger name, such as cache, and applies to loggers with that name; see zap.Logger.Named. Route
+// overrides win over logger name overrides, and the most specific override wins. Changes can be
+// temporary, reverting on their own once their ttl has passed. Every change is logged.
+type Levels struct {
+	base    zap.AtomicLevel
+	initial zapcore.Level
+
+	mu        sync.RWMutex
+	log       *zap.Logger
+	revert    *time.Timer
+	previous  zapcore.Level
+	expires   time.Time
+	overrides map[string]*override
+}
+
+type override struct {
+	level   zapcore.Level
+	expires time.Time
+	setBy   string
+	timer   *time.Timer
+}
+
+// Override is a level override for a scope.
+type Override struct {
+	Scope   string    `json:"scope"`
+	Level   string    `json:"level"`
+	Expires time.Time `json:"expires,omitempty"`
+	SetBy   string    `json:"set_by,omitempty"`
+}
+
+// NewLevels creates a new Levels with the given base level.
+func NewLevels(base zapcore.Level) *Levels {
+	return &Levels{
+		base:      zap.NewAtomicLevelAt(base),
+		initial:   base,
+		log:       zap.NewNop(),
+		overrides: map[string]*override{},
+	}
+}
+
+// SetLogger sets the logger that level changes are logged to.
+func (l *Levels) SetLogger(log *zap.Logger) {
+	l.mu.Lock()
+	l.log = log
+	l.mu.Unlock()
+}
+
+// Level returns the base level.
+func (l *Levels) Level() zapcore.Level {
+	return l.base.Level()
+}
+
+// Expires returns when a temporary base level reverts. It is zero if the base level is permanent.
+func (l *Levels) Expires() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.expires
+}
+
+// SetLevel changes the base level. If ttl is more than zero, the change is temporary, and the level
+// reverts to what it was before once the ttl has passed. The param by says who made the change.
+func (l *Levels) SetLevel(level zapcore.Level, ttl time.Duration, by string) {
+	l.mu.Lock()
+
+	current := l.base.Level()
+	old := current
+
+	if l.revert != nil {
+		// Keep reverting to the level from before the first temporary change.
+		l.revert.Stop()
+		old = l.previous
+		l.revert = nil
+		l.expires = time.Time{}
+	}
+
+	l.base.SetLevel(level)
+
+	fields := []zap.Field{
+		zap.String("level", level.String()),
+		zap.String("previous_level", current.String()),
+		zap.String("set_by", by),
+	}
+
+	if ttl > 0 {
+		l.previous = old
+		l.expires = time.Now().Add(ttl)
+		l.revert = time.AfterFunc(ttl, func() {
+			l.mu.Lock()
+			l.base.SetLevel(old)
+			l.revert = nil
+			l.expires = time.Time{}
+			log := l.log
+			l.mu.Unlock()
+
+			log.Info("log level reverted", zap.String("level", old.String()))
+		})
+
+		fields = append(fields, zap.Duration("ttl", ttl))
+	}
+
+	log := l.log
+	l.mu.Unlock()
+
+	// Log outside the lock, since the logger checks the levels too.
+	log.Info("log level changed", fields...)
+}
+
+// SetOverride sets the level for a scope. If ttl is more than zero, the override is removed once the
+// ttl has passed. The param by says who made the change.
+func (l *Levels) SetOverride(scope string, level zapcore.Level, ttl time.Duration, by string) {
+	l.mu.Lock()
+
+	if o, ok := l.overrides[scope]; ok && o.timer != nil {
+		o.timer.Stop()
+	}
+
+	o := &override{level: level, setBy: by}
+
+	fields := []zap.Field{
+		zap.String("scope", scope),
+		zap.String("level", level.String()),
+		zap.String("set_by", by),
+	}
+
+	if ttl > 0 {
+		o.expires = time.Now().Add(ttl)
+		o.timer = time.AfterFunc(ttl, func() {
+			l.mu.Lock()
+
+			// Only remove the override if it has not been replaced since.
+			current := l.overrides[scope] == o
+			if current {
+				delete(l.overrides, scope)
+			}
+
+			log := l.log
+			l.mu.Unlock()
+
+			if current {
+				log.Info("log level override expired", zap.String("scope", scope))
+			}
+		})
+
+		fields = append(fields, zap.Duration("ttl", ttl))
+	}
+
+	l.overrides[scope] = o
+	log := l.log
+	l.mu.Unlock()
+
+	log.Info("log level override set", fields...)
+}
+
+// RemoveOverride removes the override for a scope, returning false if there was none. The param by
+// says who made the change.
+func (l *Levels) RemoveOverride(scope, by string) bool {
+	l.mu.Lock()
+
+	o, ok := l.overrides[scope]
+	if !ok {
+		l.mu.Unlock()
+		return false
+	}
+
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+
+	delete(l.overrides, scope)
+	log := l.log
+	l.mu.Unlock()
+
+	log.Info("log level override removed", zap.String("scope", scope), zap.String("set_by", by))
+
+	return true
+}
+
+// Overrides returns the current overrides, sorted by scope.
+func (l *Levels) Overrides() []Override {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	all := make([]Override, 0, len(l.overrides))
+
+	for scope, o := range l.overrides {
+		all = append(all, Override{
+			Scope:   scope,
+			Level:   o.level.String(),
+			Expires: o.expires,
+			SetBy:   o.setBy,
+		})
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Scope < all[j].Scope
+	})
+
+	return all
+}
+
+// Enabled returns true if a log at the given level should be written by the named logger, for a
+// request with the given path. Either may be empty.
+func (l *Levels) Enabled(level zapcore.Level, name, path string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.overrides) > 0 {
+		if o := l.match(name, path); o != nil {
+			return o.level.Enabled(level)
+		}
+	}
+
+	return l.base.Enabled(level)
+}
+
+// minEnabled returns true if the level is enabled by the base level or any override, so zap can
+// skip building logs no one will write.
+func (l *Levels) minEnabled(level zapcore.Level) bool {
+	if l.base.Enabled(level) {
+		return true
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, o := range l.overrides {
+		if o.level.Enabled(level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Levels) match(name, path string) *override {
+	var (
+		best      *override
+		bestScore = -1
+	)
+
+	for scope, o := range l.overrides {
+		score := -1
+
+		if strings.HasPrefix(scope, "/") {
+			if matchRoute(scope, path) {
+				// Routes win over logger names, whatever their length.
+				score = 1000 + len(scope)
+			}
+		} else if matchName(scope, name) {
+			score = len(scope)
+		}
+
+		if score > bestScore {
+			best = o
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+func matchRoute(scope, path string) bool {
+	if path == "" {
+		return false
+	}
+
+	if strings.HasSuffix(scope, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(scope, "*"))
+	}
+
+	return scope == path
+}
+
+// matchName matches a logger name, or any logger named below it, so cache matches cache.redis too.
+func matchName(scope, name string) bool {
+	return name == scope || strings.HasPrefix(name, scope+".")
+}
+
+// Core wraps a core so its logs are filtered by the levels. The core should enable every level, such
+// as a core created with zapcore.DebugLevel.
+func (l *Levels) Core(core zapcore.Core) zapcore.Core {
+	return &levelCore{Core: core, levels: l}
+}
+
+// levelCore filters the logs of the wrapped core using Levels. The wrapped core should enable every
+// level.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+	path   string
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.levels.minEnabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{
+		Core:   c.Core.With(fields),
+		levels: c.levels,
+		path:   c.path,
+	}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.levels.Enabled(ent.Level, ent.LoggerName, c.path) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+// ForRequest returns a logger that uses the route overrides matching the request path. Loggers that
+// were not created by Initialize are returned unchanged.
+func ForRequest(log *zap.Logger, path string) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if lc, ok := core.(*levelCore); ok {
+			return &levelCore{
+				Core:   lc.Core,
+				levels: lc.levels,
+				path:   path,
+			}
+		}
+
+		return core
+	}))
+}
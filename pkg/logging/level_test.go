@@ -0,0 +1,110 @@
+package logging_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+func newTestLogger(levels *logging.Levels) (*zap.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey = ""
+
+	log := zap.New(levels.Core(zapcore.NewCore(
+		zapcore.NewJSONEncoder(enc),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	)))
+
+	return log, &buf
+}
+
+func lines(buf *bytes.Buffer) []string {
+	out := strings.TrimSpace(buf.String())
+	buf.Reset()
+
+	if out == "" {
+		return nil
+	}
+
+	return strings.Split(out, "\n")
+}
+
+func TestLevels_SetLevel(t *testing.T) {
+	levels := logging.NewLevels(zapcore.InfoLevel)
+	log, buf := newTestLogger(levels)
+	levels.SetLogger(log)
+
+	log.Debug("hidden")
+	assert.Empty(t, lines(buf))
+
+	levels.SetLevel(zapcore.DebugLevel, 0, "tester")
+
+	changed := lines(buf)
+	if assert.Len(t, changed, 1) {
+		assert.Contains(t, changed[0], `"msg":"log level changed"`)
+		assert.Contains(t, changed[0], `"set_by":"tester"`)
+		assert.Contains(t, changed[0], `"previous_level":"info"`)
+	}
+
+	log.Debug("shown")
+	assert.Len(t, lines(buf), 1)
+}
+
+func TestLevels_TTL(t *testing.T) {
+	levels := logging.NewLevels(zapcore.InfoLevel)
+	log, _ := newTestLogger(levels)
+	levels.SetLogger(log)
+
+	levels.SetLevel(zapcore.DebugLevel, 20*time.Millisecond, "tester")
+	levels.SetLevel(zapcore.WarnLevel, 20*time.Millisecond, "tester")
+	assert.Equal(t, zapcore.WarnLevel, levels.Level())
+	assert.False(t, levels.Expires().IsZero())
+
+	levels.SetOverride("cache", zapcore.DebugLevel, 20*time.Millisecond, "tester")
+
+	assert.Eventually(t, func() bool {
+		return levels.Level() == zapcore.InfoLevel && len(levels.Overrides()) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	assert.True(t, levels.Expires().IsZero())
+}
+
+func TestLevels_Overrides(t *testing.T) {
+	levels := logging.NewLevels(zapcore.InfoLevel)
+	log, buf := newTestLogger(levels)
+
+	levels.SetOverride("/protected/*", zapcore.DebugLevel, 0, "tester")
+	levels.SetOverride("cache", zapcore.ErrorLevel, 0, "tester")
+
+	logging.ForRequest(log, "/protected/1").Debug("route debug")
+	logging.ForRequest(log, "/health").Debug("other route debug")
+	assert.Len(t, lines(buf), 1)
+
+	log.Named("cache").Info("cache info")
+	log.Named("cache").Named("redis").Error("cache error")
+	assert.Len(t, lines(buf), 1)
+
+	// Routes win over logger names.
+	logging.ForRequest(log, "/protected/1").Named("cache").Debug("cache debug")
+	assert.Len(t, lines(buf), 1)
+
+	assert.True(t, levels.RemoveOverride("/protected/*", "tester"))
+	assert.False(t, levels.RemoveOverride("/protected/*", "tester"))
+
+	logging.ForRequest(log, "/protected/1").Debug("route debug")
+	assert.Empty(t, lines(buf))
+
+	assert.Equal(t, []logging.Override{
+		{Scope: "cache", Level: "error", SetBy: "tester"},
+	}, levels.Overrides())
+}
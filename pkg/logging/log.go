@@ -11,17 +11,22 @@ import (
 	"github.com/rickbassham/example-go/pkg/env"
 )
 
-// Initialize creates a new JSON zap logger.
-func Initialize(c env.Config) *zap.Logger {
-	logEnc := zap.NewProductionEncoderConfig()
-	logEnc.EncodeTime = zapcore.ISO8601TimeEncoder
-	logEnc.TimeKey = "timestamp"
-
-	log := zap.New(zapcore.NewCore(
-		zapcore.NewJSONEncoder(logEnc),
-		zapcore.Lock(os.Stdout),
-		zap.NewAtomicLevel(),
-	))
+// Initialize creates a new zap logger that writes to the outputs in c, and the Levels that control
+// its level at runtime. The base level is c.LogLevel, or info if it is not a valid level. If the
+// outputs cannot be created, it returns a logger that writes JSON to stdout along with the error, so
+// the error can still be logged.
+func Initialize(c env.Config) (*zap.Logger, *Levels, error) {
+	base := zapcore.InfoLevel
+	base.UnmarshalText([]byte(c.LogLevel)) // nolint
+
+	levels := NewLevels(base)
+
+	core, err := newCore(c)
+	if err != nil {
+		core = zapcore.NewCore(jsonEncoder(), zapcore.Lock(os.Stdout), zapcore.DebugLevel)
+	}
+
+	log := zap.New(levels.Core(core))
 
 	log = log.With(
 		zap.String("app_name", c.AppName),
@@ -34,5 +39,7 @@ func Initialize(c env.Config) *zap.Logger {
 		zap.Time("start_time", time.Now()),
 	)
 
-	return log
+	levels.SetLogger(log)
+
+	return log, levels, err
 }
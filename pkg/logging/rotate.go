@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file that is rotated once it reaches MaxSize. Rotated files are renamed with
+// the time they were rotated, such as app-20060102T150405.000.log, and removed once they are older
+// than MaxAge or there are more than MaxBackups of them.
+type RotatingFile struct {
+	// Filename is the file to write to. Its directory is created if needed.
+	Filename string
+	// MaxSize is the size in bytes at which the file is rotated. If zero, it is never rotated.
+	MaxSize int64
+	// MaxAge is how long rotated files are kept. If zero, they are kept regardless of age.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept. If zero, they are kept regardless of count.
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+const rotateTimeFormat = "20060102T150405.000"
+
+// Write writes to the file, opening it first if needed, and rotating it if the write would take it
+// past MaxSize.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Sync flushes the file to disk.
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Sync()
+}
+
+// Close closes the file. It is reopened by the next Write.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close() // nolint
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	f.file = nil
+
+	if err := os.Rename(f.Filename, f.backupName(time.Now())); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	return f.removeOld()
+}
+
+// backupName returns the name of the backup rotated at t. If the file was already rotated within the
+// same millisecond, the time is moved forward until the name is free, so no backup is overwritten.
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.Filename)
+	prefix := strings.TrimSuffix(f.Filename, ext)
+
+	for {
+		name := fmt.Sprintf("%s-%s%s", prefix, t.UTC().Format(rotateTimeFormat), ext)
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// removeOld removes the rotated files past MaxAge or MaxBackups.
+func (f *RotatingFile) removeOld() error {
+	if f.MaxAge <= 0 && f.MaxBackups <= 0 {
+		return nil
+	}
+
+	ext := filepath.Ext(f.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(f.Filename), ext) + "-"
+	dir := filepath.Dir(f.Filename)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		name string
+		t    time.Time
+	}
+
+	var backups []backup
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		t, err := time.Parse(rotateTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{name: name, t: t})
+	}
+
+	// Newest first.
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].t.After(backups[j].t)
+	})
+
+	cutoff := time.Now().Add(-f.MaxAge)
+
+	for i, b := range backups {
+		if (f.MaxBackups > 0 && i >= f.MaxBackups) || (f.MaxAge > 0 && b.t.Before(cutoff)) {
+			if err := os.Remove(filepath.Join(dir, b.name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
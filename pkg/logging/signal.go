@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package logging
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// HandleSignals lets operators change the base level with signals: SIGUSR1 switches to debug for
+// the given ttl, and SIGUSR2 switches back to the level the process started with. Call the returned
+// func to stop handling the signals.
+func (l *Levels) HandleSignals(ttl time.Duration) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if sig == syscall.SIGUSR1 {
+					l.SetLevel(zapcore.DebugLevel, ttl, "signal:"+sig.String())
+				} else {
+					l.SetLevel(l.initial, 0, "signal:"+sig.String())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,8 @@
+package logging
+
+import "time"
+
+// HandleSignals does nothing on windows, which has no SIGUSR1 or SIGUSR2.
+func (l *Levels) HandleSignals(ttl time.Duration) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/env"
+)
+
+// AccessLogger is the name of the logger for the "request complete" entry of each incoming request.
+// Entries from it go to the access log, if there is one, instead of the other outputs.
+const AccessLogger = "access"
+
+// The outputs that can be listed in env.Config.LogOutputs.
+const (
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+func encoderConfig() zapcore.EncoderConfig {
+	enc := zap.NewProductionEncoderConfig()
+	enc.EncodeTime = zapcore.ISO8601TimeEncoder
+	enc.TimeKey = "timestamp"
+
+	return enc
+}
+
+// consoleEncoder is a human readable encoder with colored levels, for local development.
+func consoleEncoder() zapcore.Encoder {
+	enc := encoderConfig()
+	enc.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	enc.EncodeDuration = zapcore.StringDurationEncoder
+
+	return zapcore.NewConsoleEncoder(enc)
+}
+
+func jsonEncoder() zapcore.Encoder {
+	return zapcore.NewJSONEncoder(encoderConfig())
+}
+
+func rotatingFile(c env.Config, filename string) *RotatingFile {
+	return &RotatingFile{
+		Filename:   filename,
+		MaxSize:    int64(c.LogFileMaxSizeMB) * 1024 * 1024,
+		MaxAge:     c.LogFileMaxAge,
+		MaxBackups: c.LogFileMaxBackups,
+	}
+}
+
+// newCore creates a core that writes to every output in c.LogOutputs side by side, with stdout used if
+// there are none. Stdout is human readable when c.Environment is development; the other outputs are
+// always JSON. If c.LogAccessFile is set, the "request complete" entries from the AccessLogger go only
+// to it, as JSON.
+func newCore(c env.Config) (zapcore.Core, error) {
+	var cores []zapcore.Core
+
+	outputs := c.LogOutputs
+	if len(outputs) == 0 {
+		outputs = []string{OutputStdout}
+	}
+
+	for _, output := range outputs {
+		switch strings.TrimSpace(output) {
+		case OutputStdout:
+			enc := jsonEncoder()
+			if c.Environment == "development" {
+				enc = consoleEncoder()
+			}
+
+			cores = append(cores, zapcore.NewCore(enc, zapcore.Lock(os.Stdout), zapcore.DebugLevel))
+		case OutputFile:
+			if c.LogFile == "" {
+				return nil, fmt.Errorf("log output %q needs LOG_FILE", output)
+			}
+
+			cores = append(cores, zapcore.NewCore(jsonEncoder(), rotatingFile(c, c.LogFile), zapcore.DebugLevel))
+		case OutputSyslog:
+			core, err := newSyslogCore(jsonEncoder(), c.AppName)
+			if err != nil {
+				return nil, fmt.Errorf("error connecting to syslog: %v", err)
+			}
+
+			cores = append(cores, core)
+		default:
+			return nil, fmt.Errorf("unknown log output %q", output)
+		}
+	}
+
+	core := zapcore.NewTee(cores...)
+
+	if c.LogAccessFile != "" {
+		core = &accessCore{
+			Core:   core,
+			access: zapcore.NewCore(jsonEncoder(), rotatingFile(c, c.LogAccessFile), zapcore.DebugLevel),
+		}
+	}
+
+	return core, nil
+}
+
+// accessCore sends the entries from the AccessLogger to the access core, and everything else to the
+// wrapped core.
+type accessCore struct {
+	zapcore.Core
+	access zapcore.Core
+}
+
+func (c *accessCore) With(fields []zapcore.Field) zapcore.Core {
+	return &accessCore{
+		Core:   c.Core.With(fields),
+		access: c.access.With(fields),
+	}
+}
+
+func (c *accessCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c *accessCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.LoggerName == AccessLogger {
+		return c.access.Write(ent, fields)
+	}
+
+	return c.Core.Write(ent, fields)
+}
+
+func (c *accessCore) Sync() error {
+	err := c.Core.Sync()
+	if accessErr := c.access.Sync(); err == nil {
+		err = accessErr
+	}
+
+	return err
+}
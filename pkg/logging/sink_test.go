@@ -0,0 +1,101 @@
+package logging_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/env"
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+
+	return dir, func() { os.RemoveAll(dir) } // nolint
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	f := &logging.RotatingFile{
+		Filename:   filepath.Join(dir, "logs", "app.log"),
+		MaxSize:    10,
+		MaxBackups: 2,
+	}
+	defer f.Close() // nolint
+
+	for i := 0; i < 5; i++ {
+		_, err := f.Write([]byte("12345678\n"))
+		require.NoError(t, err)
+	}
+
+	current, err := ioutil.ReadFile(f.Filename)
+	require.NoError(t, err)
+	assert.Equal(t, "12345678\n", string(current))
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "logs"))
+	require.NoError(t, err)
+
+	var backups int
+
+	for _, file := range files {
+		if file.Name() != "app.log" {
+			backups++
+
+			assert.True(t, strings.HasPrefix(file.Name(), "app-"), file.Name())
+			assert.True(t, strings.HasSuffix(file.Name(), ".log"), file.Name())
+		}
+	}
+
+	assert.Equal(t, 2, backups)
+}
+
+func TestInitialize_FileAndAccessLog(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	c := env.Config{
+		AppName:       "test",
+		LogLevel:      "info",
+		LogOutputs:    []string{"file"},
+		LogFile:       filepath.Join(dir, "app.log"),
+		LogAccessFile: filepath.Join(dir, "access.log"),
+	}
+
+	log, _, err := logging.Initialize(c)
+	require.NoError(t, err)
+
+	log.Info("starting")
+	log.Named(logging.AccessLogger).Info("request complete")
+	log.Debug("not enabled")
+	require.NoError(t, log.Sync())
+
+	app, err := ioutil.ReadFile(c.LogFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(app), `"msg":"starting"`)
+	assert.Contains(t, string(app), `"app_name":"test"`)
+	assert.NotContains(t, string(app), "request complete")
+	assert.NotContains(t, string(app), "not enabled")
+
+	access, err := ioutil.ReadFile(c.LogAccessFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(access), `"msg":"request complete"`)
+	assert.NotContains(t, string(access), "starting")
+}
+
+func TestInitialize_InvalidOutput(t *testing.T) {
+	log, _, err := logging.Initialize(env.Config{LogOutputs: []string{"kafka"}})
+	assert.EqualError(t, err, `unknown log output "kafka"`)
+	assert.NotNil(t, log)
+
+	_, _, err = logging.Initialize(env.Config{LogOutputs: []string{"stdout", "file"}})
+	assert.EqualError(t, err, `log output "file" needs LOG_FILE`)
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SlowThresholds decide the level an operation, such as a redis command or sql statement, is logged
+// at based on how long it took. A zero threshold is never reached.
+type SlowThresholds struct {
+	// Warn is the duration above which the operation is logged at warn.
+	Warn time.Duration
+	// Error is the duration above which the operation is logged at error.
+	Error time.Duration
+}
+
+// Level returns the level to log an operation that took d at: info, or warn or error if it took
+// longer than the matching threshold.
+func (t SlowThresholds) Level(d time.Duration) zapcore.Level {
+	switch {
+	case t.Error > 0 && d > t.Error:
+		return zapcore.ErrorLevel
+	case t.Warn > 0 && d > t.Warn:
+		return zapcore.WarnLevel
+	}
+
+	return zapcore.InfoLevel
+}
+
+// IsSlow returns true if an operation that took d reached either threshold.
+func (t SlowThresholds) IsSlow(d time.Duration) bool {
+	return t.Level(d) > zapcore.InfoLevel
+}
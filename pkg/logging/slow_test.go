@@ -0,0 +1,23 @@
+package logging_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/logging"
+)
+
+func TestSlowThresholds(t *testing.T) {
+	s := logging.SlowThresholds{Warn: 100 * time.Millisecond, Error: time.Second}
+
+	assert.Equal(t, zapcore.InfoLevel, s.Level(50*time.Millisecond))
+	assert.Equal(t, zapcore.WarnLevel, s.Level(200*time.Millisecond))
+	assert.Equal(t, zapcore.ErrorLevel, s.Level(2*time.Second))
+	assert.False(t, s.IsSlow(100*time.Millisecond))
+	assert.True(t, s.IsSlow(101*time.Millisecond))
+
+	assert.Equal(t, zapcore.InfoLevel, logging.SlowThresholds{}.Level(time.Hour))
+}
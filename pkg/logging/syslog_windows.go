@@ -0,0 +1,12 @@
+package logging
+
+import (
+	"errors"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// newSyslogCore always fails on windows, which has no syslog.
+func newSyslogCore(enc zapcore.Encoder, tag string) (zapcore.Core, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
@@ -0,0 +1,380 @@
+// Package metrics is a small metrics registry that can be scraped by Prometheus, using the text
+// exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds. They suit most request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	metricName() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds every metric exposed by the service.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: map[string]collector{},
+	}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.metricName()]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", c.metricName()))
+	}
+
+	r.collectors[c.metricName()] = c
+}
+
+// NewCounterVec registers a new counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labels)}
+	r.register(c)
+
+	return c
+}
+
+// NewHistogramVec registers a new histogram with the given buckets and label names. If buckets is
+// nil, DefBuckets is used.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{vec: newVec(name, help, labels), buckets: buckets}
+	r.register(h)
+
+	return h
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn each time the metrics are scraped.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{name: name, help: help, fn: fn})
+}
+
+// Write writes every metric to w in the Prometheus text exposition format, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		r.Write(w) // nolint
+	})
+}
+
+// StatusClass groups an http status code into its class, such as 2xx, to keep label cardinality low.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// vec holds the series of a metric, keyed by their label values.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+
+	mu      sync.Mutex
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: map[string]*series{},
+	}
+}
+
+func (v *vec) metricName() string {
+	return v.name
+}
+
+func (v *vec) get(values []string, buckets int) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string(nil), values...),
+			buckets:     make([]uint64, buckets),
+		}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+// sorted returns the series ordered by their label values, so the output is stable.
+func (v *vec) sorted() []*series {
+	v.mu.Lock()
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	all := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		all = append(all, v.series[k])
+	}
+
+	v.mu.Unlock()
+
+	return all
+}
+
+func (v *vec) writeHeader(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, typ)
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	vec
+}
+
+// Counter is a single series of a CounterVec.
+type Counter struct {
+	s *series
+}
+
+// WithLabelValues returns the counter for the given label values, in the order the labels were
+// registered.
+func (c *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{s: c.get(values, 0)}
+}
+
+// Inc adds one to the counter.
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v to the counter. Negative values are ignored, since counters only go up.
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+
+	c.s.mu.Lock()
+	c.s.value += v
+	c.s.mu.Unlock()
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w, "counter")
+
+	for _, s := range c.sorted() {
+		s.mu.Lock()
+		value := s.value
+		s.mu.Unlock()
+
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues, "", ""), formatFloat(value))
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// Histogram is a single series of a HistogramVec.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// WithLabelValues returns the histogram for the given label values, in the order the labels were
+// registered.
+func (h *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return Histogram{s: h.get(values, len(h.buckets)), buckets: h.buckets}
+}
+
+// Observe records a single value, such as a duration in seconds.
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.s.mu.Lock()
+
+	if i < len(h.buckets) {
+		h.s.buckets[i]++
+	}
+
+	h.s.count++
+	h.s.value += v
+
+	h.s.mu.Unlock()
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+
+	for _, s := range h.sorted() {
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.buckets...)
+		count := s.count
+		sum := s.value
+		s.mu.Unlock()
+
+		var cumulative uint64
+
+		for i, upper := range h.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues, "", ""), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "", ""), count)
+	}
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gaugeFunc) metricName() string {
+	return g.name
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeSingle(w, g.name, g.help, "gauge", g.fn())
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteByte('{')
+
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,94 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/metrics"
+)
+
+func TestCounterVec(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.NewCounterVec("requests_total", "Number of requests.", "method", "path")
+
+	c.WithLabelValues("GET", "/b").Inc()
+	c.WithLabelValues("GET", "/a").Add(2)
+	c.WithLabelValues("GET", "/a").Add(-1)
+	c.WithLabelValues("POST", "say \"hi\"\n").Inc()
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.Write(&buf))
+
+	assert.Equal(t, `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/a"} 2
+requests_total{method="GET",path="/b"} 1
+requests_total{method="POST",path="say \"hi\"\n"} 1
+`, buf.String())
+}
+
+func TestHistogramVec(t *testing.T) {
+	reg := metrics.NewRegistry()
+	h := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+
+	h.WithLabelValues("/").Observe(0.05)
+	h.WithLabelValues("/").Observe(0.1)
+	h.WithLabelValues("/").Observe(0.5)
+	h.WithLabelValues("/").Observe(3)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.Write(&buf))
+
+	assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/",le="0.1"} 2
+latency_seconds_bucket{route="/",le="1"} 3
+latency_seconds_bucket{route="/",le="+Inf"} 4
+latency_seconds_sum{route="/"} 3.65
+latency_seconds_count{route="/"} 4
+`, buf.String())
+}
+
+func TestRegistry_SortedAndUnique(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.NewGaugeFunc("b_gauge", "B.", func() float64 { return 2 })
+	reg.NewGaugeFunc("a_gauge", "A.", func() float64 { return 1 })
+
+	assert.Panics(t, func() {
+		reg.NewCounterVec("a_gauge", "duplicate")
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.Write(&buf))
+
+	assert.Equal(t, `# HELP a_gauge A.
+# TYPE a_gauge gauge
+a_gauge 1
+# HELP b_gauge B.
+# TYPE b_gauge gauge
+b_gauge 2
+`, buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.RegisterRuntime()
+
+	w := httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "# TYPE go_goroutines gauge\n")
+	assert.Contains(t, w.Body.String(), "go_info{version=\"go")
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", metrics.StatusClass(204))
+	assert.Equal(t, "5xx", metrics.StatusClass(503))
+	assert.Equal(t, "unknown", metrics.StatusClass(0))
+}
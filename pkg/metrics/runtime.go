@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// RegisterRuntime registers the Go runtime stats: goroutines, memory, garbage collection and the Go
+// version. The memory stats are read once per scrape.
+func (r *Registry) RegisterRuntime() {
+	r.register(&runtimeCollector{start: time.Now()})
+}
+
+type runtimeCollector struct {
+	start time.Time
+}
+
+func (c *runtimeCollector) metricName() string {
+	return "go_goroutines"
+}
+
+func (c *runtimeCollector) write(w *bufio.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	writeSingle(w, "go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine()))
+	writeSingle(w, "go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(ms.Alloc))
+	writeSingle(w, "go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge", float64(ms.HeapInuse))
+	writeSingle(w, "go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(ms.HeapObjects))
+	writeSingle(w, "go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge", float64(ms.Sys))
+	writeSingle(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(ms.NumGC))
+	writeSingle(w, "go_gc_pause_seconds_total", "Total time the GC has paused the program.", "counter", float64(ms.PauseTotalNs)/float64(time.Second))
+
+	fmt.Fprintf(w, "# HELP go_info Information about the Go environment.\n")
+	fmt.Fprintf(w, "# TYPE go_info gauge\n")
+	fmt.Fprintf(w, "go_info{version=\"%s\"} 1\n", escapeLabelValue(runtime.Version()))
+
+	writeSingle(w, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge", float64(c.start.Unix()))
+}
+
+func writeSingle(w *bufio.Writer, name, help, typ string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
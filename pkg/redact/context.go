@@ -0,0 +1,28 @@
+package redact
+
+import "context"
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return "context key: " + string(k)
+}
+
+var (
+	policyKey = contextKey("policy")
+)
+
+// WithPolicy adds the policy to the request context.
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	return context.WithValue(ctx, policyKey, p)
+}
+
+// FromContext retrieves the policy from the context. If there is no policy on the context, it will
+// return the Default policy, so data is never logged unmasked.
+func FromContext(ctx context.Context) *Policy {
+	if val, ok := ctx.Value(policyKey).(*Policy); ok && val != nil {
+		return val
+	}
+
+	return Default()
+}
@@ -0,0 +1,311 @@
+// Package redact masks secrets and personal data before they are written to logs or telemetry. One
+// Policy is shared by everything that logs or reports request data, so data is masked the same way
+// everywhere.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted is the text shown in place of sensitive data.
+const Redacted = "[REDACTED]"
+
+var (
+	// DefaultKeys are the key names that are always sensitive. Keys are compared without case or
+	// punctuation, and match if they contain one of these, so api_key, apiKey and X-Api-Key all
+	// match apikey.
+	DefaultKeys = []string{
+		"password", "passwd", "secret", "token", "apikey", "authorization", "cookie", "session",
+		"credential", "privatekey", "ssn",
+	}
+
+	// DefaultPatterns match sensitive data wherever it appears: JWTs, email addresses and card
+	// numbers.
+	DefaultPatterns = []string{
+		`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		`\b(?:\d[ -]?){12,18}\d\b`,
+	}
+
+	// DefaultHeaders are the headers whose values are always sensitive.
+	DefaultHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+	}
+)
+
+// Options configures a Policy. They are added to the defaults, which cannot be removed.
+type Options struct {
+	// Keys are sensitive key names, such as query params, url params, form fields and attribute
+	// names.
+	Keys []string
+	// Patterns are regular expressions that match sensitive data in any value.
+	Patterns []string
+	// Headers are sensitive header names.
+	Headers []string
+}
+
+// Policy decides what is sensitive, and masks it.
+type Policy struct {
+	keys     []string
+	patterns []*regexp.Regexp
+	headers  map[string]struct{}
+}
+
+// New creates a new Policy from the defaults and the options. It returns an error if a pattern does
+// not compile.
+func New(o Options) (*Policy, error) {
+	p := &Policy{
+		headers: map[string]struct{}{},
+	}
+
+	for _, k := range append(append([]string(nil), DefaultKeys...), o.Keys...) {
+		if k = normalize(k); k != "" {
+			p.keys = append(p.keys, k)
+		}
+	}
+
+	for _, expr := range append(append([]string(nil), DefaultPatterns...), o.Patterns...) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", expr, err)
+		}
+
+		p.patterns = append(p.patterns, re)
+	}
+
+	for _, h := range append(append([]string(nil), DefaultHeaders...), o.Headers...) {
+		p.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	return p, nil
+}
+
+var defaultPolicy, _ = New(Options{})
+
+// Default returns the Policy with only the defaults.
+func Default() *Policy {
+	return defaultPolicy
+}
+
+// normalize lower cases the key and removes everything but letters and digits.
+func normalize(key string) string {
+	var b strings.Builder
+
+	for _, c := range strings.ToLower(key) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// IsSensitiveKey returns true if values with this key name should be hidden.
+func (p *Policy) IsSensitiveKey(key string) bool {
+	key = normalize(key)
+	if key == "" {
+		return false
+	}
+
+	for _, k := range p.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSensitiveHeader returns true if the values of this header should be hidden.
+func (p *Policy) IsSensitiveHeader(name string) bool {
+	_, ok := p.headers[http.CanonicalHeaderKey(name)]
+	return ok || p.IsSensitiveKey(name)
+}
+
+// String masks every match of the patterns in s.
+func (p *Policy) String(s string) string {
+	for _, re := range p.patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+
+	return s
+}
+
+// Value masks the value of the key. The whole value is hidden if the key is sensitive; otherwise
+// only the matches of the patterns are.
+func (p *Policy) Value(key, value string) string {
+	if value != "" && p.IsSensitiveKey(key) {
+		return Redacted
+	}
+
+	return p.String(value)
+}
+
+// Query masks a raw query string, keeping the order of its params.
+func (p *Policy) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	parts := strings.Split(raw, "&")
+
+	for i, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			parts[i] = p.String(part)
+			continue
+		}
+
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			value = kv[1]
+		}
+
+		masked := p.Value(key, value)
+		if masked != value {
+			kv[1] = url.QueryEscape(masked)
+		}
+
+		parts[i] = kv[0] + "=" + kv[1]
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// URL masks the password, path and query of a url. A url that does not parse is masked with String.
+func (p *Policy) URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return p.String(raw)
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+
+	if masked := p.String(u.Path); masked != u.Path {
+		u.Path = masked
+		u.RawPath = ""
+	}
+
+	u.RawQuery = p.Query(u.RawQuery)
+
+	return u.String()
+}
+
+// Body masks a request or response body. JSON bodies have the values of sensitive keys hidden,
+// form bodies are masked like a query string, and anything else, including JSON that was truncated
+// and no longer parses, is masked with String.
+func (p *Policy) Body(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+
+		if err := json.Unmarshal(body, &v); err == nil {
+			if masked, err := json.Marshal(p.json("", v)); err == nil {
+				return string(masked)
+			}
+		}
+
+		// Still hide the values of sensitive keys in JSON that was truncated.
+		return p.String(jsonMember.ReplaceAllStringFunc(string(body), func(m string) string {
+			sub := jsonMember.FindStringSubmatch(m)
+			if !p.IsSensitiveKey(sub[1]) {
+				return m
+			}
+
+			return `"` + sub[1] + `":"` + Redacted + `"`
+		}))
+	case mediaType == "application/x-www-form-urlencoded":
+		return p.Query(string(body))
+	}
+
+	return p.String(string(body))
+}
+
+// jsonMember matches a JSON object member, even if its value was cut short.
+var jsonMember = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+
+func (p *Policy) json(key string, v interface{}) interface{} {
+	if key != "" && p.IsSensitiveKey(key) {
+		return Redacted
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			val[k] = p.json(k, child)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = p.json("", child)
+		}
+	case string:
+		return p.String(val)
+	}
+
+	return v
+}
+
+// Header returns a copy of the header with the sensitive values masked.
+func (p *Policy) Header(h http.Header) http.Header {
+	masked := make(http.Header, len(h))
+
+	for name, values := range h {
+		masked[name] = make([]string, len(values))
+
+		for i, v := range values {
+			if p.IsSensitiveHeader(name) {
+				masked[name][i] = Redacted
+			} else {
+				masked[name][i] = p.String(v)
+			}
+		}
+	}
+
+	return masked
+}
+
+// Args formats the arguments of a command, such as a redis command or sql statement, masking them.
+// An argument that follows a sensitive key name, such as the value in HSET user password hunter2,
+// is hidden.
+func (p *Policy) Args(args []interface{}) []string {
+	out := make([]string, len(args))
+
+	for i, arg := range args {
+		var s string
+
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			out[i] = p.String(fmt.Sprintf("%#v", arg))
+			continue
+		}
+
+		if i > 0 && p.IsSensitiveKey(fmt.Sprint(args[i-1])) {
+			s = Redacted
+		} else {
+			s = p.String(s)
+		}
+
+		out[i] = fmt.Sprintf("%#v", s)
+	}
+
+	return out
+}
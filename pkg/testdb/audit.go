@@ -0,0 +1,106 @@
+package testdb
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/rickbassham/example-go/pkg/audit"
+)
+
+// auditEvent is a row of the audit_events table. It is append-only: there are no statements to
+// update or delete its rows.
+type auditEvent struct {
+	ID         string    `db:"id"`
+	Time       time.Time `db:"time"`
+	Type       string    `db:"type"`
+	Action     string    `db:"action"`
+	Outcome    string    `db:"outcome"`
+	Reason     string    `db:"reason"`
+	Principal  string    `db:"principal"`
+	AuthMethod string    `db:"auth_method"`
+	TenantID   string    `db:"tenant_id"`
+	TraceID    string    `db:"trace_id"`
+	ClientIP   string    `db:"client_ip"`
+	Resource   string    `db:"resource"`
+	Details    string    `db:"details"`
+}
+
+func init() {
+	statements["audit_event_insert"] = "INSERT INTO audit_events (id, time, type, action, outcome, reason, principal, auth_method, tenant_id, trace_id, client_ip, resource, details) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	statements["audit_event_select"] = "SELECT id, time, type, action, outcome, reason, principal, auth_method, tenant_id, trace_id, client_ip, resource, details FROM audit_events WHERE (? = '' OR principal = ?) AND (? = '' OR type = ?) AND (? IS NULL OR time >= ?) AND (? IS NULL OR time < ?) ORDER BY time DESC LIMIT ?"
+
+	unscoped["audit_event_insert"] = true
+	unscoped["audit_event_select"] = true
+}
+
+// WriteEvent inserts the event into the audit_events table, with its details as JSON. It makes DB an
+// audit.Sink.
+func (db *DB) WriteEvent(ctx context.Context, e audit.Event) error {
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.Insert(ctx, "audit_event_insert",
+		e.ID, e.Time, e.Type, e.Action, e.Outcome, e.Reason, e.Principal, e.AuthMethod, e.Tenant,
+		e.TraceID, e.ClientIP, e.Resource, string(details),
+	)
+
+	return err
+}
+
+// Events returns the events in the audit_events table selected by the filter, newest first, from
+// every tenant. It makes DB an audit.Store.
+func (db *DB) Events(ctx context.Context, f audit.Filter) ([]audit.Event, error) {
+	var rows []auditEvent
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+
+	err := db.db.Select(ctx, &rows, "audit_event_select",
+		f.Principal, f.Principal, f.Type, f.Type, nullTime(f.From), nullTime(f.From), nullTime(f.To), nullTime(f.To), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]audit.Event, 0, len(rows))
+
+	for _, row := range rows {
+		e := audit.Event{
+			ID:         row.ID,
+			Time:       row.Time,
+			Type:       row.Type,
+			Action:     row.Action,
+			Outcome:    row.Outcome,
+			Reason:     row.Reason,
+			Principal:  row.Principal,
+			AuthMethod: row.AuthMethod,
+			Tenant:     row.TenantID,
+			TraceID:    row.TraceID,
+			ClientIP:   row.ClientIP,
+			Resource:   row.Resource,
+		}
+
+		if err := json.Unmarshal([]byte(row.Details), &e.Details); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// nullTime returns nil for the zero time, so it matches the IS NULL of an open ended range.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
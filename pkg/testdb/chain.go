@@ -0,0 +1,37 @@
+package testdb
+
+import (
+	"context"
+
+	"gogs.rickbassham.com/rick/database"
+)
+
+// chain runs the middleware as one. The database stops at the first After that returns an error,
+// which would leave the spans and segments of the rest open and their errors unrecorded, so every
+// After is run with the error of the statement, which is then returned. If a Before fails, the After
+// of each middleware that was already started is run with its error.
+type chain []database.Middleware
+
+// Before runs the Before of each middleware in order.
+func (c chain) Before(ctx context.Context, name, statement string, args ...interface{}) (context.Context, error) {
+	for i, mw := range c {
+		next, err := mw.Before(ctx, name, statement, args...)
+		if err != nil {
+			c[:i].After(ctx, err, name, statement, args...) // nolint
+			return ctx, err
+		}
+
+		ctx = next
+	}
+
+	return ctx, nil
+}
+
+// After runs the After of every middleware, and returns the error of the statement.
+func (c chain) After(ctx context.Context, err error, name, statement string, args ...interface{}) error {
+	for _, mw := range c {
+		mw.After(ctx, err, name, statement, args...) // nolint
+	}
+
+	return err
+}
@@ -0,0 +1,65 @@
+package testdb
+
+import (
+	"context"
+
+	"github.com/rickbassham/example-go/pkg/auth"
+)
+
+func init() {
+	statements["user_credentials_select"] = "SELECT username, password_hash FROM users WHERE username = ? AND deleted_at IS NULL AND password_hash IS NOT NULL AND tenant_id = ?"
+	statements["user_password_update"] = "UPDATE users SET password_hash = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL AND tenant_id = ?"
+}
+
+type credentials struct {
+	Username     string `db:"username"`
+	PasswordHash string `db:"password_hash"`
+}
+
+// Credentials returns the username and password hash of the active user with the username, in the
+// tenant on the context. Users without a password, or without a tenant to look them up in, cannot
+// log in. It makes DB an auth.CredentialStore.
+func (db *DB) Credentials(ctx context.Context, username string) (string, string, error) {
+	var found []credentials
+
+	args, err := tenantArgs(ctx, username)
+	if err != nil {
+		return "", "", auth.ErrUserNotFound
+	}
+
+	err = db.db.Select(ctx, &found, "user_credentials_select", args...)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(found) == 0 {
+		return "", "", auth.ErrUserNotFound
+	}
+
+	return found[0].Username, found[0].PasswordHash, nil
+}
+
+// SetPassword stores the hash of the password for the user with the id, in the tenant on the
+// context; see auth.HashPassword.
+func (db *DB) SetPassword(ctx context.Context, id int, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	args, err := tenantArgs(ctx, hash, auditUser(ctx), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := db.db.Update(ctx, "user_password_update", args...)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return auth.ErrUserNotFound
+	}
+
+	return nil
+}
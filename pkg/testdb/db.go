@@ -1,27 +1,32 @@
 package testdb
 
 import (
+	"context"
 	"time"
 
 	"gogs.rickbassham.com/rick/database"
+
+	"github.com/rickbassham/example-go/pkg/identity"
 )
 
 var (
-	statements map[string]string
+	statements = map[string]string{}
 )
 
 type DB struct {
 	db *database.Database
 }
 
-func New(db *database.Database) (*DB, error) {
+// New creates a new DB that logs every statement with the given Logger. Every statement is scoped to
+// the tenant on the context; see Tenancy. Any extra middleware, such as Metrics, is added after the
+// default ones. Every middleware sees the outcome of every statement, even when it fails.
+func New(db *database.Database, log Logger, mw ...database.Middleware) (*DB, error) {
 	err := initializeStatements(db)
 	if err != nil {
 		return nil, err
 	}
 
-	db.With(Logger{})
-	db.With(NewRelic{})
+	db.With(append(chain{Tenancy{}, Tracing{}, log, Instrumentation{}}, mw...))
 
 	return &DB{
 		db: db,
@@ -39,6 +44,13 @@ func initializeStatements(db *database.Database) error {
 	return nil
 }
 
+// auditUser returns who is making the change, for the created_by, updated_by and deleted_by
+// columns: the id of the principal on the context; see identity.Principal.ID.
+func auditUser(ctx context.Context) string {
+	p, _ := identity.PrincipalFromContext(ctx)
+	return p.ID()
+}
+
 type Entity struct {
 	ID        int        `db:"id"`
 	CreatedAt time.Time  `db:"created_at"`
@@ -0,0 +1,132 @@
+package testdb_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gogs.rickbassham.com/rick/database"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/metrics"
+	"github.com/rickbassham/example-go/pkg/testdb"
+)
+
+var errStatement = errors.New("table is locked")
+
+// failingDriver prepares every statement, and fails every one it runs with errStatement.
+type failingDriver struct{}
+
+func (failingDriver) Open(name string) (driver.Conn, error) { return failingConn{}, nil }
+
+type failingConn struct{}
+
+func (failingConn) Prepare(query string) (driver.Stmt, error) { return failingStmt{}, nil }
+func (failingConn) Close() error                              { return nil }
+func (failingConn) Begin() (driver.Tx, error)                 { return nil, errStatement }
+
+type failingStmt struct{}
+
+func (failingStmt) Close() error                                    { return nil }
+func (failingStmt) NumInput() int                                   { return -1 }
+func (failingStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, errStatement }
+func (failingStmt) Query(args []driver.Value) (driver.Rows, error)  { return nil, errStatement }
+
+// planDriver answers every query with a single row of an EXPLAIN plan.
+type planDriver struct{}
+
+func (planDriver) Open(name string) (driver.Conn, error) { return planConn{}, nil }
+
+type planConn struct{}
+
+func (planConn) Prepare(query string) (driver.Stmt, error) { return planStmt{}, nil }
+func (planConn) Close() error                              { return nil }
+func (planConn) Begin() (driver.Tx, error)                 { return nil, errStatement }
+
+type planStmt struct{}
+
+func (planStmt) Close() error                                    { return nil }
+func (planStmt) NumInput() int                                   { return -1 }
+func (planStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, errStatement }
+func (planStmt) Query(args []driver.Value) (driver.Rows, error)  { return &planRows{}, nil }
+
+type planRows struct{ done bool }
+
+func (*planRows) Columns() []string { return []string{"id", "table", "rows"} }
+func (*planRows) Close() error      { return nil }
+
+func (r *planRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	dest[0], dest[1], dest[2] = int64(1), []byte("users"), int64(42)
+
+	return nil
+}
+
+func init() {
+	sql.Register("testdb_failing", failingDriver{})
+	sql.Register("testdb_plan", planDriver{})
+}
+
+func TestSQLExplainer(t *testing.T) {
+	conn, err := sql.Open("testdb_plan", "")
+	require.NoError(t, err)
+
+	defer conn.Close() // nolint
+
+	plan, err := testdb.SQLExplainer{DB: conn}.Explain(context.Background(), "SELECT id FROM users")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id=1 table=users rows=42"}, plan)
+
+	failing, err := sql.Open("testdb_failing", "")
+	require.NoError(t, err)
+
+	defer failing.Close() // nolint
+
+	_, err = testdb.SQLExplainer{DB: failing}.Explain(context.Background(), "SELECT id FROM users")
+	assert.Equal(t, errStatement, err)
+}
+
+func TestDB_FailedStatement(t *testing.T) {
+	conn, err := sqlx.Open("testdb_failing", "")
+	require.NoError(t, err)
+
+	defer conn.Close() // nolint
+
+	d, err := database.New(conn)
+	require.NoError(t, err)
+
+	reg := metrics.NewRegistry()
+
+	db, err := testdb.New(d, testdb.Logger{}, testdb.NewMetrics(reg))
+	require.NoError(t, err)
+
+	ctx, buf, app := newTestContext()
+	ctx = identity.WithTenant(ctx, "acme")
+
+	_, err = db.InsertUser(ctx, "rick")
+	assert.Equal(t, errStatement, err)
+
+	// Every middleware after the first saw the failure.
+	txn := app.Transactions()[0]
+	assert.Equal(t, []error{errStatement}, txn.Errors())
+	require.Len(t, txn.Segments(), 1)
+	assert.True(t, txn.Segments()[0].Ended())
+
+	assert.Contains(t, buf.String(), `"msg":"sql statement complete"`)
+	assert.Contains(t, buf.String(), `"error":"table is locked"`)
+
+	var out bytes.Buffer
+	require.NoError(t, reg.Write(&out))
+	assert.Contains(t, out.String(), `sql_statement_errors_total{statement="user_insert"} 1`)
+}
@@ -0,0 +1,40 @@
+package testdb
+
+import (
+	"context"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+)
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return "context key: " + string(k)
+}
+
+var (
+	segmentKey = contextKey("segment")
+)
+
+type Instrumentation struct {
+}
+
+func (l Instrumentation) Before(ctx context.Context, name, statement string, args ...interface{}) (context.Context, error) {
+	s := instrumentation.FromContext(ctx).StartDatastoreSegment(instrumentation.Datastore{
+		Product:   instrumentation.DatastoreMySQL,
+		Operation: name,
+		Query:     statement,
+	})
+
+	ctx = context.WithValue(ctx, segmentKey, s)
+
+	return ctx, nil
+}
+
+func (l Instrumentation) After(ctx context.Context, err error, name, statement string, args ...interface{}) error {
+	if s, ok := ctx.Value(segmentKey).(instrumentation.Segment); ok {
+		s.End()
+	}
+
+	return err
+}
@@ -2,25 +2,141 @@ package testdb
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
+	"github.com/rickbassham/example-go/pkg/instrumentation"
 	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/redact"
 )
 
+var (
+	logStartKey = contextKey("log_start")
+)
+
+// Explainer returns the plan of a slow statement, one entry per row; see SQLExplainer.
+type Explainer interface {
+	Explain(ctx context.Context, statement string, args ...interface{}) ([]string, error)
+}
+
+// Querier runs a query, such as a *sql.DB or *sqlx.DB.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// SQLExplainer is an Explainer that runs EXPLAIN for the statement on the database. It should not be
+// a database.Database, so the EXPLAIN is not logged and explained itself.
+type SQLExplainer struct {
+	DB Querier
+}
+
+// Logger is a database middleware that logs every sql statement, with a logger named testdb. Arguments
+// are masked with the redaction policy on the context; see redact.FromContext. Each completed
+// statement is logged with its duration, at the level chosen by the Slow thresholds. A failed
+// statement is logged at error with the error, which is also noticed on the transaction in the
+// context. If Explain is set, the EXPLAIN plan of each slow statement is logged with it.
 type Logger struct {
+	Slow    logging.SlowThresholds
+	Explain Explainer
 }
 
+// Before logs the statement, and records when it started.
 func (l Logger) Before(ctx context.Context, name, statement string, args ...interface{}) (context.Context, error) {
-	log := logging.FromContext(ctx)
-	log.Info("executing sql statement", zap.String("sql_statement_name", name))
+	log := logging.FromContext(ctx).Named("testdb")
+	log.Info("executing sql statement",
+		zap.String("sql_statement_name", name),
+		zap.Strings("sql_args", redact.FromContext(ctx).Args(args)),
+	)
 
-	return ctx, nil
+	return context.WithValue(ctx, logStartKey, time.Now()), nil
 }
 
+// After logs the outcome of the statement, and returns its error.
 func (l Logger) After(ctx context.Context, err error, name, statement string, args ...interface{}) error {
-	log := logging.FromContext(ctx)
-	log.Info("sql statement complete", zap.String("sql_statement_name", name))
+	log := logging.FromContext(ctx).Named("testdb")
+
+	fields := []zap.Field{zap.String("sql_statement_name", name)}
+	level := zapcore.InfoLevel
+
+	if start, ok := ctx.Value(logStartKey).(time.Time); ok {
+		d := time.Since(start)
+		level = l.Slow.Level(d)
+
+		fields = append(fields, zap.Duration("duration", d), zap.Bool("slow", l.Slow.IsSlow(d)))
+
+		if l.Explain != nil && l.Slow.IsSlow(d) {
+			plan, explainErr := l.Explain.Explain(ctx, statement, args...)
+			if explainErr != nil {
+				fields = append(fields, zap.NamedError("explain_error", explainErr))
+			} else {
+				fields = append(fields, zap.Strings("sql_explain", plan))
+			}
+		}
+	}
+
+	if err != nil {
+		level = zapcore.ErrorLevel
+		fields = append(fields, zap.Error(err))
+
+		instrumentation.FromContext(ctx).NoticeError(err)
+	}
+
+	if ce := log.Check(level, "sql statement complete"); ce != nil {
+		ce.Write(fields...)
+	}
+
+	return err
+}
+
+// Explain runs EXPLAIN for the statement, and returns each row of the plan formatted as
+// column=value pairs.
+func (e SQLExplainer) Explain(ctx context.Context, statement string, args ...interface{}) ([]string, error) {
+	rows, err := e.DB.QueryContext(ctx, "EXPLAIN "+statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []string
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		var row string
+
+		for i, c := range columns {
+			if i > 0 {
+				row += " "
+			}
+
+			v := values[i]
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+
+			row += fmt.Sprintf("%s=%v", c, v)
+		}
+
+		plan = append(plan, row)
+	}
 
-	return nil
+	return plan, rows.Err()
 }
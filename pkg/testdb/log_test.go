@@ -0,0 +1,118 @@
+package testdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rickbassham/example-go/pkg/instrumentation"
+	"github.com/rickbassham/example-go/pkg/logging"
+	"github.com/rickbassham/example-go/pkg/testdb"
+)
+
+func newTestContext() (context.Context, *bytes.Buffer, *instrumentation.Memory) {
+	var buf bytes.Buffer
+
+	log := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	))
+
+	app := instrumentation.NewMemory()
+	txn, _ := app.StartTransaction("test", nil, nil)
+
+	ctx := logging.WithLogger(context.Background(), log)
+	ctx = instrumentation.NewContext(ctx, txn)
+
+	return ctx, &buf, app
+}
+
+func TestLogger_Error(t *testing.T) {
+	ctx, buf, app := newTestContext()
+	l := testdb.Logger{}
+
+	ctx, err := l.Before(ctx, "user_insert", "INSERT INTO users (username) VALUES (?)", "rick")
+	assert.NoError(t, err)
+
+	dbErr := errors.New("duplicate entry")
+	err = l.After(ctx, dbErr, "user_insert", "INSERT INTO users (username) VALUES (?)", "rick")
+	assert.Equal(t, dbErr, err)
+
+	assert.Contains(t, buf.String(), `"level":"error","ts"`)
+	assert.Contains(t, buf.String(), `"msg":"sql statement complete","sql_statement_name":"user_insert","duration":`)
+	assert.Contains(t, buf.String(), `"error":"duplicate entry"`)
+	assert.Equal(t, []error{dbErr}, app.Transactions()[0].Errors())
+}
+
+func TestLogger_Slow(t *testing.T) {
+	ctx, buf, app := newTestContext()
+	l := testdb.Logger{Slow: logging.SlowThresholds{Warn: time.Millisecond}}
+
+	ctx, err := l.Before(ctx, "user_select_active", "SELECT id FROM users")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	err = l.After(ctx, nil, "user_select_active", "SELECT id FROM users")
+	assert.NoError(t, err)
+
+	assert.Contains(t, buf.String(), `"level":"warn"`)
+	assert.Contains(t, buf.String(), `"slow":true`)
+	assert.Empty(t, app.Transactions()[0].Errors())
+}
+
+type fakeExplainer struct {
+	plan []string
+	err  error
+}
+
+func (e fakeExplainer) Explain(ctx context.Context, statement string, args ...interface{}) ([]string, error) {
+	return e.plan, e.err
+}
+
+func TestLogger_Explain(t *testing.T) {
+	ctx, buf, _ := newTestContext()
+	l := testdb.Logger{
+		Slow:    logging.SlowThresholds{Warn: time.Millisecond},
+		Explain: fakeExplainer{plan: []string{"id=1 select_type=SIMPLE table=users type=ALL"}},
+	}
+
+	ctx, err := l.Before(ctx, "user_select_active", "SELECT id FROM users")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	err = l.After(ctx, nil, "user_select_active", "SELECT id FROM users")
+	assert.NoError(t, err)
+
+	assert.Contains(t, buf.String(), `"slow":true,"sql_explain":["id=1 select_type=SIMPLE table=users type=ALL"]`)
+}
+
+func TestLogger_ExplainError(t *testing.T) {
+	ctx, buf, app := newTestContext()
+	l := testdb.Logger{
+		Slow:    logging.SlowThresholds{Warn: time.Millisecond},
+		Explain: fakeExplainer{err: errors.New("explain not supported")},
+	}
+
+	ctx, err := l.Before(ctx, "user_select_active", "SELECT id FROM users")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	err = l.After(ctx, nil, "user_select_active", "SELECT id FROM users")
+	assert.NoError(t, err)
+
+	// A failed EXPLAIN does not fail the statement.
+	assert.Contains(t, buf.String(), `"level":"warn"`)
+	assert.Contains(t, buf.String(), `"explain_error":"explain not supported"`)
+	assert.NotContains(t, buf.String(), "sql_explain")
+	assert.Empty(t, app.Transactions()[0].Errors())
+}
@@ -0,0 +1,47 @@
+package testdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/rickbassham/example-go/pkg/metrics"
+)
+
+var (
+	startKey = contextKey("start")
+)
+
+// Metrics is a database middleware that records the latency and errors of every sql statement,
+// labeled by statement name. Create it with NewMetrics.
+type Metrics struct {
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+// NewMetrics registers the sql metrics in the registry.
+func NewMetrics(reg *metrics.Registry) Metrics {
+	return Metrics{
+		duration: reg.NewHistogramVec("sql_statement_duration_seconds",
+			"Latency of sql statements.", nil, "statement"),
+		errors: reg.NewCounterVec("sql_statement_errors_total",
+			"Number of sql statements that failed.", "statement"),
+	}
+}
+
+// Before records when the statement started.
+func (m Metrics) Before(ctx context.Context, name, statement string, args ...interface{}) (context.Context, error) {
+	return context.WithValue(ctx, startKey, time.Now()), nil
+}
+
+// After records the latency of the statement, and counts it if it failed.
+func (m Metrics) After(ctx context.Context, err error, name, statement string, args ...interface{}) error {
+	if start, ok := ctx.Value(startKey).(time.Time); ok {
+		m.duration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+
+	if err != nil {
+		m.errors.WithLabelValues(name).Inc()
+	}
+
+	return err
+}
@@ -0,0 +1,33 @@
+package testdb
+
+import (
+	"context"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+func init() {
+	statements["user_roles_select"] = "SELECT role FROM user_roles WHERE subject = ? AND deleted_at IS NULL AND tenant_id = ?"
+}
+
+// Roles returns the roles granted to the principal in the user_roles table, in the tenant on the
+// context. It makes DB an auth.RoleSource.
+func (db *DB) Roles(ctx context.Context, p identity.Principal) ([]string, error) {
+	if p.ID() == "" {
+		return nil, nil
+	}
+
+	var roles []string
+
+	args, err := tenantArgs(ctx, p.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.db.Select(ctx, &roles, "user_roles_select", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,62 @@
+package testdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+)
+
+var (
+	// ErrNoTenant is returned when a statement is executed without a tenant on the context.
+	ErrNoTenant = errors.New("no tenant on the context")
+	// ErrNotTenantScoped is returned when a statement does not filter by the tenant_id column, or is
+	// given a tenant other than the one on the context.
+	ErrNotTenantScoped = errors.New("statement is not scoped to the tenant")
+)
+
+// unscoped are the statements that are not scoped to a tenant, such as those of the audit_events
+// table, which records events from every tenant, and events before the tenant is known.
+var unscoped = map[string]bool{}
+
+// tenantArgs returns the args with the tenant on the context appended. Every statement ends with its
+// tenant_id placeholder, such as WHERE ... AND tenant_id = ?, so it is always the last arg.
+func tenantArgs(ctx context.Context, args ...interface{}) ([]interface{}, error) {
+	tenant, ok := identity.TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	return append(args, tenant), nil
+}
+
+// Tenancy is a database middleware that refuses to run a statement unless it is scoped to the tenant
+// on the context: it must use the tenant_id column, with the tenant as its last arg. It runs before
+// every other middleware, so one tenant can never read or change the rows of another, even through a
+// statement that forgot to add the tenant. Statements that are unscoped by design, such as those of
+// the audit_events table, are let through.
+type Tenancy struct{}
+
+// Before checks that the statement is scoped to the tenant on the context.
+func (Tenancy) Before(ctx context.Context, name, statement string, args ...interface{}) (context.Context, error) {
+	if unscoped[name] {
+		return ctx, nil
+	}
+
+	tenant, ok := identity.TenantFromContext(ctx)
+	if !ok {
+		return ctx, ErrNoTenant
+	}
+
+	if !strings.Contains(statement, "tenant_id") || len(args) == 0 || args[len(args)-1] != tenant {
+		return ctx, ErrNotTenantScoped
+	}
+
+	return ctx, nil
+}
+
+// After does nothing; the statement was already checked.
+func (Tenancy) After(ctx context.Context, err error, name, statement string, args ...interface{}) error {
+	return err
+}
@@ -0,0 +1,38 @@
+package testdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickbassham/example-go/pkg/identity"
+	"github.com/rickbassham/example-go/pkg/testdb"
+)
+
+func TestTenancy(t *testing.T) {
+	const statement = "SELECT id FROM users WHERE deleted_at IS NULL AND tenant_id = ?"
+
+	ctx := identity.WithTenant(context.Background(), "acme")
+	tenancy := testdb.Tenancy{}
+
+	_, err := tenancy.Before(ctx, "user_select_active", statement, "acme")
+	assert.NoError(t, err)
+
+	_, err = tenancy.Before(context.Background(), "user_select_active", statement, "acme")
+	assert.Equal(t, testdb.ErrNoTenant, err)
+
+	_, err = tenancy.Before(ctx, "user_select_active", statement, "globex")
+	assert.Equal(t, testdb.ErrNotTenantScoped, err)
+
+	_, err = tenancy.Before(ctx, "user_select_active", "SELECT id FROM users WHERE username = ?", "acme")
+	assert.Equal(t, testdb.ErrNotTenantScoped, err)
+
+	_, err = tenancy.Before(ctx, "user_select_active", statement)
+	assert.Equal(t, testdb.ErrNotTenantScoped, err)
+}
+
+func TestTenancy_Unscoped(t *testing.T) {
+	_, err := testdb.Tenancy{}.Before(context.Background(), "audit_event_select", "SELECT id FROM audit_events LIMIT ?", 10)
+	assert.NoError(t, err)
+}
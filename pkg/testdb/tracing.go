@@ -0,0 +1,33 @@
+package testdb
+
+import (
+	"context"
+
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+// Tracing is a database middleware that records a span for every sql statement, using the tracer on
+// the context.
+type Tracing struct {
+}
+
+// Before starts the span for the statement.
+func (l Tracing) Before(ctx context.Context, name, statement string, args ...interface{}) (context.Context, error) {
+	ctx, s := tracing.StartSpan(ctx, "mysql "+name, tracing.SpanKindClient)
+
+	s.SetAttribute("db.system", "mysql")
+	s.SetAttribute("db.operation", name)
+	s.SetAttribute("db.statement", statement)
+
+	return ctx, nil
+}
+
+// After ends the span for the statement, recording any error.
+func (l Tracing) After(ctx context.Context, err error, name, statement string, args ...interface{}) error {
+	s := tracing.SpanFromContext(ctx)
+
+	s.SetError(err)
+	s.End()
+
+	return err
+}
@@ -2,8 +2,6 @@ package testdb
 
 import (
 	"context"
-
-	"github.com/rickbassham/example-go/pkg/identity"
 )
 
 type User struct {
@@ -13,14 +11,19 @@ type User struct {
 }
 
 func init() {
-	statements["user_insert"] = "INSERT INTO users (created_by, updated_by, username) VALUES (?, ?, ?)"
-	statements["user_select_active"] = "SELECT id, created_at, updated_at, created_by, updated_by, username FROM users WHERE deleted_at IS NULL"
+	statements["user_insert"] = "INSERT INTO users (created_by, updated_by, username, tenant_id) VALUES (?, ?, ?, ?)"
+	statements["user_select_active"] = "SELECT id, created_at, updated_at, created_by, updated_by, username FROM users WHERE deleted_at IS NULL AND tenant_id = ?"
 }
 
 func (db *DB) InsertUser(ctx context.Context, username string) (int, error) {
-	execUser := identity.FromContext(ctx)
+	execUser := auditUser(ctx)
+
+	args, err := tenantArgs(ctx, execUser, execUser, username)
+	if err != nil {
+		return 0, err
+	}
 
-	id, err := db.db.Insert(ctx, "user_insert", execUser, execUser, username)
+	id, err := db.db.Insert(ctx, "user_insert", args...)
 
 	return int(id), err
 }
@@ -28,7 +31,12 @@ func (db *DB) InsertUser(ctx context.Context, username string) (int, error) {
 func (db *DB) GetActiveUsers(ctx context.Context) ([]User, error) {
 	var users []User
 
-	err := db.db.Select(ctx, &users, "user_select_active")
+	args, err := tenantArgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.db.Select(ctx, &users, "user_select_active", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -9,7 +9,10 @@ func (k contextKey) String() string {
 }
 
 var (
-	traceIDKey = contextKey("traceID")
+	traceIDKey     = contextKey("traceID")
+	spanContextKey = contextKey("spanContext")
+	spanKey        = contextKey("span")
+	tracerKey      = contextKey("tracer")
 )
 
 // WithTraceID adds the traceID to the request context.
@@ -25,3 +28,44 @@ func FromContext(ctx context.Context) string {
 
 	return ""
 }
+
+// WithSpanContext adds the span context to the request context. The trace id is also added, so
+// FromContext keeps working, in the form it has in the X-Trace-Id header.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	ctx = context.WithValue(ctx, spanContextKey, sc)
+	return WithTraceID(ctx, sc.TraceIDHeaderValue())
+}
+
+// SpanContextFromContext retrieves the span context from the request context.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey).(SpanContext)
+	return sc, ok
+}
+
+// SpanFromContext retrieves the current span from the request context. If there is no span on the
+// context, it returns a span that is not recorded, so it is always safe to use.
+func SpanFromContext(ctx context.Context) *Span {
+	if val, ok := ctx.Value(spanKey).(*Span); ok {
+		return val
+	}
+
+	sc, _ := SpanContextFromContext(ctx)
+
+	return &Span{sc: sc}
+}
+
+// WithTracer adds the tracer to the request context, so spans can be started for any work done
+// during the request.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey, t)
+}
+
+// TracerFromContext retrieves the tracer from the request context. It returns nil if there is no
+// tracer, which is safe to use but records nothing.
+func TracerFromContext(ctx context.Context) *Tracer {
+	if val, ok := ctx.Value(tracerKey).(*Tracer); ok {
+		return val
+	}
+
+	return nil
+}
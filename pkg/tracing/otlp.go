@@ -0,0 +1,210 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const instrumentationScope = "github.com/rickbassham/example-go/pkg/tracing"
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+type OTLPExporter struct {
+	endpoint string
+	resource []otlpKeyValue
+	client   *http.Client
+}
+
+// NewOTLPExporter creates a new OTLPExporter. The endpoint is the full url of the traces endpoint,
+// such as http://localhost:4318/v1/traces. The resource attributes, such as service.name, describe
+// this service and are sent with every export. If client is nil, http.DefaultClient is used.
+func NewOTLPExporter(endpoint string, resource map[string]string, client *http.Client) *OTLPExporter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	attrs := make(map[string]interface{}, len(resource))
+	for k, v := range resource {
+		attrs[k] = v
+	}
+
+	return &OTLPExporter{
+		endpoint: endpoint,
+		resource: otlpAttributes(attrs),
+		client:   client,
+	}
+}
+
+// Export sends the spans to the collector.
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: e.resource},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: instrumentationScope},
+				Spans: make([]otlpSpan, 0, len(spans)),
+			}},
+		}},
+	}
+
+	for _, s := range spans {
+		req.ResourceSpans[0].ScopeSpans[0].Spans = append(req.ResourceSpans[0].ScopeSpans[0].Spans, otlpFromSpan(s))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body) // nolint
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// The types below match the OTLP/HTTP JSON encoding of ExportTraceServiceRequest. Trace and span ids
+// are hex encoded, and 64 bit integers are encoded as strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code"`
+}
+
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpFromSpan(s SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.SpanContext.TraceID.String(),
+		SpanID:            s.SpanContext.SpanID.String(),
+		TraceState:        s.SpanContext.TraceState,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.Attributes),
+		Status:            otlpStatus{Code: otlpStatusUnset},
+	}
+
+	if s.SpanContext.ParentSpanID.IsValid() {
+		span.ParentSpanID = s.SpanContext.ParentSpanID.String()
+	}
+
+	if s.Err != nil {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+	}
+
+	return span
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+
+	// Sort the keys so the output is stable.
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+
+	for _, k := range keys {
+		var v otlpValue
+
+		switch val := attrs[k].(type) {
+		case string:
+			v.StringValue = &val
+		case bool:
+			v.BoolValue = &val
+		case int:
+			i := strconv.FormatInt(int64(val), 10)
+			v.IntValue = &i
+		case int64:
+			i := strconv.FormatInt(val, 10)
+			v.IntValue = &i
+		case float64:
+			v.DoubleValue = &val
+		default:
+			str := fmt.Sprintf("%v", val)
+			v.StringValue = &str
+		}
+
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: v})
+	}
+
+	return kvs
+}
@@ -0,0 +1,325 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Header names used to propagate traces.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+	TraceIDHeader     = "X-Trace-Id"
+
+	B3Header             = "b3"
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+	B3FlagsHeader        = "X-B3-Flags"
+)
+
+var (
+	// ErrInvalidTraceParent is returned when a traceparent header does not match the W3C spec.
+	ErrInvalidTraceParent = errors.New("invalid traceparent")
+	// ErrInvalidB3 is returned when the B3 headers do not match the B3 spec.
+	ErrInvalidB3 = errors.New("invalid b3")
+	// ErrInvalidTraceID is returned when an X-Trace-Id header is not a 32 character hex string or a
+	// UUID.
+	ErrInvalidTraceID = errors.New("invalid trace id")
+
+	// From https://www.w3.org/TR/trace-context/#key. Keys are a simple key or a multi-tenant
+	// tenant@system key, and values are printable ASCII without commas or equals signs.
+	traceStateMember = regexp.MustCompile(`^(?:[a-z][a-z0-9_\-*/]{0,255}|[a-z0-9][a-z0-9_\-*/]{0,240}@[a-z][a-z0-9_\-*/]{0,13})=[\x20-\x2b\x2d-\x3c\x3e-\x7e]{0,255}[\x21-\x2b\x2d-\x3c\x3e-\x7e]$`)
+)
+
+const maxTraceStateMembers = 32
+
+// Propagator reads and writes the trace headers on requests. W3C Trace Context and the legacy
+// X-Trace-Id header are always supported. The zero value is ready to use.
+type Propagator struct {
+	// B3 enables reading and writing the Zipkin B3 headers, in both the single and multi header
+	// formats. The multi header format is written.
+	B3 bool
+}
+
+// Extract reads the span context of the caller from the headers. The first valid format found wins,
+// checking traceparent, then B3 if enabled, then X-Trace-Id. Malformed values are ignored. It returns
+// false if no valid span context was found.
+func (p Propagator) Extract(h http.Header) (SpanContext, bool) {
+	if h == nil {
+		return SpanContext{}, false
+	}
+
+	if v := h.Get(TraceParentHeader); v != "" {
+		sc, err := ParseTraceParent(v)
+		if err == nil {
+			sc.TraceState = parseTraceState(h[http.CanonicalHeaderKey(TraceStateHeader)])
+			return sc, true
+		}
+	}
+
+	if p.B3 {
+		if sc, err := parseB3(h); err == nil {
+			return sc, true
+		}
+	}
+
+	if v := h.Get(TraceIDHeader); v != "" {
+		t, err := ParseTraceID(v)
+		if err == nil {
+			// The legacy header has no span id and no sampling decision, so we treat the caller
+			// as sampled to match what traces looked like before. The header is kept as it was
+			// sent, since the caller may not understand the normalized form.
+			return SpanContext{TraceID: t, Sampled: true, LegacyTraceID: v}, true
+		}
+	}
+
+	return SpanContext{}, false
+}
+
+// Inject writes the span context to the headers, in every enabled format. X-Trace-Id is the
+// LegacyTraceID of the span context, if it has one.
+func (p Propagator) Inject(sc SpanContext, h http.Header) {
+	h.Set(TraceParentHeader, sc.TraceParent())
+
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		h.Del(TraceStateHeader)
+	}
+
+	h.Set(TraceIDHeader, sc.TraceIDHeaderValue())
+
+	if p.B3 {
+		h.Set(B3TraceIDHeader, sc.TraceID.String())
+		h.Set(B3SpanIDHeader, sc.SpanID.String())
+
+		if sc.ParentSpanID.IsValid() {
+			h.Set(B3ParentSpanIDHeader, sc.ParentSpanID.String())
+		} else {
+			h.Del(B3ParentSpanIDHeader)
+		}
+
+		if sc.Sampled {
+			h.Set(B3SampledHeader, "1")
+		} else {
+			h.Set(B3SampledHeader, "0")
+		}
+	}
+}
+
+// TraceParent formats the span context as a W3C traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent parses a W3C traceparent header value. The returned span context is the
+// caller's, so its SpanID is the id of the parent of any span we start.
+func ParseTraceParent(v string) (SpanContext, error) {
+	var sc SpanContext
+
+	// version-traceid-parentid-flags, with a fixed width for each field.
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, ErrInvalidTraceParent
+	}
+
+	version := v[0:2]
+	if !isLowerHex(version) || version == "ff" {
+		return sc, ErrInvalidTraceParent
+	}
+
+	// Version 00 has exactly four fields; future versions may append more after another dash.
+	if (version == "00" && len(v) != 55) || (len(v) > 55 && v[55] != '-') {
+		return sc, ErrInvalidTraceParent
+	}
+
+	if !decodeLowerHex(sc.TraceID[:], v[3:35]) || !sc.TraceID.IsValid() {
+		return sc, ErrInvalidTraceParent
+	}
+
+	if !decodeLowerHex(sc.SpanID[:], v[36:52]) || !sc.SpanID.IsValid() {
+		return sc, ErrInvalidTraceParent
+	}
+
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], v[53:55]) {
+		return sc, ErrInvalidTraceParent
+	}
+
+	sc.Sampled = flags[0]&0x01 == 0x01
+
+	return sc, nil
+}
+
+// ParseTraceID parses a legacy X-Trace-Id header value. Both 32 character hex strings and UUIDs
+// are accepted.
+func ParseTraceID(v string) (TraceID, error) {
+	var t TraceID
+
+	v = strings.ToLower(v)
+
+	if len(v) == 36 && v[8] == '-' && v[13] == '-' && v[18] == '-' && v[23] == '-' {
+		v = strings.Replace(v, "-", "", -1)
+	}
+
+	if len(v) != 32 || !decodeLowerHex(t[:], v) || !t.IsValid() {
+		return t, ErrInvalidTraceID
+	}
+
+	return t, nil
+}
+
+// parseTraceState returns the combined tracestate header values, or an empty string if any list
+// member is invalid.
+func parseTraceState(values []string) string {
+	var members []string
+
+	for _, v := range values {
+		for _, m := range strings.Split(v, ",") {
+			m = strings.Trim(m, " \t")
+			if m == "" {
+				continue
+			}
+
+			if !traceStateMember.MatchString(m) {
+				return ""
+			}
+
+			members = append(members, m)
+		}
+	}
+
+	if len(members) > maxTraceStateMembers {
+		return ""
+	}
+
+	return strings.Join(members, ",")
+}
+
+func parseB3(h http.Header) (SpanContext, error) {
+	if v := h.Get(B3Header); v != "" {
+		return parseB3Single(v)
+	}
+
+	var sc SpanContext
+
+	traceID := h.Get(B3TraceIDHeader)
+	spanID := h.Get(B3SpanIDHeader)
+
+	if traceID == "" || spanID == "" {
+		return sc, ErrInvalidB3
+	}
+
+	if !parseB3TraceID(&sc.TraceID, traceID) || !decodeLowerHex(sc.SpanID[:], spanID) || !sc.SpanID.IsValid() {
+		return sc, ErrInvalidB3
+	}
+
+	if parent := h.Get(B3ParentSpanIDHeader); parent != "" && !decodeLowerHex(sc.ParentSpanID[:], parent) {
+		return sc, ErrInvalidB3
+	}
+
+	switch h.Get(B3SampledHeader) {
+	case "1", "true":
+		sc.Sampled = true
+	case "0", "false":
+		sc.Sampled = false
+	case "":
+		// Defer the decision to us; sample it like the legacy header.
+		sc.Sampled = true
+	default:
+		return sc, ErrInvalidB3
+	}
+
+	// The debug flag implies sampling.
+	if h.Get(B3FlagsHeader) == "1" {
+		sc.Sampled = true
+	}
+
+	return sc, nil
+}
+
+// parseB3Single parses the single b3 header: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId},
+// where the last two fields are optional.
+func parseB3Single(v string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(v, "-")
+
+	// A lone sampling state carries no context to continue.
+	if len(parts) < 2 || len(parts) > 4 {
+		return sc, ErrInvalidB3
+	}
+
+	if !parseB3TraceID(&sc.TraceID, parts[0]) || !decodeLowerHex(sc.SpanID[:], parts[1]) || !sc.SpanID.IsValid() {
+		return sc, ErrInvalidB3
+	}
+
+	sc.Sampled = true
+
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+			sc.Sampled = true
+		case "0":
+			sc.Sampled = false
+		default:
+			return sc, ErrInvalidB3
+		}
+	}
+
+	if len(parts) > 3 && !decodeLowerHex(sc.ParentSpanID[:], parts[3]) {
+		return sc, ErrInvalidB3
+	}
+
+	return sc, nil
+}
+
+// parseB3TraceID accepts both 64 and 128 bit B3 trace ids. 64 bit ids are left padded with zeros.
+func parseB3TraceID(t *TraceID, v string) bool {
+	switch len(v) {
+	case 16:
+		if !decodeLowerHex(t[8:], v) {
+			return false
+		}
+	case 32:
+		if !decodeLowerHex(t[:], v) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	return t.IsValid()
+}
+
+// decodeLowerHex decodes s into dst, which must be exactly the right size. Uppercase hex is rejected,
+// as required by the W3C spec.
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || !isLowerHex(s) {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+
+	return err == nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,115 @@
+package tracing_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	sc, err := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+}
+
+func TestParseTraceParent_FutureVersion(t *testing.T) {
+	sc, err := tracing.ParseTraceParent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what-the-future-holds")
+	require.NoError(t, err)
+
+	assert.False(t, sc.Sampled)
+}
+
+func TestParseTraceParent_Invalid(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"my-cool-trace-id",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	} {
+		_, err := tracing.ParseTraceParent(v)
+		assert.Equal(t, tracing.ErrInvalidTraceParent, err, v)
+	}
+}
+
+func TestPropagator_InvalidTraceState(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set("tracestate", "Invalid Key=value")
+
+	sc, ok := tracing.Propagator{}.Extract(h)
+	require.True(t, ok)
+
+	assert.Equal(t, "", sc.TraceState)
+}
+
+func TestPropagator_B3Disabled(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-B3-TraceId", "80f198ee56343ba864fe8b2a57d3eff7")
+	h.Set("X-B3-SpanId", "e457b5a2e4d86bd1")
+
+	_, ok := tracing.Propagator{}.Extract(h)
+
+	assert.False(t, ok)
+}
+
+func TestPropagator_B3Multi(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-B3-TraceId", "64fe8b2a57d3eff7")
+	h.Set("X-B3-SpanId", "e457b5a2e4d86bd1")
+	h.Set("X-B3-ParentSpanId", "05e3ac9a4f6e3b90")
+	h.Set("X-B3-Sampled", "1")
+
+	sc, ok := tracing.Propagator{B3: true}.Extract(h)
+	require.True(t, ok)
+
+	assert.Equal(t, "000000000000000064fe8b2a57d3eff7", sc.TraceID.String())
+	assert.Equal(t, "e457b5a2e4d86bd1", sc.SpanID.String())
+	assert.Equal(t, "05e3ac9a4f6e3b90", sc.ParentSpanID.String())
+	assert.True(t, sc.Sampled)
+}
+
+func TestPropagator_Inject(t *testing.T) {
+	sc, err := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	sc.TraceState = "congo=t61rcWkgMzE"
+
+	h := http.Header{}
+	tracing.Propagator{B3: true}.Inject(sc, h)
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", h.Get("traceparent"))
+	assert.Equal(t, "congo=t61rcWkgMzE", h.Get("tracestate"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", h.Get("X-Trace-Id"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", h.Get("X-B3-TraceId"))
+	assert.Equal(t, "00f067aa0ba902b7", h.Get("X-B3-SpanId"))
+	assert.Equal(t, "1", h.Get("X-B3-Sampled"))
+}
+
+func TestPropagator_LegacyTraceID(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Trace-Id", "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736")
+
+	sc, ok := tracing.Propagator{}.Extract(h)
+	require.True(t, ok)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736", sc.LegacyTraceID)
+
+	out := http.Header{}
+	tracing.Propagator{}.Inject(sc.Child(), out)
+
+	assert.Equal(t, "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736", out.Get("X-Trace-Id"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", out.Get("traceparent")[3:35])
+}
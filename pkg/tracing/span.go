@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind describes the relationship between a span and the remote side of the operation. The
+// values match the OTLP SpanKind enum.
+type SpanKind int
+
+const (
+	// SpanKindInternal is an operation that does not cross a process boundary.
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is an incoming request.
+	SpanKindServer SpanKind = 2
+	// SpanKindClient is an outgoing call, such as an http request, redis command or sql statement.
+	SpanKindClient SpanKind = 3
+)
+
+// Span records a single timed operation within a trace. A span that is not being recorded, because
+// it was not sampled or there is no Tracer, is still safe to use; its methods do nothing.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu         sync.Mutex
+	name       string
+	kind       SpanKind
+	start      time.Time
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+// SpanData is a finished span, ready to be exported.
+type SpanData struct {
+	SpanContext SpanContext
+	Name        string
+	Kind        SpanKind
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+	Err         error
+}
+
+// SpanContext returns the span context of the span, to be propagated to other services.
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// IsRecording returns true if the span will be exported when it ends.
+func (s *Span) IsRecording() bool {
+	return s.tracer != nil && s.sc.Sampled
+}
+
+// SetName changes the name of the span, such as when a request's route is known after routing.
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute adds an attribute to the span. Values should be strings, bools, ints or floats.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with the given error. A nil error is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil || !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Calling End more than once has no effect.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+
+	end := time.Now()
+
+	s.mu.Lock()
+
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+
+	d := SpanData{
+		SpanContext: s.sc,
+		Name:        s.name,
+		Kind:        s.kind,
+		Start:       s.start,
+		End:         end,
+		Attributes:  s.attributes,
+		Err:         s.err,
+	}
+
+	s.mu.Unlock()
+
+	s.tracer.enqueue(d)
+}
+
+// StartSpan starts a new span as a child of the span on the context, using the Tracer on the context.
+// If there is no span on the context, a new trace is started. The returned context carries the new
+// span, so it should be used for the rest of the operation.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := TracerFromContext(ctx)
+
+	var sc SpanContext
+
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		sc = parent.Child()
+	} else {
+		sc = NewSpanContext(true)
+		sc.Sampled = t.Sample(sc.TraceID)
+	}
+
+	return t.Start(ctx, sc, name, kind)
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// TraceID identifies a single trace across all of the services it touches.
+type TraceID [16]byte
+
+// String returns the lowercase hex representation of the trace id.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid returns false if the trace id is all zeros, which the W3C spec reserves as invalid.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a single operation within a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex representation of the span id.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid returns false if the span id is all zeros, which the W3C spec reserves as invalid.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext is the part of a span that is propagated between services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// ParentSpanID is the span that caused this one. It is all zeros for the root span of a trace.
+	ParentSpanID SpanID
+	// Sampled is true if the caller is recording this trace.
+	Sampled bool
+	// TraceState is the opaque, vendor specific W3C tracestate header value.
+	TraceState string
+	// LegacyTraceID is the X-Trace-Id header value the trace was continued from, as the caller sent
+	// it, such as a UUID. It is sent in X-Trace-Id instead of the TraceID, so callers get back the id
+	// they gave us; see Propagator.
+	LegacyTraceID string
+}
+
+// IsValid returns true if both the trace id and span id are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Child creates the context for a new span within the same trace, using sc as its parent.
+func (sc SpanContext) Child() SpanContext {
+	return SpanContext{
+		TraceID:       sc.TraceID,
+		SpanID:        NewSpanID(),
+		ParentSpanID:  sc.SpanID,
+		Sampled:       sc.Sampled,
+		TraceState:    sc.TraceState,
+		LegacyTraceID: sc.LegacyTraceID,
+	}
+}
+
+// TraceIDHeaderValue returns the value of the X-Trace-Id header for the span context: the
+// LegacyTraceID if there is one, otherwise the TraceID.
+func (sc SpanContext) TraceIDHeaderValue() string {
+	if sc.LegacyTraceID != "" {
+		return sc.LegacyTraceID
+	}
+
+	return sc.TraceID.String()
+}
+
+// NewSpanContext starts a new trace, returning the context of its root span.
+func NewSpanContext(sampled bool) SpanContext {
+	return SpanContext{
+		TraceID: NewTraceID(),
+		SpanID:  NewSpanID(),
+		Sampled: sampled,
+	}
+}
+
+// NewTraceID creates a new random trace id.
+func NewTraceID() TraceID {
+	var t TraceID
+
+	for !t.IsValid() {
+		rand.Read(t[:]) // nolint
+	}
+
+	return t
+}
+
+// NewSpanID creates a new random span id.
+func NewSpanID() SpanID {
+	var s SpanID
+
+	for !s.IsValid() {
+		rand.Read(s[:]) // nolint
+	}
+
+	return s
+}
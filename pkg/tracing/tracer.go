@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// TracerOptions configures a Tracer. Any zero values will be replaced with sensible defaults.
+type TracerOptions struct {
+	// Exporter receives batches of finished spans. It is required.
+	Exporter Exporter
+	// SampleRatio is the fraction of new traces that are recorded, from 0 to 1. Traces started by a
+	// caller keep the caller's sampling decision.
+	SampleRatio float64
+	// QueueSize is the number of finished spans buffered for export. Spans are dropped when the queue
+	// is full, rather than slowing down requests.
+	QueueSize int
+	// BatchSize is the maximum number of spans sent in one export.
+	BatchSize int
+	// BatchTimeout is the longest a span waits in the queue before being exported.
+	BatchTimeout time.Duration
+	// Log is used to report export failures and dropped spans. If nil, nothing is logged.
+	Log *zap.Logger
+}
+
+// Tracer records sampled spans and exports them in batches in the background.
+type Tracer struct {
+	// dropped is first so it is 64 bit aligned for atomic operations on 32 bit platforms.
+	dropped uint64
+
+	opts TracerOptions
+
+	sampleBound uint64
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan SpanData
+	done   chan struct{}
+}
+
+// NewTracer creates a new Tracer and starts its export loop. Call Shutdown to flush any queued spans
+// before exiting.
+func NewTracer(opts TracerOptions) *Tracer {
+	if opts.SampleRatio < 0 {
+		opts.SampleRatio = 0
+	}
+
+	if opts.SampleRatio > 1 {
+		opts.SampleRatio = 1
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 2048
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+
+	if opts.BatchTimeout <= 0 {
+		opts.BatchTimeout = 5 * time.Second
+	}
+
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
+	t := &Tracer{
+		opts:  opts,
+		queue: make(chan SpanData, opts.QueueSize),
+		done:  make(chan struct{}),
+		// The low 8 bytes of the trace id are compared against this bound, so every service
+		// sampling at the same ratio makes the same decision for a trace.
+		sampleBound: uint64(opts.SampleRatio*(1<<63)) << 1,
+	}
+
+	go t.run()
+
+	return t
+}
+
+// Start begins recording a span with the given span context. The returned context carries the span
+// and its span context. It is safe to call on a nil Tracer; the span will not be recorded.
+func (t *Tracer) Start(ctx context.Context, sc SpanContext, name string, kind SpanKind) (context.Context, *Span) {
+	s := &Span{
+		tracer: t,
+		sc:     sc,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+
+	if s.IsRecording() {
+		s.attributes = map[string]interface{}{}
+	}
+
+	ctx = WithSpanContext(ctx, sc)
+	ctx = context.WithValue(ctx, spanKey, s)
+
+	return ctx, s
+}
+
+// Sample makes the head based sampling decision for a new trace. A nil Tracer samples everything, so
+// callers further down the line can make their own decision.
+func (t *Tracer) Sample(traceID TraceID) bool {
+	if t == nil || t.opts.SampleRatio >= 1 {
+		return true
+	}
+
+	return binary.BigEndian.Uint64(traceID[8:]) < t.sampleBound
+}
+
+// Shutdown exports any queued spans and stops the export loop. No spans will be exported after it
+// has been called.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(d SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.queue <- d:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	batch := make([]SpanData, 0, t.opts.BatchSize)
+
+	timer := time.NewTimer(t.opts.BatchTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case d, ok := <-t.queue:
+			if !ok {
+				t.export(batch)
+				return
+			}
+
+			batch = append(batch, d)
+
+			if len(batch) >= t.opts.BatchSize {
+				t.export(batch)
+				batch = batch[:0]
+			}
+		case <-timer.C:
+			t.export(batch)
+			batch = batch[:0]
+
+			timer.Reset(t.opts.BatchTimeout)
+		}
+	}
+}
+
+func (t *Tracer) export(batch []SpanData) {
+	if dropped := atomic.SwapUint64(&t.dropped, 0); dropped > 0 {
+		t.opts.Log.Warn("trace queue full, spans dropped", zap.Uint64("dropped_spans", dropped))
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.opts.BatchTimeout)
+	defer cancel()
+
+	err := t.opts.Exporter.Export(ctx, batch)
+	if err != nil {
+		t.opts.Log.Error("error exporting spans", zap.Error(err), zap.Int("spans", len(batch)))
+	}
+}
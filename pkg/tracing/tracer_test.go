@@ -0,0 +1,133 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rickbassham/example-go/pkg/tracing"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *memoryExporter) Export(ctx context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, spans...)
+
+	return nil
+}
+
+func TestTracer_StartSpan(t *testing.T) {
+	exp := &memoryExporter{}
+	tr := tracing.NewTracer(tracing.TracerOptions{Exporter: exp, SampleRatio: 1})
+
+	ctx := tracing.WithTracer(context.Background(), tr)
+
+	ctx, parent := tracing.StartSpan(ctx, "parent", tracing.SpanKindServer)
+	_, child := tracing.StartSpan(ctx, "child", tracing.SpanKindClient)
+
+	child.SetAttribute("db.system", "redis")
+	child.SetError(errors.New("oh no"))
+	child.End()
+	parent.End()
+
+	require.NoError(t, tr.Shutdown(context.Background()))
+	require.Len(t, exp.spans, 2)
+
+	assert.Equal(t, "child", exp.spans[0].Name)
+	assert.Equal(t, parent.SpanContext().TraceID, exp.spans[0].SpanContext.TraceID)
+	assert.Equal(t, parent.SpanContext().SpanID, exp.spans[0].SpanContext.ParentSpanID)
+	assert.Equal(t, "redis", exp.spans[0].Attributes["db.system"])
+	assert.EqualError(t, exp.spans[0].Err, "oh no")
+	assert.Equal(t, "parent", exp.spans[1].Name)
+}
+
+func TestTracer_NotSampled(t *testing.T) {
+	exp := &memoryExporter{}
+	tr := tracing.NewTracer(tracing.TracerOptions{Exporter: exp, SampleRatio: 0})
+
+	ctx := tracing.WithTracer(context.Background(), tr)
+
+	_, s := tracing.StartSpan(ctx, "span", tracing.SpanKindInternal)
+	s.End()
+
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	assert.False(t, s.SpanContext().Sampled)
+	assert.Empty(t, exp.spans)
+}
+
+func TestTracer_NoTracer(t *testing.T) {
+	ctx, s := tracing.StartSpan(context.Background(), "span", tracing.SpanKindInternal)
+	s.SetAttribute("key", "value")
+	s.End()
+
+	assert.False(t, s.IsRecording())
+	assert.Equal(t, s.SpanContext().TraceID.String(), tracing.FromContext(ctx))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+
+		w.WriteHeader(200)
+	}))
+	defer s.Close()
+
+	sc, err := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	exp := tracing.NewOTLPExporter(s.URL, map[string]string{"service.name": "chiapi"}, nil)
+
+	err = exp.Export(context.Background(), []tracing.SpanData{{
+		SpanContext: sc,
+		Name:        "GET /health",
+		Kind:        tracing.SpanKindServer,
+		Attributes:  map[string]interface{}{"http.status_code": 200},
+	}})
+	require.NoError(t, err)
+
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resource := rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	span := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+
+	assert.Equal(t, "service.name", resource["key"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["spanId"])
+	assert.Equal(t, "GET /health", span["name"])
+	assert.Equal(t, float64(2), span["kind"])
+	assert.Equal(t, map[string]interface{}{"key": "http.status_code", "value": map[string]interface{}{"intValue": "200"}},
+		span["attributes"].([]interface{})[0])
+}
+
+func TestOTLPExporter_Error(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer s.Close()
+
+	exp := tracing.NewOTLPExporter(s.URL, nil, nil)
+
+	err := exp.Export(context.Background(), []tracing.SpanData{{Name: "span"}})
+
+	assert.EqualError(t, err, "otlp export failed with status 503")
+}